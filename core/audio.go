@@ -0,0 +1,233 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrNoEsds is returned by ParseEsds when the sample entry has no esds box
+var ErrNoEsds = errors.New("esds box not found in sample description")
+
+// MPEG-4 descriptor tags used inside esds (ISO/IEC 14496-1)
+const (
+	esDescrTag            = 0x03
+	decoderConfigDescrTag = 0x04
+	decSpecificInfoTag    = 0x05
+)
+
+// AudioInfo holds the fields of an audio sample entry ('mp4a', SoundSampleEntry)
+type AudioInfo struct {
+	SampleRate   uint32 // Hz
+	ChannelCount uint16
+	SampleSize   uint16 // Bits per sample
+	ObjectType   uint8  // esds objectTypeIndication, e.g. 0x40 for AAC (0 without esds)
+}
+
+// ParseAudioStsd reads the AudioInfo of the first sample entry in an stsd
+// payload. The 16.16 fixed-point sample rate is returned in whole Hz.
+func (d *Demuxer) ParseAudioStsd(stsd []byte) (AudioInfo, error) {
+	rate, channels, sampleSize, ok := parseAudioSampleEntry(stsd)
+	if !ok {
+		return AudioInfo{}, fmt.Errorf("stsd payload too short for an audio sample entry (%d bytes)", len(stsd))
+	}
+	return AudioInfo{SampleRate: rate, ChannelCount: channels, SampleSize: sampleSize}, nil
+}
+
+// tkhdVolume returns the 8.8 fixed-point volume of a tkhd payload (0 if truncated)
+func tkhdVolume(tkhd []byte) uint16 {
+	// V0: Ver/Flags(4) + times(8) + TrackID(4) + Reserved(4) + Duration(4) +
+	// Reserved(8) + Layer(2) + AlternateGroup(2); V1 has 12 more bytes of times/duration
+	pos := 36
+	if len(tkhd) > 0 && tkhd[0] == 1 {
+		pos = 48
+	}
+	if len(tkhd) < pos+2 {
+		return 0
+	}
+	return binary.BigEndian.Uint16(tkhd[pos : pos+2])
+}
+
+// stsd payload layout up to the first sample entry's fields:
+// Ver/Flags(4) + EntryCount(4) + EntrySize(4) + CodecTag(4) + Reserved(6) + DataRefIndex(2)
+const stsdEntryFieldsOffset = 24
+
+// parseAudioSampleEntry reads the AudioSampleEntry fields of the first sample
+// entry in an stsd payload (ISO/IEC 14496-12 8.5.2.2). QuickTime version 2
+// entries carry dummy values there and the real ones in their extension.
+func parseAudioSampleEntry(stsd []byte) (sampleRate uint32, channels, sampleSize uint16, ok bool) {
+	// Version(2) + Revision(2) + Vendor(4) (ISO: reserved) +
+	// ChannelCount(2) + SampleSize(2) + PreDefined(2) + Reserved(2) + SampleRate(4)
+	p := stsdEntryFieldsOffset
+	if len(stsd) < p+20 {
+		return 0, 0, 0, false
+	}
+	channels = binary.BigEndian.Uint16(stsd[p+8 : p+10])
+	sampleSize = binary.BigEndian.Uint16(stsd[p+10 : p+12])
+	sampleRate = binary.BigEndian.Uint32(stsd[p+16:p+20]) >> 16 // 16.16 fixed point
+
+	if binary.BigEndian.Uint16(stsd[p:p+2]) == 2 {
+		// v2: SizeOfStructOnly(4) + AudioSampleRate(float64) + NumAudioChannels(4) +
+		// Always7F000000(4) + ConstBitsPerChannel(4) + ...
+		x := p + 20
+		if len(stsd) < x+24 {
+			return 0, 0, 0, false
+		}
+		sampleRate = uint32(math.Float64frombits(binary.BigEndian.Uint64(stsd[x+4 : x+12])))
+		channels = uint16(binary.BigEndian.Uint32(stsd[x+12 : x+16]))
+		sampleSize = uint16(binary.BigEndian.Uint32(stsd[x+20 : x+24]))
+	}
+	return sampleRate, channels, sampleSize, true
+}
+
+// AudioSampleRate returns the sample rate in Hz declared by the audio sample
+// entry, or 0 for non-audio tracks and unparsable descriptions.
+func (t Track) AudioSampleRate() uint32 {
+	if t.Type != TrackTypeAudio {
+		return 0
+	}
+	rate, _, _, _ := parseAudioSampleEntry(t.Stsd)
+	return rate
+}
+
+// Channels returns the channel count declared by the audio sample entry,
+// or 0 for non-audio tracks and unparsable descriptions.
+func (t Track) Channels() uint16 {
+	if t.Type != TrackTypeAudio {
+		return 0
+	}
+	_, channels, _, _ := parseAudioSampleEntry(t.Stsd)
+	return channels
+}
+
+// IsAAC reports whether the track is AAC audio: an mp4a entry whose esds
+// declares MPEG-4 (0x40) or MPEG-2 AAC (0x66-0x68)
+func (t Track) IsAAC() bool {
+	if t.Type != TrackTypeAudio || t.CodecTag != "mp4a" {
+		return false
+	}
+	switch t.Audio.ObjectType {
+	case 0x40, 0x66, 0x67, 0x68:
+		return true
+	}
+	return false
+}
+
+// IsOpus reports whether the track is Opus audio ('Opus' sample entry, whose
+// dOps box is kept in AudioConfig)
+func (t Track) IsOpus() bool {
+	return t.Type == TrackTypeAudio && t.CodecTag == "Opus"
+}
+
+// ParseEsds returns the DecoderSpecificInfo carried by the esds box of the
+// first sample entry in an stsd payload: for AAC, the AudioSpecificConfig a
+// decoder or an ADTS muxer needs. Empty (not an error) when the decoder config
+// has none.
+func (d *Demuxer) ParseEsds(stsd []byte) ([]byte, error) {
+	_, config, err := parseEsdsPayload(stsd)
+	return config, err
+}
+
+// parseEsdsPayload finds the esds of the first sample entry (directly or in
+// its QuickTime 'wave' box) and returns its objectTypeIndication and
+// DecoderSpecificInfo
+func parseEsdsPayload(stsd []byte) (uint8, []byte, error) {
+	esds := findSampleEntryBox(stsd, TrackTypeAudio, "esds")
+	if esds == nil {
+		// QuickTime v1/v2 sound descriptions nest it in a 'wave' box
+		esds = findBox(findSampleEntryBox(stsd, TrackTypeAudio, "wave"), "esds")
+	}
+	if esds == nil {
+		return 0, nil, ErrNoEsds
+	}
+	if len(esds) < 4 {
+		return 0, nil, fmt.Errorf("%w: esds payload is %d bytes", ErrTruncatedAtom, len(esds))
+	}
+	// FullBox version/flags, then the ES_Descriptor
+	tag, es, _, err := readDescriptor(esds, 4)
+	if err != nil {
+		return 0, nil, err
+	}
+	if tag != esDescrTag {
+		return 0, nil, fmt.Errorf("%w: esds starts with descriptor tag %#x, want ES_Descriptor", ErrMalformedAtom, tag)
+	}
+
+	// ES_ID(2) + flags(1), then the optional fields the flags announce
+	if len(es) < 3 {
+		return 0, nil, fmt.Errorf("%w: ES_Descriptor is %d bytes", ErrTruncatedAtom, len(es))
+	}
+	flags := es[2]
+	pos := 3
+	if flags&0x80 != 0 { // streamDependenceFlag: dependsOn_ES_ID
+		pos += 2
+	}
+	if flags&0x40 != 0 { // URL_Flag: URLlength + URLstring
+		if pos >= len(es) {
+			return 0, nil, fmt.Errorf("%w: ES_Descriptor URL", ErrTruncatedAtom)
+		}
+		pos += 1 + int(es[pos])
+	}
+	if flags&0x20 != 0 { // OCRstreamFlag: OCR_ES_Id
+		pos += 2
+	}
+
+	for pos < len(es) {
+		tag, body, next, err := readDescriptor(es, pos)
+		if err != nil {
+			return 0, nil, err
+		}
+		pos = next
+		if tag != decoderConfigDescrTag {
+			continue // e.g. SLConfigDescriptor
+		}
+		// objectTypeIndication(1) + streamType(1) + bufferSizeDB(3) +
+		// maxBitrate(4) + avgBitrate(4), then DecoderSpecificInfo
+		if len(body) < 13 {
+			return 0, nil, fmt.Errorf("%w: DecoderConfigDescriptor is %d bytes", ErrTruncatedAtom, len(body))
+		}
+		objectType := body[0]
+		for p := 13; p < len(body); {
+			tag, info, next, err := readDescriptor(body, p)
+			if err != nil {
+				return objectType, nil, err
+			}
+			if tag == decSpecificInfoTag {
+				return objectType, append([]byte(nil), info...), nil
+			}
+			p = next
+		}
+		return objectType, nil, nil
+	}
+	return 0, nil, fmt.Errorf("%w: esds has no DecoderConfigDescriptor", ErrMalformedAtom)
+}
+
+// readDescriptor reads the MPEG-4 descriptor starting at p[pos]: a tag byte
+// and a size of up to four bytes holding 7 bits each (the high bit flags a
+// continuation). Returns the tag, the body and the position after it.
+func readDescriptor(p []byte, pos int) (tag byte, body []byte, next int, err error) {
+	if pos >= len(p) {
+		return 0, nil, 0, fmt.Errorf("%w: descriptor header at %d", ErrTruncatedAtom, pos)
+	}
+	tag = p[pos]
+	pos++
+	size := 0
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, 0, fmt.Errorf("%w: descriptor %#x size field longer than 4 bytes", ErrMalformedAtom, tag)
+		}
+		if pos >= len(p) {
+			return 0, nil, 0, fmt.Errorf("%w: descriptor %#x size", ErrTruncatedAtom, tag)
+		}
+		b := p[pos]
+		pos++
+		size = size<<7 | int(b&0x7F)
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	if size > len(p)-pos {
+		return 0, nil, 0, fmt.Errorf("%w: descriptor %#x declares %d bytes, %d remain", ErrTruncatedAtom, tag, size, len(p)-pos)
+	}
+	return tag, p[pos : pos+size], pos + size, nil
+}
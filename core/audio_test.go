@@ -0,0 +1,209 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+)
+
+// makeMp4aStsd builds an stsd payload holding one mp4a AudioSampleEntry
+func makeMp4aStsd(sampleRate uint32, channels uint16, extra []byte) []byte {
+	entry := make([]byte, 36)
+	binary.BigEndian.PutUint32(entry[0:4], uint32(36+len(extra)))
+	copy(entry[4:8], "mp4a")
+	binary.BigEndian.PutUint16(entry[14:16], 1) // data_reference_index
+	binary.BigEndian.PutUint16(entry[24:26], channels)
+	binary.BigEndian.PutUint16(entry[26:28], 16)
+	binary.BigEndian.PutUint32(entry[32:36], sampleRate<<16)
+	entry = append(entry, extra...)
+
+	stsd := make([]byte, 8)
+	binary.BigEndian.PutUint32(stsd[4:8], 1) // entry count
+	return append(stsd, entry...)
+}
+
+func TestAudioSampleEntry(t *testing.T) {
+	tr := Track{Type: TrackTypeAudio, Stsd: makeMp4aStsd(44100, 2, nil)}
+	if got := tr.AudioSampleRate(); got != 44100 {
+		t.Errorf("Expected sample rate 44100, got %d", got)
+	}
+	if got := tr.Channels(); got != 2 {
+		t.Errorf("Expected 2 channels, got %d", got)
+	}
+
+	video := Track{Type: TrackTypeVideo, Stsd: tr.Stsd}
+	if video.AudioSampleRate() != 0 || video.Channels() != 0 {
+		t.Error("Expected zero audio info for a video track")
+	}
+}
+
+// makeAACEsds builds an esds box (FullBox header + ES_Descriptor) carrying an
+// AAC-LC AudioSpecificConfig as DecoderSpecificInfo
+func makeAACEsds(asc []byte) []byte {
+	dsi := append([]byte{0x05, byte(len(asc))}, asc...)
+	dcd := append([]byte{0x04, byte(13 + len(dsi)),
+		0x40,       // objectTypeIndication: MPEG-4 Audio
+		0x15,       // streamType audio, upstream 0, reserved 1
+		0, 0x03, 0, // bufferSizeDB
+		0, 0x01, 0xF4, 0, // maxBitrate
+		0, 0x01, 0xF4, 0, // avgBitrate
+	}, dsi...)
+	sl := []byte{0x06, 0x01, 0x02}
+	es := append([]byte{0x03, byte(3 + len(dcd) + len(sl)), 0, 1, 0}, dcd...)
+	es = append(es, sl...)
+	return makeBox("esds", append([]byte{0, 0, 0, 0}, es...))
+}
+
+func TestAudioEsdsRoundTrip(t *testing.T) {
+	asc := []byte{0x11, 0x90} // AAC-LC, 48 kHz, stereo
+	esds := makeAACEsds(asc)
+
+	audio := syntheticTrack(TrackTypeAudio, 48000, 20, 1024, 50)
+	audio.Stsd = makeMp4aStsd(48000, 2, esds)
+	tracks := []Track{audio}
+	src := writeSyntheticSource(t, tracks)
+
+	// Two passes: demux(remux(track)) and then once more from the output
+	first := remuxAndDemux(t, src, tracks)
+	second := remuxAndDemux(t, src, []Track{{
+		Type: first[0].Type, Timescale: first[0].Timescale, Hdlr: first[0].Hdlr,
+		Stsd: first[0].Stsd, Samples: tracks[0].Samples,
+	}})
+
+	for pass, got := range [][]Track{first, second} {
+		if got[0].CodecTag != "mp4a" {
+			t.Fatalf("pass %d: expected mp4a, got %q", pass, got[0].CodecTag)
+		}
+		gotEsds := findSampleEntryBox(got[0].Stsd, TrackTypeAudio, "esds")
+		if !bytes.Equal(gotEsds, esds[8:]) {
+			t.Errorf("pass %d: esds payload changed\n got %x\nwant %x", pass, gotEsds, esds[8:])
+		}
+		if rate, ch := got[0].AudioSampleRate(), got[0].Channels(); rate != 48000 || ch != 2 {
+			t.Errorf("pass %d: expected 48000 Hz stereo, got %d Hz %d ch", pass, rate, ch)
+		}
+	}
+}
+
+// makeQuickTimeAudioStsd builds an stsd payload holding one version 1 or 2
+// QuickTime sound description followed by extra child boxes
+func makeQuickTimeAudioStsd(version uint16, sampleRate uint32, channels uint16, extra []byte) []byte {
+	stsd := makeMp4aStsd(sampleRate, channels, nil)
+	entry := stsd[8:]
+	binary.BigEndian.PutUint16(entry[16:18], version)
+
+	var ext []byte
+	switch version {
+	case 1:
+		ext = make([]byte, 16) // samples/bytes per packet/frame/sample
+		binary.BigEndian.PutUint32(ext[0:4], 1024)
+	case 2:
+		binary.BigEndian.PutUint16(entry[24:26], 3)          // dummy channel count
+		binary.BigEndian.PutUint32(entry[32:36], 0x00010000) // dummy sample rate
+		ext = make([]byte, 36)
+		binary.BigEndian.PutUint32(ext[0:4], 72)
+		binary.BigEndian.PutUint64(ext[4:12], math.Float64bits(float64(sampleRate)))
+		binary.BigEndian.PutUint32(ext[12:16], uint32(channels))
+		binary.BigEndian.PutUint32(ext[16:20], 0x7F000000)
+		binary.BigEndian.PutUint32(ext[20:24], 24)
+	}
+	entry = append(append(entry, ext...), extra...)
+	binary.BigEndian.PutUint32(entry[0:4], uint32(len(entry)))
+	return append(stsd[:8], entry...)
+}
+
+func TestAudioSampleEntryVersions(t *testing.T) {
+	esds := makeAACEsds([]byte{0x12, 0x10}) // AAC-LC, 44.1 kHz, stereo
+	for _, tc := range []struct {
+		version    uint16
+		rate       uint32
+		channels   uint16
+		sampleSize uint16
+	}{
+		{1, 44100, 2, 16},
+		{2, 96000, 6, 24},
+	} {
+		stsd := makeQuickTimeAudioStsd(tc.version, tc.rate, tc.channels, esds)
+
+		rate, channels, sampleSize, ok := parseAudioSampleEntry(stsd)
+		if !ok || rate != tc.rate || channels != tc.channels || sampleSize != tc.sampleSize {
+			t.Errorf("v%d: got %d Hz %d ch %d bits (ok=%v), want %d Hz %d ch %d bits",
+				tc.version, rate, channels, sampleSize, ok, tc.rate, tc.channels, tc.sampleSize)
+		}
+		if got := findSampleEntryBox(stsd, TrackTypeAudio, "esds"); !bytes.Equal(got, esds[8:]) {
+			t.Errorf("v%d: esds not located after the extended fields, got %x", tc.version, got)
+		}
+	}
+}
+
+func TestParseAudioStsdPopulatesTrack(t *testing.T) {
+	if _, err := (&Demuxer{}).ParseAudioStsd(make([]byte, 20)); err == nil {
+		t.Error("Expected an error for a truncated audio sample entry")
+	}
+
+	audio := syntheticTrack(TrackTypeAudio, 44100, 20, 1024, 50)
+	audio.Stsd = makeMp4aStsd(44100, 2, nil)
+	audio.Volume = 0x0080 // Half volume
+	tracks := []Track{audio}
+	src := writeSyntheticSource(t, tracks)
+
+	got := remuxAndDemux(t, src, tracks)
+	want := AudioInfo{SampleRate: 44100, ChannelCount: 2, SampleSize: 16}
+	if got[0].Audio != want {
+		t.Errorf("Expected %+v, got %+v", want, got[0].Audio)
+	}
+	if got[0].Volume != 0x0080 {
+		t.Errorf("Expected tkhd volume 0x0080, got %#04x", got[0].Volume)
+	}
+}
+
+// makeEsds builds an esds box around an AAC DecoderSpecificInfo, using the
+// 4-byte descriptor size form encoders such as ffmpeg write
+func makeEsds(objectType byte, config []byte) []byte {
+	descr := func(tag byte, body []byte) []byte {
+		n := len(body)
+		return append([]byte{tag, 0x80 | byte(n>>21&0x7F), 0x80 | byte(n>>14&0x7F), 0x80 | byte(n>>7&0x7F), byte(n & 0x7F)}, body...)
+	}
+	decConfig := append([]byte{objectType, 0x15, 0, 0, 0, 0, 1, 0xF4, 0, 0, 1, 0xF4, 0}, descr(0x05, config)...)
+	es := append([]byte{0, 1, 0x80, 0, 2}, descr(0x04, decConfig)...) // streamDependenceFlag set
+	es = append(es, descr(0x06, []byte{2})...)                        // SLConfigDescriptor
+	return makeBox("esds", append([]byte{0, 0, 0, 0}, descr(0x03, es)...))
+}
+
+func TestParseEsds(t *testing.T) {
+	asc := []byte{0x12, 0x10} // AAC-LC, 44.1kHz, stereo
+	stsd := makeMp4aStsd(44100, 2, makeEsds(0x40, asc))
+
+	config, err := (&Demuxer{}).ParseEsds(stsd)
+	if err != nil {
+		t.Fatalf("ParseEsds failed: %v", err)
+	}
+	if !bytes.Equal(config, asc) {
+		t.Errorf("Expected AudioSpecificConfig %x, got %x", asc, config)
+	}
+	objectType, _, _ := parseEsdsPayload(stsd)
+	aac := Track{Type: TrackTypeAudio, CodecTag: "mp4a", Audio: AudioInfo{ObjectType: objectType}}
+	if !aac.IsAAC() {
+		t.Errorf("Expected object type 0x40 to be AAC, got %#x", objectType)
+	}
+	if (Track{Type: TrackTypeAudio, CodecTag: "mp4a", Audio: AudioInfo{ObjectType: 0x6B}}).IsAAC() {
+		t.Error("MP3 in mp4a (0x6B) reported as AAC")
+	}
+
+	// QuickTime v1 entry: frma, esds and a terminator inside 'wave'
+	wave := makeBox("wave", append(append(makeBox("frma", []byte("mp4a")), makeEsds(0x40, asc)...), 0, 0, 0, 8, 0, 0, 0, 0))
+	if config, err := (&Demuxer{}).ParseEsds(makeQuickTimeAudioStsd(1, 44100, 2, wave)); err != nil || !bytes.Equal(config, asc) {
+		t.Errorf("Expected AudioSpecificConfig %x from the wave box, got %x (%v)", asc, config, err)
+	}
+
+	if _, err := (&Demuxer{}).ParseEsds(makeMp4aStsd(44100, 2, nil)); !errors.Is(err, ErrNoEsds) {
+		t.Errorf("Expected ErrNoEsds, got %v", err)
+	}
+	// Cut the box short: the descriptor sizes no longer fit
+	esds := makeEsds(0x40, asc)
+	binary.BigEndian.PutUint32(esds[0:4], uint32(len(esds)-4))
+	if _, err := (&Demuxer{}).ParseEsds(makeMp4aStsd(44100, 2, esds[:len(esds)-4])); !errors.Is(err, ErrTruncatedAtom) {
+		t.Errorf("Expected ErrTruncatedAtom, got %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// TrackConfig describes a track added to a FileBuilder
+type TrackConfig struct {
+	Type      TrackType
+	Timescale uint32
+	Stsd      []byte // Sample Description payload (version/flags, entry count, entries)
+	CodecTag  string // Informational, e.g. "avc1"
+
+	// Video only
+	Width  uint32
+	Height uint32
+}
+
+// FileBuilder assembles an MP4 from samples held in memory, e.g. frames
+// produced by a transcoder, without a source file on disk. Samples are
+// buffered and written through the Remuxer, so the output layout (moov
+// first, interleaved mdat) is the same as for a remux.
+type FileBuilder struct {
+	Options RemuxOptions
+
+	tracks []Track
+	data   bytes.Buffer
+}
+
+func NewFileBuilder() *FileBuilder {
+	return &FileBuilder{}
+}
+
+// AddTrack registers a track and returns its 1-based ID, which is both the
+// AppendSample key and the track_ID written to tkhd
+func (b *FileBuilder) AddTrack(cfg TrackConfig) (int, error) {
+	if cfg.Timescale == 0 {
+		return 0, fmt.Errorf("track %d: timescale must be non-zero", len(b.tracks)+1)
+	}
+	handler, mediaHeader, ok := builderHandler(cfg.Type)
+	if !ok {
+		return 0, fmt.Errorf("track %d: unsupported track type %q", len(b.tracks)+1, cfg.Type)
+	}
+	if len(cfg.Stsd) < 8 {
+		return 0, fmt.Errorf("track %d: stsd payload too short (%d bytes)", len(b.tracks)+1, len(cfg.Stsd))
+	}
+
+	id := len(b.tracks) + 1
+	t := Track{
+		ID:          id,
+		Type:        cfg.Type,
+		Timescale:   cfg.Timescale,
+		Stsd:        cfg.Stsd,
+		CodecTag:    cfg.CodecTag,
+		Hdlr:        handler,
+		MediaHeader: mediaHeader,
+	}
+	if cfg.Type == TrackTypeVideo {
+		t.Width, t.Height = cfg.Width, cfg.Height
+	}
+	b.tracks = append(b.tracks, t)
+	return id, nil
+}
+
+// AppendSample adds one sample, in decode order, to the track with the given ID
+func (b *FileBuilder) AppendSample(trackID int, data []byte, duration int64, keyframe bool) error {
+	if trackID < 1 || trackID > len(b.tracks) {
+		return fmt.Errorf("unknown track %d", trackID)
+	}
+	if duration < 0 {
+		return fmt.Errorf("track %d: negative sample duration %d", trackID, duration)
+	}
+	t := &b.tracks[trackID-1]
+
+	s := Sample{
+		ID:         len(t.Samples) + 1,
+		Offset:     int64(b.data.Len()),
+		Size:       int64(len(data)),
+		Duration:   duration,
+		IsKeyframe: keyframe,
+	}
+	if n := len(t.Samples); n > 0 {
+		s.Time = t.Samples[n-1].Time + t.Samples[n-1].Duration
+	}
+	b.data.Write(data)
+	t.Samples = append(t.Samples, s)
+	return nil
+}
+
+// Tracks returns the tracks built so far. Sample offsets refer to the
+// builder's internal buffer, not to the output file.
+func (b *FileBuilder) Tracks() []Track {
+	return b.tracks
+}
+
+// WriteFile writes the moov and mdat for everything appended so far
+func (b *FileBuilder) WriteFile(output string) error {
+	if len(b.tracks) == 0 {
+		return fmt.Errorf("no tracks added")
+	}
+	for _, t := range b.tracks {
+		if len(t.Samples) == 0 {
+			return fmt.Errorf("track %d has no samples", t.ID)
+		}
+	}
+
+	remuxer := &Remuxer{InputFile: bytes.NewReader(b.data.Bytes()), Options: b.Options}
+	return remuxer.WriteMultiTrackFile(output, b.tracks)
+}
+
+// builderHandler returns the hdlr and media header payloads for a built track
+func builderHandler(typ TrackType) (hdlr, mediaHeader []byte, ok bool) {
+	var name string
+	switch typ {
+	case TrackTypeVideo:
+		name = "VideoHandler"
+		mediaHeader = []byte{0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0} // vmhd: flags=1, graphicsmode/opcolor 0
+	case TrackTypeAudio:
+		name = "SoundHandler"
+		mediaHeader = []byte{0, 0, 0, 0, 0, 0, 0, 0} // smhd: balance 0
+	default:
+		return nil, nil, false
+	}
+
+	// Version/Flags(4) + pre_defined(4) + handler_type(4) + reserved(12) + name
+	hdlr = make([]byte, 24, 24+len(name)+1)
+	copy(hdlr[8:12], typ)
+	hdlr = append(hdlr, name...)
+	hdlr = append(hdlr, 0)
+	return hdlr, mediaHeader, true
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileBuilder(t *testing.T) {
+	b := NewFileBuilder()
+	video, err := b.AddTrack(TrackConfig{Type: TrackTypeVideo, Timescale: 30000, Stsd: makeAvc1Stsd(nil), CodecTag: "avc1", Width: 640, Height: 360})
+	if err != nil {
+		t.Fatal(err)
+	}
+	audio, err := b.AddTrack(TrackConfig{Type: TrackTypeAudio, Timescale: 48000, Stsd: makeMp4aStsd(48000, 2, nil)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.AddTrack(TrackConfig{Type: TrackTypeHint, Timescale: 90000, Stsd: make([]byte, 8)}); err == nil {
+		t.Error("Expected an error for an unsupported track type")
+	}
+	if err := b.AppendSample(3, []byte{1}, 1, true); err == nil {
+		t.Error("Expected an error for an unknown track ID")
+	}
+
+	for i := 0; i < 6; i++ {
+		if err := b.AppendSample(video, samplePattern(0, i, 100+int64(i)), 1001, i%3 == 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.AppendSample(audio, samplePattern(1, i, 20), 1024, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	outPath := filepath.Join(t.TempDir(), "built.mp4")
+	if err := b.WriteFile(outPath); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	out, err := os.Open(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	atoms, err := FastProbe(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moov := FindAtom(atoms, "moov")
+	if moov == nil {
+		t.Fatal("built file has no moov")
+	}
+	got, err := NewDemuxer(out).ExtractTracks(*moov)
+	if err != nil {
+		t.Fatalf("ExtractTracks failed: %v", err)
+	}
+	if len(got) != 2 || got[0].Type != TrackTypeVideo || got[1].Type != TrackTypeAudio {
+		t.Fatalf("Unexpected tracks: %+v", got)
+	}
+	if got[0].Width != 640 || got[0].Height != 360 || got[0].CodecTag != "avc1" {
+		t.Errorf("Video geometry/codec not preserved: %dx%d %q", got[0].Width, got[0].Height, got[0].CodecTag)
+	}
+	if got[1].Audio.SampleRate != 48000 || got[1].Audio.ChannelCount != 2 {
+		t.Errorf("Audio info not preserved: %+v", got[1].Audio)
+	}
+
+	for i, s := range got[0].Samples {
+		if s.IsKeyframe != (i%3 == 0) || s.Time != int64(i)*1001 {
+			t.Errorf("Video sample %d: keyframe=%v time=%d", i, s.IsKeyframe, s.Time)
+		}
+		buf := make([]byte, s.Size)
+		if _, err := out.ReadAt(buf, s.Offset); err != nil && err != io.EOF {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, samplePattern(0, i, 100+int64(i))) {
+			t.Errorf("Video sample %d bytes differ", i)
+		}
+	}
+}
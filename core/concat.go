@@ -0,0 +1,153 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Concat joins several MP4 files end-to-end by stream copy.
+// Tracks are matched by position; each joined track keeps the timescale of the
+// first input and later inputs are rescaled to it, so clips with differing
+// timescales can be stitched. Audio and video tracks must share the exact
+// sample description (codec, configuration, resolution); anything else would
+// need re-encoding and is rejected.
+func Concat(inputs []*os.File, output string) error {
+	if len(inputs) == 0 {
+		return fmt.Errorf("concat: no inputs")
+	}
+
+	var sets [][]Track
+	for i, f := range inputs {
+		atoms, err := FastProbe(f)
+		if err != nil {
+			return fmt.Errorf("concat: probing input %d: %w", i, err)
+		}
+		var moov *Atom
+		for j := range atoms {
+			if atoms[j].Type == "moov" {
+				moov = &atoms[j]
+				break
+			}
+		}
+		if moov == nil {
+			return fmt.Errorf("concat: input %d has no 'moov' atom", i)
+		}
+		tracks, err := NewDemuxer(f).ExtractTracks(*moov)
+		if err != nil {
+			return fmt.Errorf("concat: input %d: %w", i, err)
+		}
+		sets = append(sets, tracks)
+	}
+
+	joined, err := concatTracks(sets)
+	if err != nil {
+		return err
+	}
+
+	sources := make([]io.ReadSeeker, len(inputs))
+	for i, f := range inputs {
+		sources[i] = f
+	}
+	remuxer := &Remuxer{InputFile: inputs[0], Sources: sources}
+	return remuxer.WriteMultiTrackFile(output, joined)
+}
+
+// concatTracks stitches per-input track lists into one track list.
+// sets[i] holds the tracks of input i; Sample.Source is set to i.
+func concatTracks(sets [][]Track) ([]Track, error) {
+	if len(sets) == 0 {
+		return nil, fmt.Errorf("concat: no inputs")
+	}
+
+	base := sets[0]
+	joined := make([]Track, len(base))
+	for ti, t := range base {
+		joined[ti] = t
+		joined[ti].Samples = nil
+		joined[ti].CTSOffsets = nil
+		// The source edit lists describe a single clip's timeline
+		joined[ti].EditList = nil
+		joined[ti].MediaTimeOffset = 0
+		joined[ti].SourceTables = nil
+	}
+
+	for inputIdx, tracks := range sets {
+		if len(tracks) != len(base) {
+			return nil, fmt.Errorf("concat: input %d has %d tracks, expected %d", inputIdx, len(tracks), len(base))
+		}
+		for ti, t := range tracks {
+			dst := &joined[ti]
+			if t.Type != dst.Type {
+				return nil, fmt.Errorf("concat: input %d track %d is %s, expected %s", inputIdx, ti, t.Type, dst.Type)
+			}
+			if t.CodecTag != dst.CodecTag {
+				return nil, fmt.Errorf("concat: input %d track %d codec '%s' differs from '%s' (re-encoding required)", inputIdx, ti, t.CodecTag, dst.CodecTag)
+			}
+			if (t.Type == TrackTypeVideo || t.Type == TrackTypeAudio) && !bytes.Equal(t.Stsd, dst.Stsd) {
+				return nil, fmt.Errorf("concat: input %d track %d sample description differs from input 0 (codec configuration or resolution changed; re-encoding required)", inputIdx, ti)
+			}
+			appendRescaled(dst, t, inputIdx)
+		}
+	}
+
+	for ti := range joined {
+		total := uint64(0)
+		for _, s := range joined[ti].Samples {
+			total += uint64(s.Duration)
+		}
+		joined[ti].Duration = total
+	}
+
+	return joined, nil
+}
+
+// appendRescaled appends src's samples to dst, converting them to dst's
+// timescale and continuing dst's decode timeline.
+func appendRescaled(dst *Track, src Track, source int) {
+	start := int64(0)
+	if n := len(dst.Samples); n > 0 {
+		start = dst.Samples[n-1].Time + dst.Samples[n-1].Duration
+	}
+	if src.Timescale != dst.Timescale {
+		fmt.Printf("[Concat] Track %s: rescaling timescale %d -> %d\n", src.Type, src.Timescale, dst.Timescale)
+	}
+
+	hasCTS := len(dst.CTSOffsets) > 0 || len(src.CTSOffsets) > 0
+	if hasCTS && len(dst.CTSOffsets) < len(dst.Samples) {
+		// Earlier inputs had no B-frames: pad with zero offsets
+		dst.CTSOffsets = append(dst.CTSOffsets, make([]int32, len(dst.Samples)-len(dst.CTSOffsets))...)
+	}
+
+	for i, s := range src.Samples {
+		// Rescale both edges so rounding never accumulates across samples
+		begin := rescale(s.Time, src.Timescale, dst.Timescale)
+		end := rescale(s.Time+s.Duration, src.Timescale, dst.Timescale)
+
+		s.Time = start + begin
+		s.Duration = end - begin
+		s.Source = source
+		s.ID = len(dst.Samples) + 1
+		dst.Samples = append(dst.Samples, s)
+
+		if hasCTS {
+			off := int32(0)
+			if i < len(src.CTSOffsets) {
+				off = int32(rescale(int64(src.CTSOffsets[i]), src.Timescale, dst.Timescale))
+			}
+			dst.CTSOffsets = append(dst.CTSOffsets, off)
+		}
+	}
+}
+
+// rescale converts a signed time value between timescales via convertTime
+func rescale(val int64, fromScale, toScale uint32) int64 {
+	if fromScale == toScale {
+		return val
+	}
+	if val < 0 {
+		return -convertTime(uint64(-val), fromScale, toScale)
+	}
+	return convertTime(uint64(val), fromScale, toScale)
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConcatTracksRescalesTimescale(t *testing.T) {
+	first := syntheticTrack(TrackTypeVideo, 30000, 10, 1001, 100)
+	second := syntheticTrack(TrackTypeVideo, 90000, 10, 3003, 100)
+	first.CodecTag = "avc1"
+	second.CodecTag = "avc1"
+
+	joined, err := concatTracks([][]Track{{first}, {second}})
+	if err != nil {
+		t.Fatalf("concatTracks failed: %v", err)
+	}
+	tr := joined[0]
+	if tr.Timescale != 30000 {
+		t.Errorf("expected joined timescale 30000, got %d", tr.Timescale)
+	}
+	if len(tr.Samples) != 20 {
+		t.Fatalf("expected 20 samples, got %d", len(tr.Samples))
+	}
+	for i, s := range tr.Samples {
+		if s.Duration != 1001 {
+			t.Errorf("sample %d: expected duration 1001, got %d", i, s.Duration)
+		}
+		if s.Time != int64(i)*1001 {
+			t.Errorf("sample %d: expected time %d, got %d", i, int64(i)*1001, s.Time)
+		}
+	}
+	if tr.Samples[10].Source != 1 {
+		t.Errorf("expected second clip samples to reference source 1, got %d", tr.Samples[10].Source)
+	}
+	if tr.Duration != 20*1001 {
+		t.Errorf("expected duration %d, got %d", 20*1001, tr.Duration)
+	}
+}
+
+func TestConcatTracksRejectsCodecMismatch(t *testing.T) {
+	first := syntheticTrack(TrackTypeVideo, 30000, 2, 1001, 100)
+	second := syntheticTrack(TrackTypeVideo, 30000, 2, 1001, 100)
+	first.CodecTag = "avc1"
+	second.CodecTag = "hvc1"
+
+	if _, err := concatTracks([][]Track{{first}, {second}}); err == nil {
+		t.Fatal("expected codec mismatch error")
+	}
+}
+
+func TestConcatTracksRejectsStsdMismatch(t *testing.T) {
+	first := syntheticTrack(TrackTypeVideo, 30000, 2, 1001, 100)
+	second := syntheticTrack(TrackTypeVideo, 30000, 2, 1001, 100)
+	first.CodecTag, second.CodecTag = "avc1", "avc1"
+	first.Stsd = append([]byte{0, 0, 0, 0, 0, 0, 0, 1}, makeBox("avc1", make([]byte, 78))...)
+	second.Stsd = append([]byte{}, first.Stsd...)
+
+	if _, err := concatTracks([][]Track{{first}, {second}}); err != nil {
+		t.Fatalf("Expected identical sample descriptions to concat, got %v", err)
+	}
+
+	// Same codec, different width
+	second.Stsd[8+8+24+1] = 0x80
+	_, err := concatTracks([][]Track{{first}, {second}})
+	if err == nil || !strings.Contains(err.Error(), "re-encoding required") {
+		t.Fatalf("Expected a sample description mismatch error, got %v", err)
+	}
+}
@@ -2,13 +2,79 @@ package core
 
 import (
 	"fmt"
+	"io"
 	"math"
+	"sort"
 	"time"
 )
 
+// CutOptions tunes how cut points are chosen
+type CutOptions struct {
+	// VerifyKeyframes reads the first NAL of the snapped start sample and
+	// confirms it is an IDR/IRAP picture before trusting stss. Requires
+	// MultiTrackCutter.Source to be set.
+	VerifyKeyframes bool
+
+	// SnapWarnThreshold is how far the video start may move to reach a
+	// keyframe before a warning is logged. 0 means defaultSnapWarnThreshold.
+	SnapWarnThreshold time.Duration
+
+	// Logger receives the cutter's messages (nil = stdout). Use
+	// DiscardLogger to suppress them.
+	Logger Logger
+
+	// Tracks restricts which tracks are returned (nil = all of them), e.g.
+	// audio only or a silent video clip
+	Tracks *TrackFilter
+
+	// ByPresentationTime selects the cut boundaries by composition time
+	// (decode time plus CTS offset) instead of decode time, so the first and
+	// last displayed frames of B-frame content match the request. The slice
+	// still starts at a keyframe, and ends at the last sample in decode
+	// order that is displayed at or before the end; the edit list hides the
+	// frames before the requested start, so presentation begins exactly there.
+	ByPresentationTime bool
+}
+
+// TrackFilter selects tracks by type or ID. A track is kept when any of the
+// criteria matches it.
+type TrackFilter struct {
+	IncludeVideo    bool
+	IncludeAudio    bool
+	IncludeTrackIDs []int // Any track type, e.g. a timed metadata track
+}
+
+// Includes reports whether t passes the filter. A nil filter keeps every track.
+func (f *TrackFilter) Includes(t Track) bool {
+	if f == nil {
+		return true
+	}
+	if (f.IncludeVideo && t.Type == TrackTypeVideo) || (f.IncludeAudio && t.Type == TrackTypeAudio) {
+		return true
+	}
+	for _, id := range f.IncludeTrackIDs {
+		if id == t.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// Default keyframe-snap distance that triggers a warning
+const defaultSnapWarnThreshold = time.Millisecond
+
+func (o CutOptions) snapWarnThreshold() time.Duration {
+	if o.SnapWarnThreshold > 0 {
+		return o.SnapWarnThreshold
+	}
+	return defaultSnapWarnThreshold
+}
+
 // MultiTrackCutter handles slicing multiple tracks
 type MultiTrackCutter struct {
-	Tracks []Track
+	Tracks  []Track
+	Source  io.ReadSeeker // Optional: input file, used for keyframe verification
+	Options CutOptions
 }
 
 func NewMultiTrackCutter(tracks []Track) *MultiTrackCutter {
@@ -17,22 +83,78 @@ func NewMultiTrackCutter(tracks []Track) *MultiTrackCutter {
 
 // CutWithReport slices all tracks and returns cut reports with keyframe delta info
 func (c *MultiTrackCutter) CutWithReport(startTime, endTime time.Duration) ([]Track, []CutReport, error) {
+	log := loggerOr(c.Options.Logger)
 	var cutTracks []Track
 	var reports []CutReport
 
 	for _, track := range c.Tracks {
-		timescale := int64(track.Timescale)
-		if timescale == 0 {
-			timescale = 1000
+		if !c.Options.Tracks.Includes(track) {
+			continue
 		}
+		tc, ok := c.cutTrack(track, startTime, endTime, log)
+		if !ok {
+			continue
+		}
+		cutTracks = append(cutTracks, tc.Track)
+		reports = append(reports, tc.Report)
+	}
+
+	return cutTracks, reports, nil
+}
+
+// trackCut is one track's slice for a time range: the sliced track, its
+// report and the retained source sample range [Start, End]
+type trackCut struct {
+	Track      Track
+	Report     CutReport
+	Start, End int
+}
+
+// cutTrack slices one track to [startTime, endTime], snapping video starts to
+// keyframes. ok is false when the range selects no samples.
+func (c *MultiTrackCutter) cutTrack(track Track, startTime, endTime time.Duration, log Logger) (trackCut, bool) {
+	timescale := int64(track.Timescale)
+	if timescale == 0 {
+		timescale = 1000
+	}
+
+	// The window is in presentation time: media time minus the edit list
+	// offset (e.g. 1s of media skipped by the first edit). Decode times run
+	// behind composition times by the first sample's CTS offset, which the
+	// usual B-frame edit skips again, so that part of the offset is dropped
+	// when comparing decode times.
+	// Leading empty edits present the media that much later.
+	shift := track.MediaTimeOffset
+	if !c.Options.ByPresentationTime && shift > 0 && len(track.CTSOffsets) > 0 && track.CTSOffsets[0] > 0 {
+		shift -= min(int64(track.CTSOffsets[0]), shift)
+	}
+	shift -= track.emptyEditDelay()
+	startUnits := int64(startTime.Seconds()*float64(timescale)) + shift
+	endUnits := int64(endTime.Seconds()*float64(timescale)) + shift
 
-		startUnits := int64(startTime.Seconds() * float64(timescale))
-		endUnits := int64(endTime.Seconds() * float64(timescale))
+	startIdx := -1
+	endIdx := -1
 
-		startIdx := -1
-		endIdx := -1
+	// Boundaries are compared in decode time, or composition time in
+	// ByPresentationTime mode
+	timeOf := func(i int) int64 { return track.Samples[i].Time }
+	if c.Options.ByPresentationTime {
+		timeOf = func(i int) int64 { return compositionTime(track, i) }
+	}
 
-		// Find cut points
+	// Find cut points
+	if c.Options.ByPresentationTime {
+		// Composition order differs from decode order: scan every sample
+		for i, s := range track.Samples {
+			t := timeOf(i)
+			if t <= startUnits && (track.Type != TrackTypeVideo || s.IsKeyframe) {
+				startIdx = i
+			}
+			if t <= endUnits {
+				endIdx = i
+			}
+		}
+	} else {
 		for i, s := range track.Samples {
 			if s.Time <= startUnits {
 				if track.Type == TrackTypeVideo {
@@ -49,72 +171,371 @@ func (c *MultiTrackCutter) CutWithReport(startTime, endTime time.Duration) ([]Tr
 				break
 			}
 		}
+	}
+
+	// Fallbacks
+	if startIdx == -1 {
+		startIdx = 0
+	}
+
+	// Safe-mode: make sure the snapped start really is a random access point
+	keyframeCorrected := false
+	if track.Type == TrackTypeVideo && c.Options.VerifyKeyframes && c.Source != nil {
+		verifiedIdx := c.verifyKeyframe(track, startIdx)
+		if verifiedIdx != startIdx {
+			log.Printf("[Cutter] ⚠️  Track %s: sample %d is flagged as keyframe but is not IDR/IRAP; moved start back to sample %d\n",
+				track.Type, startIdx+1, verifiedIdx+1)
+			startIdx = verifiedIdx
+			keyframeCorrected = true
+		}
+	}
+	endClamped := false
+	if c.Options.ByPresentationTime {
+		// endIdx stays -1 (empty slice) when the end precedes every sample
+		last := int64(0)
+		for i, s := range track.Samples {
+			if end := timeOf(i) + s.Duration; end > last {
+				last = end
+			}
+		}
+		endClamped = len(track.Samples) > 0 && endUnits > last
+	} else if endIdx == -1 {
+		endIdx = len(track.Samples) - 1
+		if n := len(track.Samples); n > 0 {
+			last := track.Samples[n-1]
+			endClamped = endUnits > last.Time+last.Duration
+		}
+	}
+
+	// Slice samples
+	if startIdx > endIdx {
+		log.Printf("[Cutter] Track %s: Empty slice (Start %d > End %d)\n", track.Type, startIdx, endIdx)
+		return trackCut{}, false
+	}
+
+	cutSamples := track.Samples[startIdx : endIdx+1]
+	cutTrack := sliceTrack(track, startIdx, endIdx, startTime)
+
+	// Calculate actual times for the report
+	presentedStart := timeOf(startIdx)
+	if c.Options.ByPresentationTime && startUnits > presentedStart {
+		// The edit list skips the pre-roll frames up to the requested start
+		cutTrack.EditList, cutTrack.MediaTimeOffset = rebaseEditList(track, cutTrack, startTime, startUnits)
+		presentedStart = startUnits
+	}
+	actualStartSec := float64(presentedStart-shift) / float64(timescale)
+	actualEndSec := float64(timeOf(endIdx)-shift) / float64(timescale)
+	requestedStartSec := startTime.Seconds()
+	requestedEndSec := endTime.Seconds()
+
+	deltaStartMs := (actualStartSec - requestedStartSec) * 1000.0
+	deltaEndMs := (actualEndSec - requestedEndSec) * 1000.0
+
+	report := CutReport{
+		TrackType:         track.Type,
+		RequestedStart:    requestedStartSec,
+		ActualStart:       actualStartSec,
+		RequestedEnd:      requestedEndSec,
+		ActualEnd:         actualEndSec,
+		DeltaStartMs:      deltaStartMs,
+		DeltaEndMs:        deltaEndMs,
+		SamplesIncluded:   len(cutSamples),
+		KeyframeCorrected: keyframeCorrected,
+		EndClamped:        endClamped,
+	}
+
+	report.NetDuration = cutTrack.PresentationDuration()
+	report.EditOffset = cutTrack.MediaTimeOffset
+
+	// Print report with keyframe warning
+	thresholdMs := float64(c.Options.snapWarnThreshold()) / float64(time.Millisecond)
+	if track.Type == TrackTypeVideo && math.Abs(deltaStartMs) > thresholdMs {
+		log.Printf("[Cutter] ⚠️  Track %s: cut start snapped to keyframe!\n", track.Type)
+		log.Printf("         Requested: %.3fs → Actual: %.3fs (Δ %.1fms)\n", requestedStartSec, actualStartSec, deltaStartMs)
+	}
+	if endClamped {
+		log.Printf("[Cutter] ⚠️  Track %s: requested end %.3fs is past the end of the media; clamped to %.3fs\n",
+			track.Type, requestedEndSec, actualEndSec)
+	}
+	log.Printf("[Cutter] Track %s (TS %d): %d samples [%.3fs → %.3fs] (Δstart=%.1fms, Δend=%.1fms, net=%s)\n",
+		track.Type, track.Timescale, len(cutSamples),
+		actualStartSec, actualEndSec, deltaStartMs, deltaEndMs, report.NetDuration)
+
+	return trackCut{Track: cutTrack, Report: report, Start: startIdx, End: endIdx}, true
+}
+
+// compositionTime is the composition time of sample i: its decode time plus
+// its CTS offset (0 past the end of CTSOffsets)
+func compositionTime(track Track, i int) int64 {
+	t := track.Samples[i].Time
+	if i < len(track.CTSOffsets) {
+		t += int64(track.CTSOffsets[i])
+	}
+	return t
+}
 
-		// Fallbacks
-		if startIdx == -1 {
-			startIdx = 0
+// sliceTrack returns track restricted to samples [startIdx, endIdx], with the
+// CTS offsets sliced alongside. start is how much of the track's presentation
+// the slice cuts off (see rebaseEditList).
+func sliceTrack(track Track, startIdx, endIdx int, start time.Duration) Track {
+	cutTrack := track
+	cutTrack.Samples = track.Samples[startIdx : endIdx+1]
+	cutTrack.CTSOffsets = sliceCTSOffsets(track.CTSOffsets, startIdx, endIdx+1)
+	if len(track.EditList) > 0 {
+		cutTrack.EditList, cutTrack.MediaTimeOffset = rebaseEditList(track, cutTrack, start, 0)
+	}
+	return cutTrack
+}
+
+// sliceCTSOffsets returns the composition offsets of samples [start, end),
+// keeping CTSOffsets[i] aligned with Samples[i]: samples past the end of a
+// short offsets slice get 0 (PTS == DTS). Nil when the track has no offsets.
+func sliceCTSOffsets(offsets []int32, start, end int) []int32 {
+	if len(offsets) == 0 || start >= end {
+		return nil
+	}
+	if end <= len(offsets) {
+		return offsets[start:end]
+	}
+	out := make([]int32, end-start)
+	if start < len(offsets) {
+		copy(out, offsets[start:])
+	}
+	return out
+}
+
+// rebaseEditList rewrites the edit list of track for its cut slice, whose
+// media timeline now starts at the first retained sample. Leading empty edits
+// (an initial presentation delay, e.g. audio starting after video) become one
+// empty edit for what is left of the delay once the cut start (start, in the
+// track's presentation time) is cut away, and are dropped when the start is
+// past it. They are followed by a single edit whose MediaTime keeps
+// whatever part of the original initial shift still applies (e.g. a B-frame
+// composition delay) and whose duration, in the source movie timescale,
+// covers the trimmed media. presentFrom is a media time of the source track
+// before which nothing is presented (0 = no extra trim), e.g. the requested
+// start of a presentation-time cut whose slice begins at an earlier keyframe.
+func rebaseEditList(track, cut Track, start time.Duration, presentFrom int64) ([]EditListEntry, int64) {
+	if len(cut.Samples) == 0 {
+		return nil, 0
+	}
+	first := cut.Samples[0]
+
+	// Original shift measured from the new start (MediaTimeOffset is relative
+	// to the track's own first sample); never earlier than the first sample's
+	// composition time
+	mediaTime := track.MediaTimeOffset - (first.Time - track.Samples[0].Time)
+	if len(cut.CTSOffsets) > 0 && int64(cut.CTSOffsets[0]) > mediaTime {
+		mediaTime = int64(cut.CTSOffsets[0])
+	}
+	if skip := presentFrom - first.Time; skip > mediaTime {
+		mediaTime = skip
+	}
+	if mediaTime < 0 {
+		mediaTime = 0
+	}
+
+	movieScale := track.MovieTimescale
+	if movieScale == 0 {
+		movieScale = movieTimescale
+	}
+	avail := cut.MediaDuration() - mediaTime
+	if avail < 0 {
+		avail = 0
+	}
+
+	var edits []EditListEntry
+	if delay := emptyEditDuration(track.EditList); delay > 0 {
+		used := uint64(max(0, int64(start.Seconds()*float64(movieScale))))
+		if delay > used {
+			empty := track.EditList[0]
+			empty.SegmentDuration = delay - used
+			edits = append(edits, empty)
 		}
-		if endIdx == -1 {
-			endIdx = len(track.Samples) - 1
+	}
+
+	rateInt := int16(1)
+	for _, e := range track.EditList {
+		if e.MediaTime != -1 {
+			rateInt = e.MediaRateInt
+			break
 		}
+	}
+	return append(edits, EditListEntry{
+		SegmentDuration: uint64(convertTime(uint64(avail), track.Timescale, movieScale)),
+		MediaTime:       mediaTime,
+		MediaRateInt:    rateInt,
+	}), mediaTime
+}
+
+// CutByKeyframeRange cuts from the video track's startKeyframe-th keyframe up
+// to, but not including, its endKeyframe-th keyframe (0-based indices into
+// the keyframe list; endKeyframe may equal the keyframe count to cut to the
+// end). Other tracks keep the samples covering that time window: from the
+// sample playing at the start up to the last one starting before the end.
+// Boundaries are compared in exact integer time, so repeated cuts are
+// deterministic.
+func (c *MultiTrackCutter) CutByKeyframeRange(startKeyframe, endKeyframe int) ([]Track, []CutReport, error) {
+	log := loggerOr(c.Options.Logger)
 
-		// Slice samples
+	videoIdx := -1
+	for i := range c.Tracks {
+		if c.Tracks[i].Type == TrackTypeVideo {
+			videoIdx = i
+			break
+		}
+	}
+	if videoIdx < 0 {
+		return nil, nil, fmt.Errorf("keyframe range cut requires a video track")
+	}
+	video := c.Tracks[videoIdx]
+
+	var keyframes []int
+	for i, s := range video.Samples {
+		if s.IsKeyframe {
+			keyframes = append(keyframes, i)
+		}
+	}
+	if startKeyframe < 0 || endKeyframe > len(keyframes) || startKeyframe >= endKeyframe {
+		return nil, nil, fmt.Errorf("keyframe range [%d, %d) out of range (video has %d keyframes)", startKeyframe, endKeyframe, len(keyframes))
+	}
+
+	// Window in video timescale units: [winStart, winEnd)
+	vStartIdx := keyframes[startKeyframe]
+	vEndIdx := len(video.Samples) - 1
+	winStart := video.Samples[vStartIdx].Time
+	last := video.Samples[vEndIdx]
+	winEnd := last.Time + last.Duration
+	if endKeyframe < len(keyframes) {
+		vEndIdx = keyframes[endKeyframe] - 1
+		winEnd = video.Samples[keyframes[endKeyframe]].Time
+	}
+	vScale := int64(video.Timescale)
+	if vScale == 0 {
+		vScale = 1000
+	}
+	// Tracks are lined up in presentation time, after their empty edits
+	winStart += video.emptyEditDelay()
+	winEnd += video.emptyEditDelay()
+	start := unitsToDuration(winStart, vScale)
+
+	var cutTracks []Track
+	var reports []CutReport
+	for ti, track := range c.Tracks {
+		if !c.Options.Tracks.Includes(track) {
+			continue // The video track still defines the window when excluded
+		}
+		timescale := int64(track.Timescale)
+		if timescale == 0 {
+			timescale = 1000
+		}
+
+		startIdx, endIdx := vStartIdx, vEndIdx
+		if ti != videoIdx {
+			// Compared exactly across timescales
+			delay := track.emptyEditDelay()
+			startIdx, endIdx = 0, -1
+			for i, s := range track.Samples {
+				if compareTimes(s.Time+delay, timescale, winStart, vScale) <= 0 {
+					startIdx = i
+				}
+				if compareTimes(s.Time+delay, timescale, winEnd, vScale) < 0 {
+					endIdx = i
+				}
+			}
+		}
 		if startIdx > endIdx {
-			fmt.Printf("[Cutter] Track %s: Empty slice (Start %d > End %d)\n", track.Type, startIdx, endIdx)
+			log.Printf("[Cutter] Track %s: Empty slice (Start %d > End %d)\n", track.Type, startIdx, endIdx)
 			continue
 		}
 
-		cutSamples := track.Samples[startIdx : endIdx+1]
+		cutTrack := sliceTrack(track, startIdx, endIdx, start)
+		cutTracks = append(cutTracks, cutTrack)
 
-		// Calculate actual times for the report
-		actualStartSec := float64(track.Samples[startIdx].Time) / float64(timescale)
-		actualEndSec := float64(track.Samples[endIdx].Time) / float64(timescale)
-		requestedStartSec := startTime.Seconds()
-		requestedEndSec := endTime.Seconds()
+		requestedStart := float64(winStart) / float64(vScale)
+		requestedEnd := float64(winEnd) / float64(vScale)
+		delay := track.emptyEditDelay()
+		actualStart := float64(track.Samples[startIdx].Time+delay) / float64(timescale)
+		actualEnd := float64(track.Samples[endIdx].Time+delay) / float64(timescale)
+		reports = append(reports, CutReport{
+			TrackType:       track.Type,
+			RequestedStart:  requestedStart,
+			ActualStart:     actualStart,
+			RequestedEnd:    requestedEnd,
+			ActualEnd:       actualEnd,
+			DeltaStartMs:    (actualStart - requestedStart) * 1000.0,
+			DeltaEndMs:      (actualEnd - requestedEnd) * 1000.0,
+			SamplesIncluded: len(cutTrack.Samples),
+			NetDuration:     cutTrack.PresentationDuration(),
+			EditOffset:      cutTrack.MediaTimeOffset,
+		})
+		log.Printf("[Cutter] Track %s (TS %d): %d samples [%.3fs → %.3fs] (keyframes %d..%d)\n",
+			track.Type, track.Timescale, len(cutTrack.Samples), actualStart, actualEnd, startKeyframe, endKeyframe)
+	}
 
-		deltaStartMs := (actualStartSec - requestedStartSec) * 1000.0
-		deltaEndMs := (actualEndSec - requestedEndSec) * 1000.0
+	return cutTracks, reports, nil
+}
 
-		report := CutReport{
-			TrackType:       track.Type,
-			RequestedStart:  requestedStartSec,
-			ActualStart:     actualStartSec,
-			RequestedEnd:    requestedEndSec,
-			ActualEnd:       actualEndSec,
-			DeltaStartMs:    deltaStartMs,
-			DeltaEndMs:      deltaEndMs,
-			SamplesIncluded: len(cutSamples),
-		}
-		reports = append(reports, report)
-
-		// Also slice CTSOffsets if present
-		cutTrack := track
-		cutTrack.Samples = cutSamples
-		if len(track.CTSOffsets) > 0 && endIdx < len(track.CTSOffsets) {
-			cutTrack.CTSOffsets = track.CTSOffsets[startIdx : endIdx+1]
-		} else if len(track.CTSOffsets) > 0 {
-			// Partial: take what we can
-			end := endIdx + 1
-			if end > len(track.CTSOffsets) {
-				end = len(track.CTSOffsets)
-			}
-			if startIdx < end {
-				cutTrack.CTSOffsets = track.CTSOffsets[startIdx:end]
+// AutoTrim drops leading and trailing samples smaller than minSize bytes,
+// which for compressed audio usually means silence and for video a static or
+// black picture. It is only a heuristic: sample size is a rough proxy for
+// content and nothing is decoded, so quiet-but-real content may be trimmed and
+// noisy silence kept. Video starts are moved back to the previous keyframe so
+// the result stays decodable. Returns the trimmed track and how many samples
+// were dropped at each end.
+func AutoTrim(track Track, minSize int64) (Track, int, int) {
+	first := -1
+	last := -1
+	for i, s := range track.Samples {
+		if s.Size >= minSize {
+			if first == -1 {
+				first = i
 			}
+			last = i
 		}
-		cutTracks = append(cutTracks, cutTrack)
+	}
+	if first == -1 {
+		// Nothing above the threshold: leave the track untouched
+		return track, 0, 0
+	}
 
-		// Print report with keyframe warning
-		if track.Type == TrackTypeVideo && math.Abs(deltaStartMs) > 1.0 {
-			fmt.Printf("[Cutter] ⚠️  Track %s: Corte ajustado para keyframe!\n", track.Type)
-			fmt.Printf("         Solicitado: %.3fs → Real: %.3fs (Δ %.1fms)\n", requestedStartSec, actualStartSec, deltaStartMs)
+	if track.Type == TrackTypeVideo {
+		for first > 0 && !track.Samples[first].IsKeyframe {
+			first--
 		}
-		fmt.Printf("[Cutter] Track %s (TS %d): %d samples [%.3fs → %.3fs] (Δstart=%.1fms, Δend=%.1fms)\n",
-			track.Type, track.Timescale, len(cutSamples),
-			actualStartSec, actualEndSec, deltaStartMs, deltaEndMs)
 	}
 
-	return cutTracks, reports, nil
+	trimmed := track
+	trimmed.Samples = track.Samples[first : last+1]
+	trimmed.CTSOffsets = sliceCTSOffsets(track.CTSOffsets, first, last+1)
+
+	return trimmed, first, len(track.Samples) - 1 - last
+}
+
+// verifyKeyframe walks backward from startIdx to the nearest sample whose
+// bitstream actually starts with an IDR/IRAP picture. If the codec cannot be
+// inspected or no such sample exists, startIdx is returned unchanged.
+func (c *MultiTrackCutter) verifyKeyframe(track Track, startIdx int) int {
+	log := loggerOr(c.Options.Logger)
+	lengthSize := nalLengthPrefixSize(track.Stsd, track.CodecTag)
+	for i := startIdx; i >= 0; i-- {
+		ok, known, err := isRandomAccessSample(asReaderAt(c.Source), track.Samples[i], track.CodecTag, lengthSize)
+		if err != nil {
+			log.Printf("[Cutter] Warning: keyframe verification failed: %v\n", err)
+			return startIdx
+		}
+		if !known {
+			if i == startIdx {
+				return startIdx // Codec not inspectable, trust stss
+			}
+			continue
+		}
+		if ok {
+			return i
+		}
+	}
+	log.Printf("[Cutter] Warning: Track %s: no IDR/IRAP found before sample %d, keeping stss choice\n", track.Type, startIdx+1)
+	return startIdx
 }
 
 // Cut is the backward-compatible version without reports
@@ -122,3 +543,144 @@ func (c *MultiTrackCutter) Cut(startTime, endTime time.Duration) ([]Track, error
 	tracks, _, err := c.CutWithReport(startTime, endTime)
 	return tracks, err
 }
+
+// CutRanges keeps several time ranges of every track and joins them into one
+// continuous track each, e.g. to drop ad breaks. Ranges are sorted and
+// overlapping ones merged first; each range is cut like CutWithReport (video
+// starts snap back to a keyframe) and the later slices continue the decode
+// timeline of the earlier ones. A snapped start that reaches back into the
+// previous range just extends it, so no sample is written twice.
+//
+// Other tracks start each range where the video does, at its keyframe, so
+// audio keeps the pre-roll the video carries and the tracks stay in sync
+// across every join.
+func (c *MultiTrackCutter) CutRanges(ranges [][2]time.Duration) ([]Track, error) {
+	merged, err := mergeRanges(ranges)
+	if err != nil {
+		return nil, err
+	}
+	log := loggerOr(c.Options.Logger)
+	starts := c.videoRangeStarts(merged)
+
+	var joined []Track
+	for _, track := range c.Tracks {
+		if !c.Options.Tracks.Includes(track) {
+			continue
+		}
+
+		var out Track
+		var outStart time.Duration
+		lastEnd := -1
+		for ri, rg := range merged {
+			from := rg[0]
+			if track.Type != TrackTypeVideo && starts[ri] < from {
+				from = starts[ri]
+			}
+			tc, ok := c.cutTrack(track, from, rg[1], log)
+			if !ok || tc.End <= lastEnd {
+				continue
+			}
+			if lastEnd == -1 {
+				out, outStart = tc.Track, from
+				lastEnd = tc.End
+				continue
+			}
+
+			start := tc.Start
+			if start <= lastEnd {
+				start = lastEnd + 1 // Contiguous with the previous slice
+			}
+			appendSlice(&out, track, start, tc.End)
+			lastEnd = tc.End
+		}
+		if lastEnd == -1 {
+			continue
+		}
+		if len(track.EditList) > 0 {
+			out.EditList, out.MediaTimeOffset = rebaseEditList(track, out, outStart, 0)
+		}
+		joined = append(joined, out)
+	}
+
+	if len(joined) == 0 {
+		return nil, fmt.Errorf("cut ranges selected no samples")
+	}
+	return joined, nil
+}
+
+// videoRangeStarts returns where the first video track starts presenting each
+// range once snapped to a keyframe. Ranges keep their requested start when
+// there is no video (or it has no samples in the range).
+func (c *MultiTrackCutter) videoRangeStarts(ranges [][2]time.Duration) []time.Duration {
+	starts := make([]time.Duration, len(ranges))
+	for i, rg := range ranges {
+		starts[i] = rg[0]
+	}
+	for _, track := range c.Tracks {
+		if track.Type != TrackTypeVideo || !c.Options.Tracks.Includes(track) {
+			continue
+		}
+		for i, rg := range ranges {
+			if tc, ok := c.cutTrack(track, rg[0], rg[1], DiscardLogger); ok {
+				starts[i] = time.Duration(tc.Report.ActualStart * float64(time.Second))
+			}
+		}
+		break
+	}
+	return starts
+}
+
+// appendSlice appends source samples [start, end] of track to dst, moving
+// them so they follow dst's last sample on the decode timeline
+func appendSlice(dst *Track, track Track, start, end int) {
+	last := dst.Samples[len(dst.Samples)-1]
+	shift := last.Time + last.Duration - track.Samples[start].Time
+
+	// Samples may alias the source track: copy before appending
+	samples := make([]Sample, len(dst.Samples), len(dst.Samples)+end-start+1)
+	copy(samples, dst.Samples)
+	for _, s := range track.Samples[start : end+1] {
+		s.Time += shift
+		samples = append(samples, s)
+	}
+
+	if len(dst.CTSOffsets) > 0 || len(track.CTSOffsets) > 0 {
+		// Keep CTSOffsets[i] aligned with Samples[i]; missing offsets are 0
+		offsets := make([]int32, len(samples))
+		copy(offsets, dst.CTSOffsets)
+		copy(offsets[len(dst.Samples):], sliceCTSOffsets(track.CTSOffsets, start, end+1))
+		dst.CTSOffsets = offsets
+	}
+	dst.Samples = samples
+	// Joined samples no longer match the source tables
+	dst.SourceTables = nil
+}
+
+// mergeRanges validates ranges, sorts them by start and merges overlapping
+// or touching ones
+func mergeRanges(ranges [][2]time.Duration) ([][2]time.Duration, error) {
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no ranges to cut")
+	}
+	sorted := make([][2]time.Duration, len(ranges))
+	copy(sorted, ranges)
+	for _, rg := range sorted {
+		if rg[0] < 0 || rg[1] <= rg[0] {
+			return nil, fmt.Errorf("invalid range %s-%s", rg[0], rg[1])
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i][0] < sorted[j][0] })
+
+	merged := [][2]time.Duration{sorted[0]}
+	for _, rg := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if rg[0] <= last[1] {
+			if rg[1] > last[1] {
+				last[1] = rg[1]
+			}
+			continue
+		}
+		merged = append(merged, rg)
+	}
+	return merged, nil
+}
@@ -0,0 +1,681 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeNALSamples writes one length-prefixed H.264 NAL per sample with the
+// given NAL types and returns the file plus matching samples.
+func writeNALSamples(t *testing.T, nalTypes []byte) (*os.File, []Sample) {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "nal.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+
+	var samples []Sample
+	offset := int64(0)
+	for i, nt := range nalTypes {
+		payload := []byte{0x00, 0x00, 0x00, 0x04, 0x60 | nt, 0xAA, 0xBB, 0xCC}
+		if _, err := f.Write(payload); err != nil {
+			t.Fatal(err)
+		}
+		samples = append(samples, Sample{
+			ID:       i + 1,
+			Offset:   offset,
+			Size:     int64(len(payload)),
+			Time:     int64(i) * 1000,
+			Duration: 1000,
+		})
+		offset += int64(len(payload))
+	}
+	return f, samples
+}
+
+func TestCutVerifyKeyframesCorrectsLyingStss(t *testing.T) {
+	// Sample 0 is a real IDR (type 5); sample 3 is flagged by stss but is a P-slice (type 1)
+	f, samples := writeNALSamples(t, []byte{5, 1, 1, 1, 1, 1})
+	samples[0].IsKeyframe = true
+	samples[3].IsKeyframe = true
+
+	track := Track{Type: TrackTypeVideo, Timescale: 1000, CodecTag: "avc1", Samples: samples}
+	cutter := NewMultiTrackCutter([]Track{track})
+	cutter.Source = f
+	cutter.Options.VerifyKeyframes = true
+
+	cut, reports, err := cutter.CutWithReport(3500*time.Millisecond, 5*time.Second)
+	if err != nil {
+		t.Fatalf("CutWithReport failed: %v", err)
+	}
+	if got := cut[0].Samples[0].ID; got != 1 {
+		t.Errorf("Expected cut to start at real IDR sample 1, got sample %d", got)
+	}
+	if !reports[0].KeyframeCorrected {
+		t.Error("Expected report to flag the keyframe correction")
+	}
+
+	// Without verification the stss choice is trusted
+	cutter.Options.VerifyKeyframes = false
+	cut, _, _ = cutter.CutWithReport(3500*time.Millisecond, 5*time.Second)
+	if got := cut[0].Samples[0].ID; got != 4 {
+		t.Errorf("Expected unverified cut to start at sample 4, got sample %d", got)
+	}
+}
+
+func TestCutReportNetDuration(t *testing.T) {
+	track := syntheticTrack(TrackTypeAudio, 1000, 100, 100, 10)
+	cutter := NewMultiTrackCutter([]Track{track})
+
+	_, reports, err := cutter.CutWithReport(2*time.Second, 4*time.Second)
+	if err != nil {
+		t.Fatalf("CutWithReport failed: %v", err)
+	}
+	// Samples at 2.0s..4.0s inclusive: 21 samples of 100ms
+	if got := reports[0].NetDuration; got != 2100*time.Millisecond {
+		t.Errorf("Expected net duration 2.1s, got %s", got)
+	}
+}
+
+func TestCutRebasesEditList(t *testing.T) {
+	// Audio with 1024 units of priming, video with a 2-frame B-frame delay
+	audio := syntheticTrack(TrackTypeAudio, 48000, 470, 1024, 10)
+	audio.EditList = []EditListEntry{{SegmentDuration: 10000, MediaTime: 1024, MediaRateInt: 1}}
+	audio.MediaTimeOffset = 1024
+	audio.MovieTimescale = 1000
+
+	video := syntheticTrack(TrackTypeVideo, 30000, 300, 1001, 100)
+	video.CTSOffsets = make([]int32, 300)
+	for i := range video.CTSOffsets {
+		video.CTSOffsets[i] = 2002
+	}
+	video.EditList = []EditListEntry{{SegmentDuration: 10010, MediaTime: 2002, MediaRateInt: 1}}
+	video.MediaTimeOffset = 2002
+	video.MovieTimescale = 1000
+
+	cutter := NewMultiTrackCutter([]Track{video, audio})
+	cutter.Options.Logger = DiscardLogger
+
+	cut, reports, err := cutter.CutWithReport(0, 2*time.Second)
+	if err != nil {
+		t.Fatalf("CutWithReport failed: %v", err)
+	}
+	// From the start: the window is mapped past the edit offsets, so the
+	// fully hidden priming frame is skipped while the composition delay of
+	// the first video frame still applies
+	if reports[0].EditOffset != 2002 || reports[1].EditOffset != 0 {
+		t.Errorf("Expected edit offsets 2002/0 for a cut at 0, got %d/%d", reports[0].EditOffset, reports[1].EditOffset)
+	}
+	if first := cut[1].Samples[0].Time; first != 1024 {
+		t.Errorf("Expected audio to start at the first presented sample (1024), got %d", first)
+	}
+
+	cut, reports, err = cutter.CutWithReport(5*time.Second, 7*time.Second)
+	if err != nil {
+		t.Fatalf("CutWithReport failed: %v", err)
+	}
+	// Mid-file: the priming no longer applies, the composition delay does
+	if reports[0].EditOffset != 2002 || reports[1].EditOffset != 0 {
+		t.Errorf("Expected edit offsets 2002/0 for a mid-file cut, got %d/%d", reports[0].EditOffset, reports[1].EditOffset)
+	}
+	for i, tr := range cut {
+		if len(tr.EditList) != 1 || tr.EditList[0].MediaTime != tr.MediaTimeOffset {
+			t.Fatalf("track %d: expected one edit at the new offset, got %+v", i, tr.EditList)
+		}
+		want := uint64((tr.MediaDuration() - tr.MediaTimeOffset) * 1000 / int64(tr.Timescale))
+		if got := tr.EditList[0].SegmentDuration; got != want {
+			t.Errorf("track %d: expected segment duration %d ms, got %d", i, want, got)
+		}
+	}
+}
+
+func TestRebaseEditListWithNonZeroFirstSample(t *testing.T) {
+	// Fragmented audio whose decode times start at 10s (tfdt), 1024 units
+	// of priming relative to the first sample
+	audio := syntheticTrack(TrackTypeAudio, 48000, 100, 1024, 10)
+	for i := range audio.Samples {
+		audio.Samples[i].Time += 480000
+	}
+	audio.EditList = []EditListEntry{{SegmentDuration: 2000, MediaTime: 1024, MediaRateInt: 1}}
+	audio.MediaTimeOffset = 1024
+	audio.MovieTimescale = 1000
+
+	if cut := sliceTrack(audio, 0, 49, 0); cut.MediaTimeOffset != 1024 {
+		t.Errorf("Expected the priming kept when cutting from the first sample, got %d", cut.MediaTimeOffset)
+	}
+	if cut := sliceTrack(audio, 1, 49, 0); cut.MediaTimeOffset != 0 {
+		t.Errorf("Expected no offset once the priming sample is dropped, got %d", cut.MediaTimeOffset)
+	}
+}
+
+func TestCutKeepsLeadingEmptyEdit(t *testing.T) {
+	// Audio presented 500ms after the video via an empty edit
+	audio := syntheticTrack(TrackTypeAudio, 48000, 470, 1024, 10)
+	audio.EditList = []EditListEntry{
+		{SegmentDuration: 500, MediaTime: -1, MediaRateInt: 1},
+		{SegmentDuration: 10000, MediaTime: 0, MediaRateInt: 1},
+	}
+	audio.MovieTimescale = 1000
+	video := syntheticTrack(TrackTypeVideo, 30000, 300, 1001, 100)
+
+	// Past the delay: the audio presented at 2s is media time 1.5s and
+	// nothing is left to delay
+	cutter := NewMultiTrackCutter([]Track{video, audio})
+	cutter.Options.Logger = DiscardLogger
+	cut, reports, err := cutter.CutWithReport(2*time.Second, 4*time.Second)
+	if err != nil {
+		t.Fatalf("CutWithReport failed: %v", err)
+	}
+	if first := cut[1].Samples[0].Time; first > 72000 || first <= 72000-1024 {
+		t.Errorf("Expected the audio to start at media time 1.5s, got %d", first)
+	}
+	if d := reports[1].DeltaStartMs; d > 0 || d < -1024.0/48 {
+		t.Errorf("Expected the audio start within a frame of 2s, got Δ %.1fms", d)
+	}
+	if edits := cut[1].EditList; len(edits) != 1 || edits[0].MediaTime != 0 {
+		t.Fatalf("Expected the used-up empty edit to be dropped, got %+v", edits)
+	}
+
+	// Inside the delay: the audio keeps its first samples and what is left
+	// of the delay
+	cut, _, err = cutter.CutWithReport(200*time.Millisecond, 4*time.Second)
+	if err != nil {
+		t.Fatalf("CutWithReport failed: %v", err)
+	}
+	if first := cut[1].Samples[0].ID; first != 1 {
+		t.Errorf("Expected the audio to start at its first sample, got %d", first)
+	}
+	edits := cut[1].EditList
+	if len(edits) != 2 || edits[0].MediaTime != -1 || edits[0].SegmentDuration != 300 || edits[1].MediaTime != 0 {
+		t.Fatalf("Expected a 300ms empty edit followed by the media edit, got %+v", edits)
+	}
+
+	src := writeSyntheticSource(t, cut)
+	got := remuxAndDemux(t, src, cut)
+	edits = got[1].EditList
+	if len(edits) != 2 || edits[0].MediaTime != -1 || edits[0].SegmentDuration != 300 {
+		t.Fatalf("Empty edit lost on remux, got %+v", edits)
+	}
+	if got[1].MediaTimeOffset != 0 || len(got[0].EditList) != 0 {
+		t.Errorf("Unexpected offsets after remux: audio %d, video edits %+v", got[1].MediaTimeOffset, got[0].EditList)
+	}
+	if dur, _ := got[1].EditedDuration(1000); dur != 300+cut[1].MediaDuration()*1000/48000 {
+		t.Errorf("Expected the delay in the track duration, got %d ms", dur)
+	}
+}
+
+func TestCutMapsWindowThroughEditOffset(t *testing.T) {
+	// The first edit skips 1s of media: media time 3s is presented at 2s
+	track := syntheticTrack(TrackTypeAudio, 1000, 100, 100, 10)
+	track.EditList = []EditListEntry{{SegmentDuration: 9000, MediaTime: 1000, MediaRateInt: 1}}
+	track.MediaTimeOffset = 1000
+	track.MovieTimescale = 1000
+
+	cutter := NewMultiTrackCutter([]Track{track})
+	cutter.Options.Logger = DiscardLogger
+	cut, reports, err := cutter.CutWithReport(2*time.Second, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := cut[0]
+	if first, last := got.Samples[0].Time, got.Samples[len(got.Samples)-1].Time; first != 3000 || last != 4000 {
+		t.Errorf("Expected media 3000-4000, got %d-%d", first, last)
+	}
+	if reports[0].ActualStart != 2 || reports[0].DeltaStartMs != 0 {
+		t.Errorf("Expected the visible start at 2s with no delta, got %vs (Δ %vms)", reports[0].ActualStart, reports[0].DeltaStartMs)
+	}
+	if got.MediaTimeOffset != 0 {
+		t.Errorf("Expected the offset to be consumed by the cut, got %d", got.MediaTimeOffset)
+	}
+}
+
+func TestCutBFrameVideoThroughEditOffset(t *testing.T) {
+	// B-frames delay composition by 2 frames and the edit skips that delay
+	// again: decode time and presentation time line up
+	track := syntheticTrack(TrackTypeVideo, 30000, 30, 1001, 100)
+	track.CTSOffsets = make([]int32, len(track.Samples))
+	for i := range track.CTSOffsets {
+		track.CTSOffsets[i] = 2002
+	}
+	track.EditList = []EditListEntry{{SegmentDuration: 1000, MediaTime: 2002, MediaRateInt: 1}}
+	track.MediaTimeOffset = 2002
+	track.MovieTimescale = 1000
+
+	cutter := NewMultiTrackCutter([]Track{track})
+	cutter.Options.Logger = DiscardLogger
+	cut, reports, err := cutter.CutWithReport(300*time.Millisecond, 600*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keyframes every 5 frames: the one presented at 0.1668s covers 0.3s
+	if first := cut[0].Samples[0].ID; first != 6 {
+		t.Errorf("Expected the cut to start at sample 6, got %d", first)
+	}
+	want := 5 * 1001.0 / 30000
+	if d := reports[0].ActualStart - want; d > 1e-9 || d < -1e-9 {
+		t.Errorf("Expected ActualStart %.4fs, got %.4fs", want, reports[0].ActualStart)
+	}
+}
+
+func TestCutReportEndClamped(t *testing.T) {
+	// 10s of media: samples every 100ms
+	track := syntheticTrack(TrackTypeAudio, 1000, 100, 100, 10)
+	cutter := NewMultiTrackCutter([]Track{track})
+
+	cut, reports, err := cutter.CutWithReport(8*time.Second, 30*time.Second)
+	if err != nil {
+		t.Fatalf("CutWithReport failed: %v", err)
+	}
+	if !reports[0].EndClamped {
+		t.Error("Expected EndClamped for an end past the media")
+	}
+	if got := len(cut[0].Samples); got != 20 {
+		t.Errorf("Expected cut to run to the last sample (20 samples), got %d", got)
+	}
+
+	_, reports, _ = cutter.CutWithReport(2*time.Second, 4*time.Second)
+	if reports[0].EndClamped {
+		t.Error("Expected no EndClamped for an end inside the media")
+	}
+}
+
+func TestCutByKeyframeRange(t *testing.T) {
+	// Keyframes every 5 frames at 30000/1001 fps
+	tracks := []Track{
+		syntheticTrack(TrackTypeVideo, 30000, 30, 1001, 300),
+		syntheticTrack(TrackTypeAudio, 48000, 60, 1024, 40),
+	}
+	cutter := NewMultiTrackCutter(tracks)
+	cutter.Options.Logger = DiscardLogger
+
+	cut, reports, err := cutter.CutByKeyframeRange(1, 3)
+	if err != nil {
+		t.Fatalf("CutByKeyframeRange failed: %v", err)
+	}
+	if len(cut) != 2 || len(reports) != 2 {
+		t.Fatalf("Expected 2 tracks and reports, got %d / %d", len(cut), len(reports))
+	}
+	video := cut[0].Samples
+	if len(video) != 10 || video[0].ID != 6 || !video[0].IsKeyframe {
+		t.Errorf("Expected video samples 6..15 starting on a keyframe, got %d starting at ID %d", len(video), video[0].ID)
+	}
+	// Window [5005, 15015)/30000 = [8008, 24024)/48000: audio samples at 7168..23552
+	audio := cut[1].Samples
+	if len(audio) != 17 || audio[0].Time != 7168 || audio[len(audio)-1].Time != 23552 {
+		t.Errorf("Unexpected audio range: %d samples [%d, %d]", len(audio), audio[0].Time, audio[len(audio)-1].Time)
+	}
+
+	// The last keyframe index runs to the end
+	cut, _, err = cutter.CutByKeyframeRange(5, 6)
+	if err != nil {
+		t.Fatalf("CutByKeyframeRange to end failed: %v", err)
+	}
+	if got := len(cut[0].Samples); got != 5 {
+		t.Errorf("Expected 5 trailing video samples, got %d", got)
+	}
+
+	for _, r := range [][2]int{{-1, 2}, {2, 2}, {3, 1}, {0, 7}} {
+		if _, _, err := cutter.CutByKeyframeRange(r[0], r[1]); err == nil {
+			t.Errorf("Expected error for keyframe range %v", r)
+		}
+	}
+}
+
+func TestCutByKeyframeRangeHighTimescale(t *testing.T) {
+	// ~51h into 10 MHz video and 5 MHz audio: time*timescale passes 2^63
+	// inside the window
+	video := syntheticTrack(TrackTypeVideo, 10_000_000, 30, 400_000, 300)
+	audio := syntheticTrack(TrackTypeAudio, 5_000_000, 60, 100_000, 40)
+	for i := range video.Samples {
+		video.Samples[i].Time += 184467 * 10_000_000
+	}
+	for i := range audio.Samples {
+		audio.Samples[i].Time += 184467 * 5_000_000
+	}
+	cutter := NewMultiTrackCutter([]Track{video, audio})
+	cutter.Options.Logger = DiscardLogger
+
+	// Window [0.2s, 0.6s) past that mark: audio samples 11..30
+	cut, _, err := cutter.CutByKeyframeRange(1, 3)
+	if err != nil {
+		t.Fatalf("CutByKeyframeRange failed: %v", err)
+	}
+	a := cut[1].Samples
+	if len(a) != 20 || a[0].ID != 11 || a[len(a)-1].ID != 30 {
+		t.Errorf("Unexpected audio range: %d samples [%d, %d]", len(a), a[0].ID, a[len(a)-1].ID)
+	}
+}
+
+func TestAutoTrim(t *testing.T) {
+	track := syntheticTrack(TrackTypeAudio, 1000, 10, 100, 0)
+	sizes := []int64{2, 3, 2, 50, 60, 55, 4, 58, 1, 2}
+	for i := range track.Samples {
+		track.Samples[i].Size = sizes[i]
+	}
+
+	trimmed, leading, trailing := AutoTrim(track, 10)
+	if leading != 3 || trailing != 2 {
+		t.Errorf("Expected 3 leading / 2 trailing trimmed, got %d / %d", leading, trailing)
+	}
+	if len(trimmed.Samples) != 5 || trimmed.Samples[0].ID != 4 {
+		t.Errorf("Unexpected trimmed samples: %d starting at ID %d", len(trimmed.Samples), trimmed.Samples[0].ID)
+	}
+}
+
+// recordingLogger captures formatted messages for assertions
+type recordingLogger struct{ lines []string }
+
+func (l *recordingLogger) Printf(format string, v ...any) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestCutSnapWarnThreshold(t *testing.T) {
+	// Keyframes every 5 frames at 30 fps: starting at 0.1s snaps back 100ms
+	track := syntheticTrack(TrackTypeVideo, 30000, 30, 1001, 100)
+	snapped := func(opts CutOptions) bool {
+		log := &recordingLogger{}
+		opts.Logger = log
+		cutter := NewMultiTrackCutter([]Track{track})
+		cutter.Options = opts
+		if _, err := cutter.Cut(100*time.Millisecond, 500*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range log.lines {
+			if strings.Contains(line, "snapped to keyframe") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !snapped(CutOptions{}) {
+		t.Error("Expected snap warning with the default threshold")
+	}
+	if snapped(CutOptions{SnapWarnThreshold: 200 * time.Millisecond}) {
+		t.Error("Expected no snap warning below a 200ms threshold")
+	}
+}
+
+func TestCutTrackFilter(t *testing.T) {
+	video := syntheticTrack(TrackTypeVideo, 30000, 60, 1001, 300)
+	video.ID = 1
+	audio := syntheticTrack(TrackTypeAudio, 48000, 90, 1024, 40)
+	audio.ID = 2
+	meta := syntheticTrack(TrackTypeMeta, 1000, 4, 500, 20)
+	meta.ID = 3
+	tracks := []Track{video, audio, meta}
+
+	cutter := NewMultiTrackCutter(tracks)
+	cutter.Options.Logger = DiscardLogger
+	for _, tc := range []struct {
+		filter *TrackFilter
+		want   []TrackType
+	}{
+		{nil, []TrackType{TrackTypeVideo, TrackTypeAudio, TrackTypeMeta}},
+		{&TrackFilter{IncludeAudio: true}, []TrackType{TrackTypeAudio}},
+		{&TrackFilter{IncludeVideo: true, IncludeTrackIDs: []int{3}}, []TrackType{TrackTypeVideo, TrackTypeMeta}},
+	} {
+		cutter.Options.Tracks = tc.filter
+		cut, reports, err := cutter.CutWithReport(0, time.Second)
+		if err != nil {
+			t.Fatalf("CutWithReport failed: %v", err)
+		}
+		var got []TrackType
+		for _, tr := range cut {
+			got = append(got, tr.Type)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) || len(reports) != len(tc.want) {
+			t.Errorf("filter %+v: got tracks %v (%d reports), want %v", tc.filter, got, len(reports), tc.want)
+		}
+	}
+
+	// Audio only output: renumbered from 1, with mvhd next_track_ID after it
+	cutter.Options.Tracks = &TrackFilter{IncludeAudio: true}
+	cut, _, _ := cutter.CutWithReport(0, time.Second)
+	src := writeSyntheticSource(t, tracks)
+	outPath := filepath.Join(t.TempDir(), "audio.mp4")
+	if err := (&Remuxer{InputFile: src}).WriteMultiTrackFile(outPath, cut); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.Open(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	atoms, err := FastProbe(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moov := FindAtom(atoms, "moov")
+	got, err := NewDemuxer(out).ExtractTracks(*moov)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != 1 || got[0].Type != TrackTypeAudio {
+		t.Fatalf("Expected a single audio track with ID 1, got %d tracks", len(got))
+	}
+	mvhd := NewDemuxer(out).readPayload(findChildPath(*moov, "mvhd"))
+	if next := binary.BigEndian.Uint32(mvhd[len(mvhd)-4:]); next != 2 {
+		t.Errorf("Expected mvhd next_track_ID 2, got %d", next)
+	}
+}
+
+func TestSliceTrackKeepsCTSAligned(t *testing.T) {
+	track := Track{Type: TrackTypeVideo, Timescale: 30000}
+	for i := 0; i < 10; i++ {
+		track.Samples = append(track.Samples, Sample{ID: i + 1, Time: int64(i) * 1001, Duration: 1001, IsKeyframe: i%4 == 0})
+	}
+	// Offsets only cover the first 6 samples
+	track.CTSOffsets = []int32{0, 1, 2, 3, 4, 5}
+
+	cut := sliceTrack(track, 4, 8, 0)
+	if len(cut.CTSOffsets) != len(cut.Samples) {
+		t.Fatalf("Expected %d CTS offsets, got %d", len(cut.Samples), len(cut.CTSOffsets))
+	}
+	for i, want := range []int32{4, 5, 0, 0, 0} {
+		if cut.CTSOffsets[i] != want {
+			t.Errorf("Offset %d (sample %d): got %d, want %d", i, cut.Samples[i].ID, cut.CTSOffsets[i], want)
+		}
+	}
+
+	trimmed, _, _ := AutoTrim(Track{Type: TrackTypeAudio, Samples: []Sample{{Size: 1}, {Size: 9}, {Size: 9}}, CTSOffsets: []int32{7, 8}}, 5)
+	if len(trimmed.CTSOffsets) != 2 || trimmed.CTSOffsets[0] != 8 || trimmed.CTSOffsets[1] != 0 {
+		t.Errorf("AutoTrim misaligned CTS offsets: %v", trimmed.CTSOffsets)
+	}
+}
+
+func TestCutRanges(t *testing.T) {
+	// 30 fps, keyframe every 5 samples (~167ms); 48kHz audio in 1024-sample frames
+	video := syntheticTrack(TrackTypeVideo, 30000, 300, 1001, 100)
+	video.ID = 1
+	video.CTSOffsets = make([]int32, 300)
+	for i := range video.CTSOffsets {
+		video.CTSOffsets[i] = int32(i)
+	}
+	audio := syntheticTrack(TrackTypeAudio, 48000, 470, 1024, 10)
+	audio.ID = 2
+	cutter := NewMultiTrackCutter([]Track{video, audio})
+	cutter.Options.Logger = &recordingLogger{}
+
+	// Out of order and overlapping: merges to [1s, 3s] and [6s, 8s]
+	cut, err := cutter.CutRanges([][2]time.Duration{
+		{6 * time.Second, 8 * time.Second},
+		{1 * time.Second, 2 * time.Second},
+		{1500 * time.Millisecond, 3 * time.Second},
+	})
+	if err != nil {
+		t.Fatalf("CutRanges failed: %v", err)
+	}
+	if len(cut) != 2 {
+		t.Fatalf("Expected 2 tracks, got %d", len(cut))
+	}
+
+	v := cut[0]
+	if len(v.CTSOffsets) != len(v.Samples) {
+		t.Fatalf("CTS offsets misaligned: %d offsets for %d samples", len(v.CTSOffsets), len(v.Samples))
+	}
+	gap := -1
+	for i := 1; i < len(v.Samples); i++ {
+		prev, s := v.Samples[i-1], v.Samples[i]
+		if s.Time != prev.Time+prev.Duration {
+			t.Fatalf("Sample %d: decode time %d does not continue %d", i, s.Time, prev.Time+prev.Duration)
+		}
+		if s.ID != prev.ID+1 {
+			if gap != -1 {
+				t.Fatalf("Expected one join, found another at %d", i)
+			}
+			gap = i
+		}
+		if v.CTSOffsets[i] != int32(s.ID-1) {
+			t.Errorf("Sample %d: CTS offset %d does not belong to source sample %d", i, v.CTSOffsets[i], s.ID)
+		}
+	}
+	if gap == -1 || !v.Samples[0].IsKeyframe || !v.Samples[gap].IsKeyframe {
+		t.Errorf("Expected both slices to start on keyframes (join at %d)", gap)
+	}
+	if first, second := v.Samples[0].ID, v.Samples[gap].ID; first > 31 || second > 181 || second < 170 {
+		t.Errorf("Unexpected slice starts: samples %d and %d", first, second)
+	}
+
+	// Audio starts each slice with the video's keyframe, not the requested
+	// time: the join point is the same in both tracks, within one frame
+	a := cut[1]
+	for i := 1; i < len(a.Samples); i++ {
+		if a.Samples[i].ID == a.Samples[i-1].ID+1 {
+			continue
+		}
+		for _, pair := range [][2]float64{
+			{float64(v.Samples[0].Time) / 30000, float64(a.Samples[0].Time) / 48000},
+			{float64(v.Samples[gap].ID-1) * 1001 / 30000, float64(a.Samples[i].ID-1) * 1024 / 48000},
+			{float64(v.Samples[gap].Time) / 30000, float64(a.Samples[i].Time) / 48000},
+		} {
+			if d := pair[1] - pair[0]; d < -1024.0/48000 || d > 1024.0/48000 {
+				t.Errorf("Audio slice starts %.3fs from the video (%.3fs vs %.3fs)", d, pair[1], pair[0])
+			}
+		}
+	}
+
+	// Touching ranges are one range; invalid ones are rejected
+	if _, err := cutter.CutRanges([][2]time.Duration{{2 * time.Second, time.Second}}); err == nil {
+		t.Error("Expected an error for an inverted range")
+	}
+	touching, _ := cutter.CutRanges([][2]time.Duration{{0, time.Second}, {time.Second, 2 * time.Second}})
+	single, _ := cutter.Cut(0, 2*time.Second)
+	if len(touching[0].Samples) != len(single[0].Samples) {
+		t.Errorf("Touching ranges: %d samples, single cut: %d", len(touching[0].Samples), len(single[0].Samples))
+	}
+}
+
+func TestHEVCCutAndRemux(t *testing.T) {
+	// hvcC with lengthSizeMinusOne = 1: samples use 2-byte NAL length prefixes
+	hvcC := make([]byte, 23)
+	hvcC[0] = 1
+	hvcC[21] = 0xFC | 1
+	fields := make([]byte, visualSampleEntrySize-8)
+	stsd := append([]byte{0, 0, 0, 0, 0, 0, 0, 1}, makeBox("hvc1", append(fields, makeBox("hvcC", hvcC)...))...)
+
+	// NAL types: IDR_W_RADL (19), TRAIL_R (1) x3, then one flagged by stss that is TRAIL_R
+	nalTypes := []byte{19, 1, 1, 1, 1, 1}
+	f, err := os.CreateTemp(t.TempDir(), "hevc.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var samples []Sample
+	for i, nt := range nalTypes {
+		payload := []byte{0x00, 0x04, nt << 1, 0x01, 0xAA, 0xBB}
+		f.Write(payload)
+		samples = append(samples, Sample{ID: i + 1, Offset: int64(i * len(payload)), Size: int64(len(payload)), Time: int64(i) * 1000, Duration: 1000})
+	}
+	samples[0].IsKeyframe = true
+	samples[3].IsKeyframe = true
+
+	track := Track{Type: TrackTypeVideo, Timescale: 1000, CodecTag: "hvc1", Stsd: stsd, Hdlr: makeHdlr("vide"), Samples: samples}
+	if !track.IsHEVC() || (Track{CodecTag: "avc1", Type: TrackTypeVideo}).IsHEVC() {
+		t.Fatal("IsHEVC misclassifies codec tags")
+	}
+	if got := nalLengthPrefixSize(stsd, "hvc1"); got != 2 {
+		t.Fatalf("Expected a 2-byte NAL length prefix from hvcC, got %d", got)
+	}
+
+	cutter := NewMultiTrackCutter([]Track{track})
+	cutter.Source = f
+	cutter.Options.VerifyKeyframes = true
+	cutter.Options.Logger = DiscardLogger
+	cut, err := cutter.Cut(3500*time.Millisecond, 6*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cut[0].Samples[0].ID != 1 {
+		t.Fatalf("Expected verification to move the start to the IRAP sample 1, got %d", cut[0].Samples[0].ID)
+	}
+
+	got := remuxAndDemux(t, f, cut)
+	if !got[0].IsHEVC() || !bytes.Equal(got[0].Stsd, stsd) {
+		t.Error("HEVC sample description was not preserved verbatim")
+	}
+	for i, s := range got[0].Samples {
+		if s.IsKeyframe != samples[i].IsKeyframe {
+			t.Errorf("Sample %d: keyframe flag %v lost in remux", i, s.IsKeyframe)
+		}
+	}
+}
+
+func TestCutByPresentationTime(t *testing.T) {
+	// 25fps in ms, decode order I P B B: frame n (40ms units) is displayed at
+	// 4g+1, 4g+4, 4g+2, 4g+3 within GOP g
+	video := syntheticTrack(TrackTypeVideo, 1000, 16, 40, 100)
+	video.CTSOffsets = make([]int32, 16)
+	for i := range video.Samples {
+		video.Samples[i].IsKeyframe = i%4 == 0
+		video.CTSOffsets[i] = []int32{40, 120, 0, 0}[i%4]
+	}
+
+	// Decode-time cut from 160ms starts at the second I frame, displayed at
+	// 200ms: the frame shown at 160ms is lost
+	cutter := NewMultiTrackCutter([]Track{video})
+	cutter.Options.Logger = DiscardLogger
+	cut, err := cutter.Cut(160*time.Millisecond, 360*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cut[0].Samples[0].ID != 5 {
+		t.Fatalf("Expected the decode-time cut to start at sample 5, got %d", cut[0].Samples[0].ID)
+	}
+
+	cutter.Options.ByPresentationTime = true
+	cut, reports, err := cutter.CutWithReport(160*time.Millisecond, 360*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := cut[0]
+	if first, last := got.Samples[0].ID, got.Samples[len(got.Samples)-1].ID; first != 1 || last != 9 {
+		t.Fatalf("Expected samples 1-9, got %d-%d", first, last)
+	}
+	shown := make(map[int64]bool)
+	for i := range got.Samples {
+		shown[compositionTime(got, i)] = true
+	}
+	for pts := int64(160); pts <= 360; pts += 40 {
+		if !shown[pts] {
+			t.Errorf("Frame displayed at %dms is missing from the cut", pts)
+		}
+	}
+	// The pre-roll frames (displayed at 40-120ms) are hidden by the edit
+	if len(got.EditList) != 1 || got.EditList[0].MediaTime != 160 || got.MediaTimeOffset != 160 {
+		t.Errorf("Expected one edit starting presentation at 160ms, got %+v", got.EditList)
+	}
+	if reports[0].ActualStart != 0.16 || reports[0].ActualEnd != 0.36 {
+		t.Errorf("Expected the report in presentation time (0.16s-0.36s), got %v-%v", reports[0].ActualStart, reports[0].ActualEnd)
+	}
+	if got.PresentationDuration() != 200*time.Millisecond {
+		t.Errorf("Expected the requested 200ms presented, got %s", got.PresentationDuration())
+	}
+}
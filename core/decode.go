@@ -0,0 +1,63 @@
+package core
+
+import (
+	"fmt"
+	"io"
+)
+
+// CodecConfig carries what a decoder needs to interpret a track's samples
+type CodecConfig struct {
+	CodecTag  string
+	TrackType TrackType
+	Stsd      []byte // Raw sample description (holds avcC/hvcC/esds)
+	Timescale uint32
+	Width     uint32 // Pixels
+	Height    uint32 // Pixels
+}
+
+// RawFrame is a decoded picture (or block of audio) produced by a DecodeFunc
+type RawFrame struct {
+	Data   []byte
+	Width  int
+	Height int
+	PTS    int64 // Presentation time in track timescale units
+}
+
+// DecodeFunc decodes one compressed sample into zero or more raw frames.
+// The package ships no decoder; callers wrap their own (libavcodec, a
+// hardware API, an external process...) to enable real re-encoding.
+type DecodeFunc func(sampleBytes []byte, cfg CodecConfig) ([]RawFrame, error)
+
+// CodecConfigFor builds the decoder configuration of a track
+func CodecConfigFor(t Track) CodecConfig {
+	return CodecConfig{
+		CodecTag:  t.CodecTag,
+		TrackType: t.Type,
+		Stsd:      t.Stsd,
+		Timescale: t.Timescale,
+		Width:     t.Width >> 16,
+		Height:    t.Height >> 16,
+	}
+}
+
+// DecodeGOP reads every sample of a GOP from r and feeds it to decode,
+// returning the frames in decode order.
+func DecodeGOP(r io.ReaderAt, gop *GOP, cfg CodecConfig, decode DecodeFunc) ([]RawFrame, error) {
+	if decode == nil {
+		return nil, fmt.Errorf("no decoder configured")
+	}
+
+	var frames []RawFrame
+	for _, s := range gop.Samples {
+		buf := make([]byte, s.Size)
+		if _, err := r.ReadAt(buf, s.Offset); err != nil {
+			return nil, fmt.Errorf("reading sample %d: %w", s.ID, err)
+		}
+		decoded, err := decode(buf, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("decoding sample %d: %w", s.ID, err)
+		}
+		frames = append(frames, decoded...)
+	}
+	return frames, nil
+}
@@ -4,17 +4,19 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
-	"os"
 )
 
 // Sample represents a single video frame/audio sample
 type Sample struct {
-	ID         int
-	IsKeyframe bool
-	Offset     int64
-	Size       int64
-	Time       int64 // Decoding time
-	Duration   int64
+	ID          int
+	IsKeyframe  bool
+	Offset      int64
+	Size        int64
+	Time        int64 // Decoding time
+	Duration    int64
+	Source      int // Index into Remuxer.Sources when samples come from several files
+	Chunk       int // 1-based chunk index in the source stco/co64 (0 = unknown)
+	Description int // 1-based stsd entry describing the sample (0 = the first)
 }
 
 // KeyframeInfo holds metadata for cutting
@@ -25,25 +27,52 @@ type KeyframeInfo struct {
 
 // Demuxer handles the parsing of the Sample Table (stbl)
 type Demuxer struct {
-	file *os.File
+	file io.ReadSeeker
+
+	// Logger receives the demuxer's messages (nil = stdout). Use
+	// DiscardLogger to suppress them.
+	Logger Logger
 }
 
-func NewDemuxer(file *os.File) *Demuxer {
+func NewDemuxer(file io.ReadSeeker) *Demuxer {
 	return &Demuxer{file: file}
 }
 
-// Helper to find child by type
+func (d *Demuxer) logger() Logger {
+	return loggerOr(d.Logger)
+}
+
+// Helper to find child by type. The result points into parent.Children, so
+// it aliases the caller's tree.
 func findChildPath(parent Atom, typ string) *Atom {
-	for _, c := range parent.Children {
-		if c.Type == typ {
-			return &c
+	for i := range parent.Children {
+		if parent.Children[i].Type == typ {
+			return &parent.Children[i]
 		}
 	}
 	return nil
 }
 
+// stsdCodecTag returns the format of the first sample entry of an stsd
+// payload: Ver(4) + EntryCount(4) + EntrySize(4) + CodecTag(4)
+func stsdCodecTag(stsd []byte) (string, error) {
+	if len(stsd) < 16 {
+		return "", fmt.Errorf("stsd payload too short for a sample entry (%d bytes, need 16)", len(stsd))
+	}
+	return string(stsd[12:16]), nil
+}
+
 // Helper to read payload
-func readPayload(f *os.File, atom *Atom) []byte {
+func (d *Demuxer) readPayload(atom *Atom) []byte {
+	f := d.file
+	if atom.Size < 8 {
+		return nil
+	}
+	// Never trust the declared size beyond what the file actually holds
+	if size, err := streamSize(f); err == nil && atom.Offset+atom.Size > size {
+		d.logger().Printf("[Demuxer] Warning: [%s] @ %d declares %d bytes, past end of file\n", atom.Type, atom.Offset, atom.Size)
+		return nil
+	}
 	if _, err := f.Seek(atom.Offset+8, 0); err != nil {
 		return nil
 	}
@@ -57,25 +86,179 @@ func readPayload(f *os.File, atom *Atom) []byte {
 // ExtractTracks parses all tracks from the Movie Atom
 func (d *Demuxer) ExtractTracks(moov Atom) ([]Track, error) {
 	var tracks []Track
+	var firstErr error
+
+	// Edit list segment durations are expressed in the movie timescale
+	movieScale := uint32(0)
+	if mvhd := findChildPath(moov, "mvhd"); mvhd != nil {
+		movieScale, _, _, _ = d.ParseMdhd(*mvhd)
+	}
 
 	for _, child := range moov.Children {
 		if child.Type == "trak" {
 			track, err := d.parseTrack(child)
 			if err != nil {
-				fmt.Printf("[Demuxer] Warning: Failed to parse track: %v\n", err)
+				d.logger().Printf("[Demuxer] Warning: Failed to parse track: %v\n", err)
+				if firstErr == nil {
+					firstErr = err
+				}
 				continue
 			}
+			track.MovieTimescale = movieScale
 			tracks = append(tracks, *track)
 		}
 	}
 
 	if len(tracks) == 0 {
-		return nil, fmt.Errorf("no valid tracks found in moov")
+		return nil, noTracksError(firstErr)
 	}
 
 	return tracks, nil
 }
 
+// ListTracks describes every track in the Movie Atom without mapping samples.
+// Only tkhd, mdhd, hdlr and stsd are read, so it stays cheap on huge files.
+func (d *Demuxer) ListTracks(moov Atom) ([]TrackInfo, error) {
+	var infos []TrackInfo
+	var firstErr error
+
+	for _, child := range moov.Children {
+		if child.Type != "trak" {
+			continue
+		}
+		info, err := d.parseTrackInfo(child)
+		if err != nil {
+			d.logger().Printf("[Demuxer] Warning: Failed to list track: %v\n", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		infos = append(infos, *info)
+	}
+
+	if len(infos) == 0 {
+		return nil, noTracksError(firstErr)
+	}
+
+	return infos, nil
+}
+
+// noTracksError is ErrNoTracks, also wrapping why the first track failed
+func noTracksError(firstErr error) error {
+	if firstErr == nil {
+		return ErrNoTracks
+	}
+	return fmt.Errorf("%w (first track: %w)", ErrNoTracks, firstErr)
+}
+
+// parseTrackInfo reads the headers of a single 'trak' atom
+func (d *Demuxer) parseTrackInfo(trak Atom) (*TrackInfo, error) {
+	info := &TrackInfo{}
+
+	tkhdAtom := findChildPath(trak, "tkhd")
+	if tkhdAtom == nil {
+		return nil, fmt.Errorf("%w: tkhd", ErrMissingTables)
+	}
+	info.ID = tkhdTrackID(d.readPayload(tkhdAtom))
+	info.Width, info.Height, info.Matrix, _ = d.ParseTkhd(*tkhdAtom)
+
+	mdiaAtom := findChildPath(trak, "mdia")
+	if mdiaAtom == nil {
+		return nil, fmt.Errorf("%w: mdia", ErrMissingTables)
+	}
+	mdhdAtom := findChildPath(*mdiaAtom, "mdhd")
+	if mdhdAtom == nil {
+		return nil, fmt.Errorf("%w: mdhd", ErrMissingTables)
+	}
+	timescale, duration, language, err := d.ParseMdhd(*mdhdAtom)
+	if err != nil {
+		return nil, err
+	}
+	if timescale == 0 {
+		d.logger().Printf("[Demuxer] Warning: Track %d: mdhd media timescale is 0, timings are unusable\n", info.ID)
+	}
+	info.Timescale = timescale
+	info.Duration = duration
+	info.Language = language
+
+	hdlrAtom := findChildPath(*mdiaAtom, "hdlr")
+	if hdlrAtom == nil {
+		return nil, fmt.Errorf("%w: hdlr", ErrMissingTables)
+	}
+	info.Type = trackTypeFromHdlr(d.readPayload(hdlrAtom))
+
+	minfAtom := findChildPath(*mdiaAtom, "minf")
+	if minfAtom != nil {
+		if stblAtom := findChildPath(*minfAtom, "stbl"); stblAtom != nil {
+			if stsdAtom := findChildPath(*stblAtom, "stsd"); stsdAtom != nil {
+				stsd := d.readPayload(stsdAtom)
+				if tag, err := stsdCodecTag(stsd); err == nil {
+					info.CodecTag = tag
+				} else {
+					d.logger().Printf("[Demuxer] Warning: Track %d: %v\n", info.ID, err)
+				}
+				if isProtectedTag(info.CodecTag) {
+					if format, ok := originalFormat(stsd, info.Type); ok {
+						info.CodecTag = format
+						info.Encrypted = true
+					}
+				}
+				if info.Type == TrackTypeAudio {
+					info.SampleRate, info.Channels, _, _ = parseAudioSampleEntry(stsd)
+				}
+				if info.Type == TrackTypeHint {
+					info.Hint = d.parseHintInfo(trak, stsd)
+				}
+			}
+		}
+	}
+
+	return info, nil
+}
+
+// tkhdTrackID extracts the track_ID field from a tkhd payload
+func tkhdTrackID(tkhd []byte) int {
+	if len(tkhd) < 4 {
+		return 0
+	}
+	// V0: Ver/Flags(4) + Creation(4) + Modification(4) + TrackID(4)
+	// V1: Ver/Flags(4) + Creation(8) + Modification(8) + TrackID(4)
+	pos := 12
+	if tkhd[0] == 1 {
+		pos = 20
+	}
+	if len(tkhd) < pos+4 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(tkhd[pos : pos+4]))
+}
+
+// trackTypeFromHdlr maps the hdlr handler_type to a TrackType
+func trackTypeFromHdlr(hdlr []byte) TrackType {
+	if len(hdlr) < 12 {
+		return ""
+	}
+	switch string(hdlr[8:12]) { // Offset 8 (after Ver/Flags/Pre)
+	case "vide":
+		return TrackTypeVideo
+	case "soun":
+		return TrackTypeAudio
+	case "hint":
+		return TrackTypeHint
+	default:
+		return TrackTypeMeta
+	}
+}
+
+// Media header boxes accepted in minf, per track type
+var mediaHeaderTypes = map[TrackType][]string{
+	TrackTypeVideo: {"vmhd"},
+	TrackTypeAudio: {"smhd"},
+	TrackTypeHint:  {"hmhd"},
+	TrackTypeMeta:  {"nmhd", "sthd", "gmhd"},
+}
+
 // parseTrack parses a single 'trak' atom into a Track struct
 func (d *Demuxer) parseTrack(trak Atom) (*Track, error) {
 	tr := &Track{}
@@ -83,15 +266,23 @@ func (d *Demuxer) parseTrack(trak Atom) (*Track, error) {
 	// 1. tkhd (Track Header)
 	tkhdAtom := findChildPath(trak, "tkhd")
 	if tkhdAtom == nil {
-		return nil, fmt.Errorf("missing tkhd")
+		return nil, fmt.Errorf("%w: tkhd", ErrMissingTables)
 	}
-	tr.Tkhd = readPayload(d.file, tkhdAtom)
+	tr.Tkhd = d.readPayload(tkhdAtom)
+	tr.ID = tkhdTrackID(tr.Tkhd)
+	tr.CreationTime, tr.ModificationTime = headerTimestamps(tr.Tkhd)
+	tr.SourceBoxes = atomPaths(trak)
 	// Parse Width/Height/Matrix for Video (Best effort)
 	width, height, matrix, _ := d.ParseTkhd(*tkhdAtom)
 	tr.Width = width
 	tr.Height = height
 	tr.Matrix = matrix
 
+	// 1a. tref (Track References), e.g. chapters or hinted media
+	if trefAtom := findChildPath(trak, "tref"); trefAtom != nil {
+		tr.References = parseTrackReferences(d.readPayload(trefAtom))
+	}
+
 	// 1b. edts -> elst (Edit List) — Sync correction
 	edtsAtom := findChildPath(trak, "edts")
 	if edtsAtom != nil {
@@ -107,7 +298,7 @@ func (d *Demuxer) parseTrack(trak Atom) (*Track, error) {
 						break
 					}
 				}
-				fmt.Printf("[Demuxer] Track edts: %d edit list entries, MediaTimeOffset=%d\n", len(entries), tr.MediaTimeOffset)
+				d.logger().Printf("[Demuxer] Track edts: %d edit list entries, MediaTimeOffset=%d\n", len(entries), tr.MediaTimeOffset)
 			}
 		}
 	}
@@ -115,64 +306,60 @@ func (d *Demuxer) parseTrack(trak Atom) (*Track, error) {
 	// 2. mdia -> mdhd (Media Header - Timescale)
 	mdiaAtom := findChildPath(trak, "mdia")
 	if mdiaAtom == nil {
-		return nil, fmt.Errorf("missing mdia")
+		return nil, fmt.Errorf("%w: mdia", ErrMissingTables)
 	}
 	mdhdAtom := findChildPath(*mdiaAtom, "mdhd")
 	if mdhdAtom == nil {
-		return nil, fmt.Errorf("missing mdhd")
+		return nil, fmt.Errorf("%w: mdhd", ErrMissingTables)
 	}
-	timescale, duration, err := d.ParseMdhd(*mdhdAtom)
+	timescale, duration, language, err := d.ParseMdhd(*mdhdAtom)
 	if err != nil {
 		return nil, err
 	}
+	if timescale == 0 {
+		// Every time value downstream divides by the timescale; refuse to guess
+		return nil, fmt.Errorf("%w: mdhd media timescale is 0", ErrMalformedAtom)
+	}
 	tr.Timescale = timescale
 	tr.Duration = duration
+	tr.Language = language
 
 	// 3. mdia -> hdlr (Handler - Type)
 	hdlrAtom := findChildPath(*mdiaAtom, "hdlr")
 	if hdlrAtom == nil {
-		return nil, fmt.Errorf("missing hdlr")
+		return nil, fmt.Errorf("%w: hdlr", ErrMissingTables)
 	}
-	tr.Hdlr = readPayload(d.file, hdlrAtom)
+	tr.Hdlr = d.readPayload(hdlrAtom)
 
 	// Determine Type from hdlr
-	if len(tr.Hdlr) >= 12 {
-		handlerType := string(tr.Hdlr[8:12]) // Offset 8 (after Ver/Flags/Pre)
-		switch handlerType {
-		case "vide":
-			tr.Type = TrackTypeVideo
-		case "soun":
-			tr.Type = TrackTypeAudio
-		case "hint":
-			tr.Type = TrackTypeHint
-		default:
-			tr.Type = TrackTypeMeta
-		}
-	}
+	tr.Type = trackTypeFromHdlr(tr.Hdlr)
 
 	// 4. mdia -> minf (Media Info)
 	minfAtom := findChildPath(*mdiaAtom, "minf")
 	if minfAtom == nil {
-		return nil, fmt.Errorf("missing minf")
+		return nil, fmt.Errorf("%w: minf", ErrMissingTables)
 	}
 
-	// Media Header (vmhd or smhd)
-	if tr.Type == TrackTypeVideo {
-		vmhdAtom := findChildPath(*minfAtom, "vmhd")
-		if vmhdAtom != nil {
-			tr.MediaHeader = readPayload(d.file, vmhdAtom)
+	// Media Header (vmhd, smhd, or nmhd/sthd/hmhd for timed metadata and hint tracks)
+	for _, headerType := range mediaHeaderTypes[tr.Type] {
+		if headerAtom := findChildPath(*minfAtom, headerType); headerAtom != nil {
+			tr.MediaHeader = d.readPayload(headerAtom)
+			tr.MediaHeaderType = headerType
+			break
 		}
-	} else if tr.Type == TrackTypeAudio {
-		smhdAtom := findChildPath(*minfAtom, "smhd")
-		if smhdAtom != nil {
-			tr.MediaHeader = readPayload(d.file, smhdAtom)
+	}
+
+	// Data Reference (dinf -> dref)
+	if dinfAtom := findChildPath(*minfAtom, "dinf"); dinfAtom != nil {
+		if drefAtom := findChildPath(*dinfAtom, "dref"); drefAtom != nil {
+			tr.Dref = d.readPayload(drefAtom)
 		}
 	}
 
 	// 5. stbl (Sample Table) - The Big One
 	samples, err := d.MapSamples(trak)
 	if err != nil {
-		return nil, fmt.Errorf("failed to map samples: %v", err)
+		return nil, fmt.Errorf("failed to map samples: %w", err)
 	}
 	tr.Samples = samples
 
@@ -181,8 +368,35 @@ func (d *Demuxer) parseTrack(trak Atom) (*Track, error) {
 	if stblAtom != nil {
 		stsdAtom := findChildPath(*stblAtom, "stsd")
 		if stsdAtom != nil {
-			tr.Stsd = readPayload(d.file, stsdAtom)
+			tr.Stsd = d.readPayload(stsdAtom)
+		}
+		if tr.Type == TrackTypeHint {
+			tr.Hint = d.parseHintInfo(trak, tr.Stsd)
+		}
+
+		// Keep the compact source tables for unchanged remuxes
+		tables := &SampleTables{SampleCount: len(samples)}
+		for _, c := range stblAtom.Children {
+			switch c.Type {
+			case "stts":
+				tables.Stts = d.readPayload(&c)
+			case "stsz":
+				tables.Stsz = d.readPayload(&c)
+			case "stss":
+				tables.Stss = d.readPayload(&c)
+			case "ctts":
+				tables.Ctts = d.readPayload(&c)
+			case "stsc":
+				tables.Stsc = d.readPayload(&c)
+			}
+		}
+		// Count what stsz declares, not what was mapped: when the chunk tables
+		// dropped samples the source tables describe more than the track holds
+		if len(tables.Stsz) >= 12 {
+			tables.SampleCount = int(binary.BigEndian.Uint32(tables.Stsz[8:12]))
 		}
+		tr.SourceTables = tables
+		tr.AllKeyframes = tables.Stss == nil
 
 		// 7. ctts (Composition Time to Sample) - B-Frame support
 		cttsAtom := findChildPath(*stblAtom, "ctts")
@@ -197,17 +411,60 @@ func (d *Demuxer) parseTrack(trak Atom) (*Track, error) {
 					}
 				}
 				tr.CTSOffsets = offsets
-				fmt.Printf("[Demuxer] Track %s: Loaded %d ctts entries (%d per-sample offsets)\n", tr.Type, len(ctsEntries), len(offsets))
+				d.logger().Printf("[Demuxer] Track %s: Loaded %d ctts entries (%d per-sample offsets)\n", tr.Type, len(ctsEntries), len(offsets))
 			}
 		}
 	}
 
 	// 8. Codec Detection from stsd payload
-	if len(tr.Stsd) >= 12 {
-		// stsd: Ver(4) + EntryCount(4) + EntrySize(4) + CodecTag(4)
-		// The codec tag is at offset 12 within the stsd payload
-		tr.CodecTag = string(tr.Stsd[12:16])
-		fmt.Printf("[Demuxer] Track %s: Codec Tag = '%s'\n", tr.Type, tr.CodecTag)
+	if tag, err := stsdCodecTag(tr.Stsd); err != nil {
+		d.logger().Printf("[Demuxer] Warning: Track %s: %v\n", tr.Type, err)
+	} else {
+		tr.CodecTag = tag
+		// Encrypted entries: resolve the original codec from sinf/frma
+		if isProtectedTag(tr.CodecTag) {
+			if format, ok := originalFormat(tr.Stsd, tr.Type); ok {
+				tr.CodecTag = format
+				tr.Encrypted = true
+			}
+		}
+		d.logger().Printf("[Demuxer] Track %s: Codec Tag = '%s'\n", tr.Type, tr.CodecLabel())
+		if tr.IsHEVC() && !tr.Encrypted && findSampleEntryBox(tr.Stsd, TrackTypeVideo, "hvcC") == nil {
+			d.logger().Printf("[Demuxer] Warning: Track %d: '%s' sample entry has no hvcC decoder configuration\n", tr.ID, tr.CodecTag)
+		}
+	}
+
+	// 8b. Audio parameters
+	if tr.Type == TrackTypeAudio {
+		tr.Volume = tkhdVolume(tr.Tkhd)
+		if info, err := d.ParseAudioStsd(tr.Stsd); err == nil {
+			tr.Audio = info
+		} else {
+			d.logger().Printf("[Demuxer] Warning: Track %s: %v\n", tr.Type, err)
+		}
+		switch tr.CodecTag {
+		case "mp4a":
+			objectType, config, err := parseEsdsPayload(tr.Stsd)
+			if err != nil {
+				d.logger().Printf("[Demuxer] Warning: Track %d: %v\n", tr.ID, err)
+			}
+			tr.Audio.ObjectType = objectType
+			tr.AudioConfig = config
+		case "Opus":
+			tr.AudioConfig = findSampleEntryBox(tr.Stsd, TrackTypeAudio, "dOps")
+		}
+	}
+
+	// 9. data_reference_index -> dref entry
+	tr.DataReferenceIndex = sampleEntryDataRefIndex(tr.Stsd)
+	if tr.Dref != nil && tr.DataReferenceIndex != 0 {
+		entries := parseDrefEntries(tr.Dref)
+		idx := int(tr.DataReferenceIndex)
+		if idx > len(entries) {
+			d.logger().Printf("[Demuxer] Warning: Track %s: data_reference_index %d exceeds %d dref entries\n", tr.Type, idx, len(entries))
+		} else if !entries[idx-1].SelfContained {
+			d.logger().Printf("[Demuxer] Warning: Track %s: dref entry %d ('%s') points to external media data\n", tr.Type, idx, entries[idx-1].Type)
+		}
 	}
 
 	return tr, nil
@@ -225,6 +482,18 @@ func readFullBoxHeader(r io.Reader) (version uint8, flags uint32, err error) {
 	return
 }
 
+// checkEntryCount makes sure a table's declared entry count fits in the atom
+// payload before anything is allocated. fixedBytes counts the payload bytes
+// preceding the entries (FullBox header, entry count, ...).
+func checkEntryCount(atom Atom, fixedBytes int64, count uint32, entrySize int64) error {
+	available := atom.Size - 8 - fixedBytes
+	if available < 0 || int64(count)*entrySize > available {
+		return fmt.Errorf("%w: [%s] @ %d declares %d entries of %d bytes, but only %d payload bytes are available",
+			ErrTruncatedAtom, atom.Type, atom.Offset, count, entrySize, available)
+	}
+	return nil
+}
+
 // ParseStts parses Time-to-Sample box
 func (d *Demuxer) ParseStts(atom Atom) ([]struct{ Count, Duration uint32 }, error) {
 	if _, err := d.file.Seek(atom.Offset+8, io.SeekStart); err != nil { // Skip Header
@@ -239,6 +508,9 @@ func (d *Demuxer) ParseStts(atom Atom) ([]struct{ Count, Duration uint32 }, erro
 	if err := binary.Read(d.file, binary.BigEndian, &entryCount); err != nil {
 		return nil, err
 	}
+	if err := checkEntryCount(atom, 4+4, entryCount, 8); err != nil {
+		return nil, err
+	}
 
 	entries := make([]struct{ Count, Duration uint32 }, entryCount)
 	for i := 0; i < int(entryCount); i++ {
@@ -263,6 +535,9 @@ func (d *Demuxer) ParseStss(atom Atom) ([]uint32, error) {
 	if err := binary.Read(d.file, binary.BigEndian, &entryCount); err != nil {
 		return nil, err
 	}
+	if err := checkEntryCount(atom, 4+4, entryCount, 4); err != nil {
+		return nil, err
+	}
 
 	entries := make([]uint32, entryCount)
 	for i := 0; i < int(entryCount); i++ {
@@ -287,6 +562,9 @@ func (d *Demuxer) ParseStco(atom Atom) ([]uint32, error) {
 	if err := binary.Read(d.file, binary.BigEndian, &entryCount); err != nil {
 		return nil, err
 	}
+	if err := checkEntryCount(atom, 4+4, entryCount, 4); err != nil {
+		return nil, err
+	}
 
 	entries := make([]uint32, entryCount)
 	for i := 0; i < int(entryCount); i++ {
@@ -297,6 +575,58 @@ func (d *Demuxer) ParseStco(atom Atom) ([]uint32, error) {
 	return entries, nil
 }
 
+// ParseCo64 parses the 64-bit Chunk Offset box used by files larger than 4GB
+func (d *Demuxer) ParseCo64(atom Atom) ([]uint64, error) {
+	if _, err := d.file.Seek(atom.Offset+8, io.SeekStart); err != nil {
+		return nil, err
+	}
+	_, _, err := readFullBoxHeader(d.file)
+	if err != nil {
+		return nil, err
+	}
+
+	var entryCount uint32
+	if err := binary.Read(d.file, binary.BigEndian, &entryCount); err != nil {
+		return nil, err
+	}
+	if err := checkEntryCount(atom, 4+4, entryCount, 8); err != nil {
+		return nil, err
+	}
+
+	entries := make([]uint64, entryCount)
+	for i := 0; i < int(entryCount); i++ {
+		if err := binary.Read(d.file, binary.BigEndian, &entries[i]); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// parseChunkOffsets reads an stco or co64 atom into 64-bit offsets
+func (d *Demuxer) parseChunkOffsets(atom Atom) ([]int64, error) {
+	if atom.Type == "co64" {
+		entries, err := d.ParseCo64(atom)
+		if err != nil {
+			return nil, err
+		}
+		offsets := make([]int64, len(entries))
+		for i, off := range entries {
+			offsets[i] = int64(off)
+		}
+		return offsets, nil
+	}
+
+	entries, err := d.ParseStco(atom)
+	if err != nil {
+		return nil, err
+	}
+	offsets := make([]int64, len(entries))
+	for i, off := range entries {
+		offsets[i] = int64(off)
+	}
+	return offsets, nil
+}
+
 // ParseStsz parses Sample Size box
 func (d *Demuxer) ParseStsz(atom Atom) (uint32, []uint32, error) {
 	if _, err := d.file.Seek(atom.Offset+8, io.SeekStart); err != nil {
@@ -320,6 +650,9 @@ func (d *Demuxer) ParseStsz(atom Atom) (uint32, []uint32, error) {
 	if sampleSize != 0 {
 		return sampleSize, nil, nil
 	}
+	if err := checkEntryCount(atom, 4+4+4, entryCount, 4); err != nil {
+		return 0, nil, err
+	}
 
 	entries := make([]uint32, entryCount)
 	for i := 0; i < int(entryCount); i++ {
@@ -344,6 +677,9 @@ func (d *Demuxer) ParseStsc(atom Atom) ([]struct{ FirstChunk, SamplesPerChunk, S
 	if err := binary.Read(d.file, binary.BigEndian, &entryCount); err != nil {
 		return nil, err
 	}
+	if err := checkEntryCount(atom, 4+4, entryCount, 12); err != nil {
+		return nil, err
+	}
 
 	entries := make([]struct{ FirstChunk, SamplesPerChunk, SampleDescID uint32 }, entryCount)
 	for i := 0; i < int(entryCount); i++ {
@@ -371,6 +707,9 @@ func (d *Demuxer) ParseCtts(atom Atom) ([]struct {
 	if err := binary.Read(d.file, binary.BigEndian, &entryCount); err != nil {
 		return nil, err
 	}
+	if err := checkEntryCount(atom, 4+4, entryCount, 8); err != nil {
+		return nil, err
+	}
 
 	entries := make([]struct {
 		Count  uint32
@@ -411,6 +750,13 @@ func (d *Demuxer) ParseElst(atom Atom) ([]EditListEntry, error) {
 	if err := binary.Read(d.file, binary.BigEndian, &entryCount); err != nil {
 		return nil, err
 	}
+	entryWidth := int64(12) // v0: SegmentDuration(4) + MediaTime(4) + Rate(4)
+	if version == 1 {
+		entryWidth = 20 // v1: SegmentDuration(8) + MediaTime(8) + Rate(4)
+	}
+	if err := checkEntryCount(atom, 4+4, entryCount, entryWidth); err != nil {
+		return nil, err
+	}
 
 	entries := make([]EditListEntry, entryCount)
 	for i := 0; i < int(entryCount); i++ {
@@ -450,14 +796,16 @@ func (d *Demuxer) ParseElst(atom Atom) ([]EditListEntry, error) {
 	return entries, nil
 }
 
-// ParseMdhd parses Media Header to get Timescale
-func (d *Demuxer) ParseMdhd(atom Atom) (uint32, uint64, error) {
+// ParseMdhd parses Media Header to get Timescale, Duration and the
+// ISO-639-2/T language ("" when absent or not a packed ISO code). mvhd shares
+// the leading fields, so it can be parsed too; its language is meaningless.
+func (d *Demuxer) ParseMdhd(atom Atom) (uint32, uint64, string, error) {
 	if _, err := d.file.Seek(atom.Offset+8, io.SeekStart); err != nil {
-		return 0, 0, err
+		return 0, 0, "", err
 	}
 	version, _, err := readFullBoxHeader(d.file)
 	if err != nil {
-		return 0, 0, err
+		return 0, 0, "", err
 	}
 
 	var timescale uint32
@@ -466,30 +814,72 @@ func (d *Demuxer) ParseMdhd(atom Atom) (uint32, uint64, error) {
 	if version == 1 {
 		// 64-bit duration
 		if _, err := d.file.Seek(16, io.SeekCurrent); err != nil {
-			return 0, 0, err
+			return 0, 0, "", err
 		} // Skip create/mod
 		if err := binary.Read(d.file, binary.BigEndian, &timescale); err != nil {
-			return 0, 0, err
+			return 0, 0, "", err
 		}
 		if err := binary.Read(d.file, binary.BigEndian, &duration); err != nil {
-			return 0, 0, err
+			return 0, 0, "", err
 		}
 	} else {
 		// 32-bit duration
 		if _, err := d.file.Seek(8, io.SeekCurrent); err != nil {
-			return 0, 0, err
+			return 0, 0, "", err
 		} // Skip create/mod
 		if err := binary.Read(d.file, binary.BigEndian, &timescale); err != nil {
-			return 0, 0, err
+			return 0, 0, "", err
 		}
 		var dur32 uint32
 		if err := binary.Read(d.file, binary.BigEndian, &dur32); err != nil {
-			return 0, 0, err
+			return 0, 0, "", err
 		}
 		duration = uint64(dur32)
 	}
 
-	return timescale, duration, nil
+	// Language is optional here: short (e.g. mvhd-sized) reads keep the timing
+	var packed uint16
+	if err := binary.Read(d.file, binary.BigEndian, &packed); err != nil {
+		return timescale, duration, "", nil
+	}
+	return timescale, duration, unpackLanguage(packed), nil
+}
+
+// unpackLanguage decodes an mdhd language: pad bit + three 5-bit letters,
+// each stored as its value minus 0x60. Values below 0x400 are QuickTime
+// Macintosh language codes and decode to "".
+func unpackLanguage(packed uint16) string {
+	if packed < 0x400 {
+		return ""
+	}
+	b := []byte{
+		byte(packed>>10&0x1F) + 0x60,
+		byte(packed>>5&0x1F) + 0x60,
+		byte(packed&0x1F) + 0x60,
+	}
+	for _, c := range b {
+		if c < 'a' || c > 'z' {
+			return ""
+		}
+	}
+	return string(b)
+}
+
+// packLanguage encodes a 3-letter lowercase ISO-639-2/T code for mdhd,
+// falling back to "und" (0x55c4) for anything else
+func packLanguage(lang string) uint16 {
+	if len(lang) != 3 {
+		return 0x55c4
+	}
+	packed := uint16(0)
+	for i := 0; i < 3; i++ {
+		c := lang[i]
+		if c < 'a' || c > 'z' {
+			return 0x55c4
+		}
+		packed = packed<<5 | uint16(c-0x60)
+	}
+	return packed
 }
 
 // ParseTkhd parses Track Header to get Width, Height, and Matrix
@@ -532,7 +922,8 @@ func (d *Demuxer) ParseTkhd(atom Atom) (width, height uint32, matrix []byte, err
 	return width, height, matrix, nil
 }
 
-// LocateTables finds the stbl children from a trak atom (scoped)
+// LocateTables finds the stbl children from a trak atom (scoped).
+// stco is the co64 atom when the track only has 64-bit chunk offsets.
 func (d *Demuxer) LocateTables(moov Atom) (stss, stts, stco, stsz, stsc *Atom) {
 	var find func(atoms []Atom)
 	find = func(atoms []Atom) {
@@ -544,6 +935,10 @@ func (d *Demuxer) LocateTables(moov Atom) (stss, stts, stco, stsz, stsc *Atom) {
 				stts = &atoms[i]
 			case "stco":
 				stco = &atoms[i]
+			case "co64":
+				if stco == nil {
+					stco = &atoms[i]
+				}
 			case "stsz":
 				stsz = &atoms[i]
 			case "stsc":
@@ -563,7 +958,7 @@ func (d *Demuxer) LocateTables(moov Atom) (stss, stts, stco, stsz, stsc *Atom) {
 func (d *Demuxer) MapSamples(moov Atom) ([]Sample, error) {
 	stssAtom, sttsAtom, stcoAtom, stszAtom, stscAtom := d.LocateTables(moov)
 	if sttsAtom == nil || stcoAtom == nil || stszAtom == nil || stscAtom == nil {
-		return nil, fmt.Errorf("missing critical atom tables (stts, stco, stsz, or stsc)")
+		return nil, fmt.Errorf("%w: critical sample tables (stts, stco/co64, stsz, or stsc)", ErrMissingTables)
 	}
 
 	// 1. Parse Tables
@@ -572,7 +967,7 @@ func (d *Demuxer) MapSamples(moov Atom) ([]Sample, error) {
 		return nil, err
 	}
 
-	stco, err := d.ParseStco(*stcoAtom)
+	stco, err := d.parseChunkOffsets(*stcoAtom)
 	if err != nil {
 		return nil, err
 	}
@@ -647,25 +1042,24 @@ func (d *Demuxer) MapSamples(moov Atom) ([]Sample, error) {
 	}
 
 	// Fill Offsets (The tricky part: stsc + stco)
-	// Iterate Chunks
+	// Each stsc entry is a run covering chunks [FirstChunk, next FirstChunk);
+	// the last run extends to the final chunk in stco.
 	sampleIdx := 0
-	for i, chunkOffset := range stco {
-		chunkIndex := i + 1 // 1-based
-
-		// Find stsc entry for this chunk
-		var samplesPerChunk uint32
-		for j := 0; j < len(stsc); j++ {
-			if uint32(chunkIndex) >= stsc[j].FirstChunk {
-				samplesPerChunk = stsc[j].SamplesPerChunk
-			} else {
-				break
-			}
+	for j, entry := range stsc {
+		if entry.FirstChunk == 0 || (j > 0 && entry.FirstChunk <= stsc[j-1].FirstChunk) {
+			return nil, fmt.Errorf("%w: stsc entry %d has invalid first chunk %d", ErrMalformedAtom, j, entry.FirstChunk)
+		}
+		lastChunk := uint32(len(stco))
+		if j+1 < len(stsc) && stsc[j+1].FirstChunk > 0 && stsc[j+1].FirstChunk-1 < lastChunk {
+			lastChunk = stsc[j+1].FirstChunk - 1
 		}
 
-		offset := int64(chunkOffset)
-		for j := 0; j < int(samplesPerChunk); j++ {
-			if sampleIdx < len(samples) {
+		for chunk := entry.FirstChunk; chunk <= lastChunk && sampleIdx < len(samples); chunk++ {
+			offset := stco[chunk-1]
+			for k := uint32(0); k < entry.SamplesPerChunk && sampleIdx < len(samples); k++ {
 				samples[sampleIdx].Offset = offset
+				samples[sampleIdx].Chunk = int(chunk)
+				samples[sampleIdx].Description = int(entry.SampleDescID)
 				samples[sampleIdx].IsKeyframe = (len(stss) == 0) || isKeyframe[samples[sampleIdx].ID]
 
 				offset += samples[sampleIdx].Size
@@ -674,5 +1068,12 @@ func (d *Demuxer) MapSamples(moov Atom) ([]Sample, error) {
 		}
 	}
 
+	// Samples past the last chunk have no location; keeping them would write
+	// whatever sits at offset 0 into the output
+	if sampleIdx < len(samples) {
+		d.logger().Printf("[Demuxer] Warning: chunk tables map only %d of %d samples, dropping the rest\n", sampleIdx, len(samples))
+		samples = samples[:sampleIdx]
+	}
+
 	return samples, nil
 }
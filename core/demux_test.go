@@ -0,0 +1,316 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func FuzzTableParsers(f *testing.F) {
+	f.Add([]byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 5, 0, 0, 0, 7})
+	f.Add([]byte{0, 0, 0, 0, 0xFF, 0xFF, 0xFF, 0xFF})
+	f.Add([]byte{1, 0, 0, 0, 0, 0, 0, 0, 0x7F, 0xFF, 0xFF, 0xFF})
+
+	dir := f.TempDir()
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		tmpfile, err := os.CreateTemp(dir, "table.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(tmpfile.Name())
+		defer tmpfile.Close()
+		tmpfile.Write(make([]byte, 8)) // Box header
+		tmpfile.Write(payload)
+
+		d := NewDemuxer(tmpfile)
+		atom := func(typ string) Atom {
+			return Atom{Offset: 0, Size: int64(8 + len(payload)), Type: typ}
+		}
+		limit := len(payload) // No table may hold more entries than payload bytes
+
+		if e, err := d.ParseStts(atom("stts")); err == nil && len(e) > limit {
+			t.Errorf("stts: %d entries from %d bytes", len(e), len(payload))
+		}
+		if e, err := d.ParseStss(atom("stss")); err == nil && len(e) > limit {
+			t.Errorf("stss: %d entries from %d bytes", len(e), len(payload))
+		}
+		if e, err := d.ParseStco(atom("stco")); err == nil && len(e) > limit {
+			t.Errorf("stco: %d entries from %d bytes", len(e), len(payload))
+		}
+		if e, err := d.ParseCo64(atom("co64")); err == nil && len(e) > limit {
+			t.Errorf("co64: %d entries from %d bytes", len(e), len(payload))
+		}
+		if _, e, err := d.ParseStsz(atom("stsz")); err == nil && len(e) > limit {
+			t.Errorf("stsz: %d entries from %d bytes", len(e), len(payload))
+		}
+		if e, err := d.ParseStsc(atom("stsc")); err == nil && len(e) > limit {
+			t.Errorf("stsc: %d entries from %d bytes", len(e), len(payload))
+		}
+		if e, err := d.ParseCtts(atom("ctts")); err == nil && len(e) > limit {
+			t.Errorf("ctts: %d entries from %d bytes", len(e), len(payload))
+		}
+		if e, err := d.ParseElst(atom("elst")); err == nil && len(e) > limit {
+			t.Errorf("elst: %d entries from %d bytes", len(e), len(payload))
+		}
+	})
+}
+
+func TestTableEntryCountExceedsAtom(t *testing.T) {
+	tmpfile, err := os.CreateTemp(t.TempDir(), "stts.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tmpfile.Close()
+	// stts claiming 0xFFFFFFFF entries with a single 8-byte entry present
+	payload := []byte{0, 0, 0, 0, 0xFF, 0xFF, 0xFF, 0xFF, 0, 0, 0, 1, 0, 0, 0, 1}
+	tmpfile.Write(makeBox("stts", payload))
+
+	d := NewDemuxer(tmpfile)
+	_, err = d.ParseStts(Atom{Offset: 0, Size: int64(8 + len(payload)), Type: "stts"})
+	if err == nil {
+		t.Fatal("Expected an error for an oversized entry count")
+	}
+	if !strings.Contains(err.Error(), "4294967295 entries") {
+		t.Errorf("Expected descriptive error, got: %v", err)
+	}
+}
+
+func TestReadPayloadRejectsSizePastEOF(t *testing.T) {
+	tmpfile, err := os.CreateTemp(t.TempDir(), "stsd.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tmpfile.Close()
+	tmpfile.Write(makeBox("stsd", make([]byte, 16)))
+
+	d := NewDemuxer(tmpfile)
+	log := &recordingLogger{}
+	d.Logger = log
+	if buf := d.readPayload(&Atom{Offset: 0, Size: 1 << 32, Type: "stsd"}); buf != nil {
+		t.Errorf("Expected nil payload for an atom larger than the file, got %d bytes", len(buf))
+	}
+	if len(log.lines) != 1 || !strings.Contains(log.lines[0], "past end of file") {
+		t.Errorf("Expected the warning on the demuxer's logger, got %q", log.lines)
+	}
+}
+
+func TestMapSamplesCo64(t *testing.T) {
+	track := syntheticTrack(TrackTypeVideo, 30000, 4, 1001, 100)
+	track.Stsd = append([]byte{0, 0, 0, 0, 0, 0, 0, 1}, makeBox("avc1", make([]byte, 78))...)
+	offsets := map[int]int64{0: 5 << 30, 1: 5<<30 + 100, 2: 6 << 30, 3: 1 << 40}
+	trak := serializeAtom(makeTrakAtom(track, 1, offsets, true, RemuxOptions{}))
+
+	f, err := os.CreateTemp(t.TempDir(), "co64.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Write(makeBox("moov", trak))
+
+	atoms, err := FastProbe(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDemuxer(f)
+	_, _, chunkOffsets, _, _ := d.LocateTables(atoms[0])
+	if chunkOffsets == nil || chunkOffsets.Type != "co64" {
+		t.Fatalf("Expected LocateTables to fall back to co64, got %v", chunkOffsets)
+	}
+	tracks, err := d.ExtractTracks(atoms[0])
+	if err != nil {
+		t.Fatalf("ExtractTracks failed: %v", err)
+	}
+	for i, s := range tracks[0].Samples {
+		if s.Offset != offsets[i] {
+			t.Errorf("sample %d: expected offset %d, got %d", i, offsets[i], s.Offset)
+		}
+	}
+}
+
+// makeStscMoov builds a bare moov/stbl with variable sample sizes, the given
+// chunk offsets and stsc runs ({FirstChunk, SamplesPerChunk} pairs)
+func makeStscMoov(sizes []uint32, chunkOffsets []uint32, runs [][2]uint32) []byte {
+	stts := binary.BigEndian.AppendUint32(make([]byte, 4), 1)
+	stts = binary.BigEndian.AppendUint32(stts, uint32(len(sizes)))
+	stts = binary.BigEndian.AppendUint32(stts, 100)
+
+	stsz := binary.BigEndian.AppendUint32(make([]byte, 8), uint32(len(sizes)))
+	for _, size := range sizes {
+		stsz = binary.BigEndian.AppendUint32(stsz, size)
+	}
+
+	stco := binary.BigEndian.AppendUint32(make([]byte, 4), uint32(len(chunkOffsets)))
+	for _, off := range chunkOffsets {
+		stco = binary.BigEndian.AppendUint32(stco, off)
+	}
+
+	stsc := binary.BigEndian.AppendUint32(make([]byte, 4), uint32(len(runs)))
+	for _, r := range runs {
+		stsc = binary.BigEndian.AppendUint32(stsc, r[0])
+		stsc = binary.BigEndian.AppendUint32(stsc, r[1])
+		stsc = binary.BigEndian.AppendUint32(stsc, 1)
+	}
+
+	var stbl []byte
+	for _, b := range [][]byte{makeBox("stts", stts), makeBox("stsz", stsz), makeBox("stco", stco), makeBox("stsc", stsc)} {
+		stbl = append(stbl, b...)
+	}
+	return makeBox("moov", makeBox("stbl", stbl))
+}
+
+func TestMapSamplesStscRuns(t *testing.T) {
+	// Chunks 1-2 hold 2 samples, chunks 3-4 hold 3, chunks 5-6 hold 1
+	sizes := []uint32{10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21}
+	chunkOffsets := []uint32{1000, 2000, 3000, 4000, 5000, 6000}
+	runs := [][2]uint32{{1, 2}, {3, 3}, {5, 1}}
+
+	f, err := os.CreateTemp(t.TempDir(), "stsc.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Write(makeStscMoov(sizes, chunkOffsets, runs))
+	atoms, err := FastProbe(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	samples, err := NewDemuxer(f).MapSamples(atoms[0])
+	if err != nil {
+		t.Fatalf("MapSamples failed: %v", err)
+	}
+	if len(samples) != 12 {
+		t.Fatalf("Expected 12 samples, got %d", len(samples))
+	}
+	wantChunks := []int{1, 1, 2, 2, 3, 3, 3, 4, 4, 4, 5, 6}
+	wantOffsets := []int64{1000, 1010, 2000, 2012, 3000, 3014, 3029, 4000, 4017, 4035, 5000, 6000}
+	for i, s := range samples {
+		if s.Chunk != wantChunks[i] || s.Offset != wantOffsets[i] {
+			t.Errorf("sample %d: got chunk %d offset %d, want chunk %d offset %d", i, s.Chunk, s.Offset, wantChunks[i], wantOffsets[i])
+		}
+	}
+
+	// One chunk short: the tail sample has no location and must not get offset 0
+	f2, err := os.CreateTemp(t.TempDir(), "stsc-short.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f2.Close()
+	f2.Write(makeStscMoov(sizes, chunkOffsets[:5], runs))
+	atoms, err = FastProbe(f2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples, err = NewDemuxer(f2).MapSamples(atoms[0])
+	if err != nil {
+		t.Fatalf("MapSamples failed: %v", err)
+	}
+	if len(samples) != 11 {
+		t.Errorf("Expected the unmapped sample to be dropped (11 samples), got %d", len(samples))
+	}
+}
+
+func TestStsdCodecTagBounds(t *testing.T) {
+	full := append([]byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 86}, "avc1"...)
+	for _, tc := range []struct {
+		size    int
+		wantTag string
+	}{
+		{0, ""}, {8, ""}, {12, ""}, {13, ""}, {15, ""}, {16, "avc1"},
+	} {
+		tag, err := stsdCodecTag(full[:tc.size])
+		if tag != tc.wantTag || (err == nil) != (tc.wantTag != "") {
+			t.Errorf("%d bytes: got tag %q, err %v; want tag %q", tc.size, tag, err, tc.wantTag)
+		}
+	}
+
+	// A truncated stsd must not take the whole demux down
+	for _, size := range []int{12, 14, 15} {
+		track := syntheticTrack(TrackTypeVideo, 30000, 4, 1001, 100)
+		track.Stsd = full[:size]
+		trak := serializeAtom(makeTrakAtom(track, 1, map[int]int64{}, false, RemuxOptions{}))
+		f, err := os.CreateTemp(t.TempDir(), "stsd.mp4")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(makeBox("moov", trak))
+		atoms, err := FastProbe(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tracks, err := NewDemuxer(f).ExtractTracks(atoms[0])
+		if err != nil || len(tracks) != 1 || tracks[0].CodecTag != "" {
+			t.Errorf("%d-byte stsd: expected the track without a codec tag, got %d tracks, err %v", size, len(tracks), err)
+		}
+		f.Close()
+	}
+}
+
+func TestFindChildPathAliasesTree(t *testing.T) {
+	moov := Atom{Type: "moov", Children: []Atom{
+		{Type: "mvhd", Offset: 8, Size: 108},
+		{Type: "trak", Offset: 116, Size: 500, Children: []Atom{{Type: "tkhd", Offset: 124, Size: 92}}},
+	}}
+
+	trak := findChildPath(moov, "trak")
+	if trak == nil {
+		t.Fatal("trak not found")
+	}
+	trak.Size = 42
+	trak.Children[0].Type = "edts"
+	if moov.Children[1].Size != 42 || moov.Children[1].Children[0].Type != "edts" {
+		t.Errorf("Mutation through the returned pointer did not reach the tree: %+v", moov.Children[1])
+	}
+	if findChildPath(moov, "udta") != nil {
+		t.Error("Expected nil for a missing child")
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	// A trak with headers but no stbl: the only track fails, so the moov has no tracks
+	mdhd := make([]byte, 24)
+	binary.BigEndian.PutUint32(mdhd[12:16], 1000)
+	mdia := append(makeBox("mdhd", mdhd), makeBox("hdlr", makeHdlr("vide"))...)
+	mdia = append(mdia, makeBox("minf", nil)...)
+	trak := append(makeBox("tkhd", make([]byte, 84)), makeBox("mdia", mdia)...)
+	file := makeBox("moov", makeBox("trak", trak))
+
+	r := bytes.NewReader(file)
+	atoms, err := FastProbe(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewDemuxer(r).ExtractTracks(atoms[0])
+	if !errors.Is(err, ErrNoTracks) || !errors.Is(err, ErrMissingTables) || !IsMalformed(err) {
+		t.Errorf("Expected ErrNoTracks wrapping ErrMissingTables, got %v", err)
+	}
+
+	if _, err := NewDemuxer(r).MapSamples(atoms[0]); !errors.Is(err, ErrMissingTables) {
+		t.Errorf("MapSamples: expected ErrMissingTables, got %v", err)
+	}
+	if _, err := NewDemuxer(r).ExtractAllTracks(nil); !errors.Is(err, ErrNoMoov) {
+		t.Errorf("ExtractAllTracks: expected ErrNoMoov, got %v", err)
+	}
+
+	// Extended-size header whose 8 size bytes lie past the end of the reader
+	short := []byte{0, 0, 0, 1, 'm', 'd', 'a', 't', 0, 0}
+	if _, err := FastProbeReader(bytes.NewReader(short), 16); !errors.Is(err, ErrTruncatedAtom) {
+		t.Errorf("Expected ErrTruncatedAtom, got %v", err)
+	}
+
+	// Containers nested past the depth limit
+	nested := makeBox("stbl", nil)
+	for i := 0; i <= maxAtomDepth+1; i++ {
+		nested = makeBox("trak", nested)
+	}
+	if _, err := FastProbeReader(bytes.NewReader(nested), int64(len(nested))); !errors.Is(err, ErrMalformedAtom) {
+		t.Errorf("Expected ErrMalformedAtom, got %v", err)
+	}
+
+	if IsMalformed(os.ErrNotExist) {
+		t.Error("I/O errors must not be classified as malformed input")
+	}
+}
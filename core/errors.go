@@ -0,0 +1,25 @@
+package core
+
+import "errors"
+
+// Sentinel errors for classifying failures with errors.Is. They describe a
+// malformed input; any other error (I/O, permissions, a full disk) is a
+// failure of the environment. See IsMalformed.
+var (
+	ErrNoMoov        = errors.New("moov atom not found")
+	ErrNoTracks      = errors.New("no valid tracks found in moov")
+	ErrMissingTables = errors.New("missing required atom")
+	ErrTruncatedAtom = errors.New("truncated atom")
+	ErrMalformedAtom = errors.New("malformed atom")
+)
+
+// IsMalformed reports whether err was caused by the input file rather than
+// the environment, e.g. to answer 422 instead of 500
+func IsMalformed(err error) bool {
+	for _, target := range []error{ErrNoMoov, ErrNoTracks, ErrMissingTables, ErrTruncatedAtom, ErrMalformedAtom, ErrNoAvcC, ErrNoEsds} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,219 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// IsFastStartFile probes rs up to the top-level moov and reports whether it
+// precedes the first mdat (see IsFastStart)
+func IsFastStartFile(rs io.ReadSeeker) (bool, error) {
+	atoms, err := FastProbeMoov(rs)
+	if err != nil {
+		return false, err
+	}
+	if FindAtom(atoms, "moov") == nil {
+		return false, ErrNoMoov
+	}
+	return IsFastStart(atoms), nil
+}
+
+// MoveMoovToFront rewrites input with its moov placed before the first mdat
+// ("web optimization"). Nothing is re-encoded or re-interleaved: the boxes are
+// copied as they are and only the stco/co64 chunk offsets are shifted by the
+// distance their mdat moved. Already-faststart inputs are copied unchanged.
+func MoveMoovToFront(input, output string) error {
+	in, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	atoms, err := FastProbe(in)
+	if err != nil {
+		return err
+	}
+	moovAtom := FindAtom(atoms, "moov")
+	if moovAtom == nil {
+		return ErrNoMoov
+	}
+	if FindAtom(atoms, "moof") != nil {
+		return fmt.Errorf("fragmented files are not supported: moof data offsets are moof-relative")
+	}
+
+	// New order: everything before the first mdat, moov, then the rest
+	var order []Atom
+	inserted := false
+	for _, a := range atoms {
+		if a.Type == "moov" {
+			continue
+		}
+		if a.Type == "mdat" && !inserted {
+			order = append(order, *moovAtom)
+			inserted = true
+		}
+		order = append(order, a)
+	}
+	if !inserted {
+		order = append(order, *moovAtom)
+	}
+
+	shifts, err := writeReordered(in, output, atoms, *moovAtom, order)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("[FastStart] Moved moov (%d bytes) from %d to %d\n", moovAtom.Size, moovAtom.Offset, moovAtom.Offset+shifts[moovAtom.Offset])
+	return nil
+}
+
+// StripPadding rewrites input without its top-level 'free' and 'skip' boxes
+// (space editors reserve for in-place edits), shifting the stco/co64 chunk
+// offsets to follow the data that moved. Padding nested inside other boxes is
+// kept, since removing it would change the sizes of its parents. Returns the
+// number of bytes removed.
+func StripPadding(input, output string) (int64, error) {
+	in, err := os.Open(input)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	atoms, err := FastProbe(in)
+	if err != nil {
+		return 0, err
+	}
+	moovAtom := FindAtom(atoms, "moov")
+	if moovAtom == nil {
+		return 0, ErrNoMoov
+	}
+	if FindAtom(atoms, "moof") != nil {
+		return 0, fmt.Errorf("fragmented files are not supported: moof data offsets are moof-relative")
+	}
+
+	var order []Atom
+	removed := int64(0)
+	for _, a := range atoms {
+		if a.Type == "free" || a.Type == "skip" {
+			removed += a.Size
+			continue
+		}
+		order = append(order, a)
+	}
+
+	if _, err := writeReordered(in, output, atoms, *moovAtom, order); err != nil {
+		return 0, err
+	}
+	fmt.Printf("[Strip] Removed %d bytes of free/skip padding\n", removed)
+	return removed, nil
+}
+
+// writeReordered writes the top-level atoms of in to output in the given
+// order (atoms left out of order are dropped), with the chunk offsets of moov
+// shifted to where their data lands. Returns the shift of every atom, keyed
+// by its old offset.
+func writeReordered(in *os.File, output string, atoms []Atom, moovAtom Atom, order []Atom) (map[int64]int64, error) {
+	shifts := make(map[int64]int64) // Old atom offset -> new minus old
+	pos := int64(0)
+	for _, a := range order {
+		shifts[a.Offset] = pos - a.Offset
+		pos += a.Size
+	}
+
+	moov := make([]byte, moovAtom.Size)
+	if _, err := in.ReadAt(moov, moovAtom.Offset); err != nil {
+		return nil, fmt.Errorf("reading moov: %w", err)
+	}
+	if err := shiftChunkOffsets(moov, moovAtom, atoms, shifts); err != nil {
+		return nil, err
+	}
+
+	// Creating the output would truncate the input before it is copied
+	if inInfo, err := in.Stat(); err == nil {
+		if outInfo, err := os.Stat(output); err == nil && os.SameFile(inInfo, outInfo) {
+			return nil, fmt.Errorf("output %s is the input file", output)
+		}
+	}
+
+	out, err := os.Create(output)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+
+	for _, a := range order {
+		if a.Offset == moovAtom.Offset {
+			if _, err := out.Write(moov); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if _, err := io.Copy(out, io.NewSectionReader(in, a.Offset, a.Size)); err != nil {
+			return nil, fmt.Errorf("copying [%s] @ %d: %w", a.Type, a.Offset, err)
+		}
+	}
+	return shifts, nil
+}
+
+// shiftChunkOffsets patches every stco/co64 under moov (held in buf) so each
+// offset follows the top-level atom it points into
+func shiftChunkOffsets(buf []byte, moov Atom, top []Atom, shifts map[int64]int64) error {
+	shiftFor := func(off int64) (int64, error) {
+		for _, a := range top {
+			if off >= a.Offset && off < a.Offset+a.Size {
+				return shifts[a.Offset], nil
+			}
+		}
+		return 0, fmt.Errorf("chunk offset %d lies outside every top-level atom", off)
+	}
+
+	var walk func(children []Atom) error
+	walk = func(children []Atom) error {
+		for _, c := range children {
+			if err := walk(c.Children); err != nil {
+				return err
+			}
+			if c.Type != "stco" && c.Type != "co64" {
+				continue
+			}
+			// Header(8) + Version/Flags(4) + EntryCount(4)
+			p := buf[c.Offset-moov.Offset : c.Offset-moov.Offset+c.Size]
+			if len(p) < 16 {
+				return fmt.Errorf("[%s] @ %d is too short", c.Type, c.Offset)
+			}
+			count := int64(binary.BigEndian.Uint32(p[12:16]))
+			entrySize := int64(4)
+			if c.Type == "co64" {
+				entrySize = 8
+			}
+			if count > (int64(len(p))-16)/entrySize {
+				return fmt.Errorf("[%s] @ %d declares %d entries but holds %d bytes", c.Type, c.Offset, count, len(p)-16)
+			}
+			for i := int64(0); i < count; i++ {
+				e := p[16+i*entrySize : 16+(i+1)*entrySize]
+				if c.Type == "co64" {
+					off := int64(binary.BigEndian.Uint64(e))
+					shift, err := shiftFor(off)
+					if err != nil {
+						return err
+					}
+					binary.BigEndian.PutUint64(e, uint64(off+shift))
+					continue
+				}
+				off := int64(binary.BigEndian.Uint32(e))
+				shift, err := shiftFor(off)
+				if err != nil {
+					return err
+				}
+				if off+shift > math.MaxUint32 {
+					return fmt.Errorf("chunk offset %d no longer fits stco after moving moov; remux to write co64", off+shift)
+				}
+				binary.BigEndian.PutUint32(e, uint32(off+shift))
+			}
+		}
+		return nil
+	}
+	return walk(moov.Children)
+}
@@ -0,0 +1,177 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeMoovAtEnd writes ftyp + mdat + moov, the layout of a camera recording
+func writeMoovAtEnd(t *testing.T, tracks []Track) string {
+	t.Helper()
+	return writePaddedMoovAtEnd(t, tracks, 0)
+}
+
+// writePaddedMoovAtEnd is writeMoovAtEnd with a free box of padding bytes
+// after ftyp and another one after the moov (none when padding is 0)
+func writePaddedMoovAtEnd(t *testing.T, tracks []Track, padding int) string {
+	t.Helper()
+	var file bytes.Buffer
+	file.Write([]byte{0, 0, 0, 16, 'f', 't', 'y', 'p', 'i', 's', 'o', 'm', 0, 0, 2, 0})
+	if padding > 0 {
+		file.Write(makeBox("free", make([]byte, padding-8)))
+	}
+
+	interleaved := buildInterleavedOrder(tracks, RemuxOptions{})
+	var mdat bytes.Buffer
+	offsets := make([]int64, len(interleaved))
+	for i, is := range interleaved {
+		offsets[i] = int64(file.Len()) + 8 + int64(mdat.Len())
+		mdat.Write(samplePattern(is.TrackIndex, is.SampleIndex, is.Sample.Size))
+	}
+	w := &AtomWriter{w: &file}
+	writeMdatHeader(w, int64(mdat.Len()))
+	file.Write(mdat.Bytes())
+	file.Write(serializeAtom(makeMoovMultiTrackWithOffsets(tracks, interleaved, offsets, make([]bool, len(tracks)), RemuxOptions{})))
+	if padding > 0 {
+		file.Write(makeBox("skip", make([]byte, padding-8)))
+	}
+
+	path := filepath.Join(t.TempDir(), "moov-at-end.mp4")
+	if err := os.WriteFile(path, file.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMoveMoovToFront(t *testing.T) {
+	tracks := []Track{
+		syntheticTrack(TrackTypeVideo, 30000, 12, 1001, 150),
+		syntheticTrack(TrackTypeAudio, 48000, 18, 1024, 25),
+	}
+	input := writeMoovAtEnd(t, tracks)
+
+	in, err := os.Open(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	if fast, err := IsFastStartFile(in); err != nil || fast {
+		t.Fatalf("Expected a non-faststart input, got %v (%v)", fast, err)
+	}
+
+	output := filepath.Join(t.TempDir(), "faststart.mp4")
+	if err := MoveMoovToFront(input, output); err != nil {
+		t.Fatalf("MoveMoovToFront failed: %v", err)
+	}
+
+	out, err := os.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	if fast, err := IsFastStartFile(out); err != nil || !fast {
+		t.Fatalf("Expected a faststart output, got %v (%v)", fast, err)
+	}
+	inInfo, _ := in.Stat()
+	outInfo, _ := out.Stat()
+	if inInfo.Size() != outInfo.Size() {
+		t.Errorf("Output size %d differs from input size %d", outInfo.Size(), inInfo.Size())
+	}
+
+	atoms, err := FastProbe(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewDemuxer(out).ExtractTracks(*FindAtom(atoms, "moov"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ti, tr := range got {
+		for si, s := range tr.Samples {
+			buf := make([]byte, s.Size)
+			if _, err := out.ReadAt(buf, s.Offset); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf, samplePattern(ti, si, s.Size)) {
+				t.Fatalf("Track %d sample %d: bytes differ after moving moov", ti, si)
+			}
+		}
+	}
+}
+
+func TestStripPadding(t *testing.T) {
+	tracks := []Track{
+		syntheticTrack(TrackTypeVideo, 30000, 12, 1001, 150),
+		syntheticTrack(TrackTypeAudio, 48000, 18, 1024, 25),
+	}
+	input := writePaddedMoovAtEnd(t, tracks, 4096)
+
+	output := filepath.Join(t.TempDir(), "stripped.mp4")
+	removed, err := StripPadding(input, output)
+	if err != nil {
+		t.Fatalf("StripPadding failed: %v", err)
+	}
+	if removed != 2*4096 {
+		t.Errorf("Expected 8192 bytes removed, got %d", removed)
+	}
+
+	inInfo, _ := os.Stat(input)
+	outInfo, _ := os.Stat(output)
+	if outInfo.Size() != inInfo.Size()-removed {
+		t.Errorf("Output size %d, want %d", outInfo.Size(), inInfo.Size()-removed)
+	}
+
+	out, err := os.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	atoms, err := FastProbe(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if FindAtom(atoms, "free") != nil || FindAtom(atoms, "skip") != nil {
+		t.Error("Padding boxes left in the output")
+	}
+	got, err := NewDemuxer(out).ExtractTracks(*FindAtom(atoms, "moov"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ti, tr := range got {
+		for si, s := range tr.Samples {
+			buf := make([]byte, s.Size)
+			if _, err := out.ReadAt(buf, s.Offset); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf, samplePattern(ti, si, s.Size)) {
+				t.Fatalf("Track %d sample %d: bytes differ after stripping", ti, si)
+			}
+		}
+	}
+}
+
+func TestRewriteRejectsInputAsOutput(t *testing.T) {
+	tracks := []Track{syntheticTrack(TrackTypeVideo, 30000, 12, 1001, 150)}
+	input := writePaddedMoovAtEnd(t, tracks, 4096)
+	before, err := os.ReadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same file, also through a different path
+	link := filepath.Join(t.TempDir(), "link.mp4")
+	if err := os.Link(input, link); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := StripPadding(input, link); err == nil {
+		t.Error("Expected StripPadding to refuse writing over its input")
+	}
+	if err := MoveMoovToFront(input, input); err == nil {
+		t.Error("Expected MoveMoovToFront to refuse writing over its input")
+	}
+	if after, _ := os.ReadFile(input); !bytes.Equal(after, before) {
+		t.Error("Input was modified")
+	}
+}
@@ -0,0 +1,334 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// trackExtends holds the per-track sample defaults from moov/mvex/trex
+type trackExtends struct {
+	DescriptionIndex uint32
+	Duration         uint32
+	Size             uint32
+	Flags            uint32
+}
+
+// tfhd flags
+const (
+	tfhdBaseDataOffset       = 0x000001
+	tfhdSampleDescription    = 0x000002
+	tfhdDefaultDuration      = 0x000008
+	tfhdDefaultSize          = 0x000010
+	tfhdDefaultFlags         = 0x000020
+	tfhdDefaultBaseIsMoof    = 0x020000
+	trunDataOffset           = 0x000001
+	trunFirstSampleFlags     = 0x000004
+	trunSampleDuration       = 0x000100
+	trunSampleSize           = 0x000200
+	trunSampleFlags          = 0x000400
+	trunSampleCTSOffset      = 0x000800
+	sampleFlagIsNonSync      = 0x00010000
+	maxFragmentSampleEntries = 1 << 24
+)
+
+// trackFragmentHeader is a parsed tfhd with the trex defaults applied
+type trackFragmentHeader struct {
+	TrackID        uint32
+	Flags          uint32
+	BaseDataOffset int64
+	Defaults       trackExtends
+}
+
+// ExtractAllTracks parses the tracks declared in moov and, for fragmented
+// files, appends the samples of every top-level moof (traf/tfhd/tfdt/trun)
+// to the matching track. The result has the same shape as ExtractTracks, so
+// it can be fed to the cutter and remuxer directly.
+func (d *Demuxer) ExtractAllTracks(atoms []Atom) ([]Track, error) {
+	var moov *Atom
+	for i := range atoms {
+		if atoms[i].Type == "moov" {
+			moov = &atoms[i]
+			break
+		}
+	}
+	if moov == nil {
+		return nil, ErrNoMoov
+	}
+
+	tracks, err := d.ExtractTracks(*moov)
+	if err != nil {
+		return nil, err
+	}
+
+	mvex := findChildPath(*moov, "mvex")
+	if mvex == nil {
+		return tracks, nil
+	}
+
+	defaults := make(map[uint32]trackExtends)
+	for _, c := range mvex.Children {
+		if c.Type != "trex" {
+			continue
+		}
+		id, ext, err := parseTrex(d.readPayload(&c))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse trex @ %d: %w", c.Offset, err)
+		}
+		defaults[id] = ext
+	}
+
+	byID := make(map[uint32]*Track)
+	for i := range tracks {
+		byID[uint32(tracks[i].ID)] = &tracks[i]
+	}
+
+	fragments := 0
+	for _, moof := range atoms {
+		if moof.Type != "moof" {
+			continue
+		}
+		if err := d.appendFragment(moof, defaults, byID); err != nil {
+			return nil, fmt.Errorf("failed to parse moof @ %d: %w", moof.Offset, err)
+		}
+		fragments++
+	}
+
+	if fragments > 0 {
+		for i := range tracks {
+			// Fragment samples are not described by the (empty) moov tables
+			tracks[i].SourceTables = nil
+			tracks[i].AllKeyframes = allKeyframes(tracks[i].Samples)
+		}
+		d.logger().Printf("[Demuxer] Fragmented file: merged %d movie fragments\n", fragments)
+	}
+	return tracks, nil
+}
+
+// appendFragment adds the samples of one moof to the tracks they belong to
+func (d *Demuxer) appendFragment(moof Atom, defaults map[uint32]trackExtends, byID map[uint32]*Track) error {
+	// Without explicit base offsets, the first traf starts at the moof and
+	// each following one where the previous traf's data ended
+	nextBase := moof.Offset
+
+	for _, traf := range moof.Children {
+		if traf.Type != "traf" {
+			continue
+		}
+		tfhdAtom := findChildPath(traf, "tfhd")
+		if tfhdAtom == nil {
+			return fmt.Errorf("traf @ %d has no tfhd", traf.Offset)
+		}
+		hdr, err := parseTfhd(d.readPayload(tfhdAtom), defaults)
+		if err != nil {
+			return fmt.Errorf("tfhd: %w", err)
+		}
+		switch {
+		case hdr.Flags&tfhdBaseDataOffset != 0:
+			// Explicit
+		case hdr.Flags&tfhdDefaultBaseIsMoof != 0:
+			hdr.BaseDataOffset = moof.Offset
+		default:
+			hdr.BaseDataOffset = nextBase
+		}
+
+		track := byID[hdr.TrackID]
+		if track == nil {
+			d.logger().Printf("[Demuxer] Warning: traf @ %d references unknown track %d, skipped\n", traf.Offset, hdr.TrackID)
+			continue
+		}
+
+		// Decode time: tfdt when present, else continue from the last sample
+		decodeTime := int64(0)
+		if n := len(track.Samples); n > 0 {
+			decodeTime = track.Samples[n-1].Time + track.Samples[n-1].Duration
+		}
+		if tfdt := findChildPath(traf, "tfdt"); tfdt != nil {
+			t, err := parseTfdt(d.readPayload(tfdt))
+			if err != nil {
+				return fmt.Errorf("tfdt: %w", err)
+			}
+			decodeTime = int64(t)
+		}
+
+		dataPos := hdr.BaseDataOffset
+		for _, trun := range traf.Children {
+			if trun.Type != "trun" {
+				continue
+			}
+			end, err := appendTrun(track, d.readPayload(&trun), hdr, dataPos, &decodeTime)
+			if err != nil {
+				return fmt.Errorf("trun @ %d: %w", trun.Offset, err)
+			}
+			dataPos = end
+		}
+		nextBase = dataPos
+	}
+	return nil
+}
+
+// parseTrex reads a Track Extends box: track_ID and the sample defaults
+func parseTrex(p []byte) (uint32, trackExtends, error) {
+	if len(p) < 24 {
+		return 0, trackExtends{}, fmt.Errorf("trex payload too short (%d bytes)", len(p))
+	}
+	return binary.BigEndian.Uint32(p[4:8]), trackExtends{
+		DescriptionIndex: binary.BigEndian.Uint32(p[8:12]),
+		Duration:         binary.BigEndian.Uint32(p[12:16]),
+		Size:             binary.BigEndian.Uint32(p[16:20]),
+		Flags:            binary.BigEndian.Uint32(p[20:24]),
+	}, nil
+}
+
+// parseTfhd reads a Track Fragment Header, starting from the trex defaults
+func parseTfhd(p []byte, defaults map[uint32]trackExtends) (trackFragmentHeader, error) {
+	var hdr trackFragmentHeader
+	if len(p) < 8 {
+		return hdr, fmt.Errorf("payload too short (%d bytes)", len(p))
+	}
+	hdr.Flags = binary.BigEndian.Uint32(p[0:4]) & 0x00FFFFFF
+	hdr.TrackID = binary.BigEndian.Uint32(p[4:8])
+	hdr.Defaults = defaults[hdr.TrackID]
+
+	pos := 8
+	read32 := func() (uint32, error) {
+		if pos+4 > len(p) {
+			return 0, fmt.Errorf("payload truncated at %d", pos)
+		}
+		v := binary.BigEndian.Uint32(p[pos : pos+4])
+		pos += 4
+		return v, nil
+	}
+
+	var err error
+	if hdr.Flags&tfhdBaseDataOffset != 0 {
+		if pos+8 > len(p) {
+			return hdr, fmt.Errorf("payload truncated at %d", pos)
+		}
+		hdr.BaseDataOffset = int64(binary.BigEndian.Uint64(p[pos : pos+8]))
+		pos += 8
+	}
+	if hdr.Flags&tfhdSampleDescription != 0 {
+		if hdr.Defaults.DescriptionIndex, err = read32(); err != nil {
+			return hdr, err
+		}
+	}
+	if hdr.Flags&tfhdDefaultDuration != 0 {
+		if hdr.Defaults.Duration, err = read32(); err != nil {
+			return hdr, err
+		}
+	}
+	if hdr.Flags&tfhdDefaultSize != 0 {
+		if hdr.Defaults.Size, err = read32(); err != nil {
+			return hdr, err
+		}
+	}
+	if hdr.Flags&tfhdDefaultFlags != 0 {
+		if hdr.Defaults.Flags, err = read32(); err != nil {
+			return hdr, err
+		}
+	}
+	return hdr, nil
+}
+
+// parseTfdt reads the Track Fragment Decode Time (baseMediaDecodeTime)
+func parseTfdt(p []byte) (uint64, error) {
+	if len(p) < 8 {
+		return 0, fmt.Errorf("payload too short (%d bytes)", len(p))
+	}
+	if p[0] == 1 {
+		if len(p) < 12 {
+			return 0, fmt.Errorf("payload too short for version 1 (%d bytes)", len(p))
+		}
+		return binary.BigEndian.Uint64(p[4:12]), nil
+	}
+	return uint64(binary.BigEndian.Uint32(p[4:8])), nil
+}
+
+// appendTrun adds the samples of one Track Run to track. dataPos is where the
+// run's data starts when it has no data_offset; decodeTime is advanced past
+// the run. Returns the file offset just after the run's sample data.
+func appendTrun(track *Track, p []byte, hdr trackFragmentHeader, dataPos int64, decodeTime *int64) (int64, error) {
+	if len(p) < 8 {
+		return 0, fmt.Errorf("payload too short (%d bytes)", len(p))
+	}
+	version := p[0]
+	flags := binary.BigEndian.Uint32(p[0:4]) & 0x00FFFFFF
+	count := binary.BigEndian.Uint32(p[4:8])
+	pos := 8
+
+	if flags&trunDataOffset != 0 {
+		if pos+4 > len(p) {
+			return 0, fmt.Errorf("payload truncated at %d", pos)
+		}
+		dataPos = hdr.BaseDataOffset + int64(int32(binary.BigEndian.Uint32(p[pos:pos+4])))
+		pos += 4
+	}
+	firstFlags, hasFirstFlags := uint32(0), flags&trunFirstSampleFlags != 0
+	if hasFirstFlags {
+		if pos+4 > len(p) {
+			return 0, fmt.Errorf("payload truncated at %d", pos)
+		}
+		firstFlags = binary.BigEndian.Uint32(p[pos : pos+4])
+		pos += 4
+	}
+
+	entrySize := 0
+	for _, f := range []uint32{trunSampleDuration, trunSampleSize, trunSampleFlags, trunSampleCTSOffset} {
+		if flags&f != 0 {
+			entrySize += 4
+		}
+	}
+	if count > maxFragmentSampleEntries || int(count)*entrySize > len(p)-pos {
+		return 0, fmt.Errorf("declares %d samples of %d bytes, but only %d payload bytes are available", count, entrySize, len(p)-pos)
+	}
+
+	hasCTS := flags&trunSampleCTSOffset != 0
+	if hasCTS && len(track.CTSOffsets) < len(track.Samples) {
+		// Earlier samples had no offsets: keep the slices aligned
+		track.CTSOffsets = append(track.CTSOffsets, make([]int32, len(track.Samples)-len(track.CTSOffsets))...)
+	}
+
+	for i := uint32(0); i < count; i++ {
+		s := Sample{
+			ID:       len(track.Samples) + 1,
+			Offset:   dataPos,
+			Time:     *decodeTime,
+			Duration: int64(hdr.Defaults.Duration),
+			Size:     int64(hdr.Defaults.Size),
+		}
+		sampleFlags := hdr.Defaults.Flags
+		if i == 0 && hasFirstFlags {
+			sampleFlags = firstFlags
+		}
+		var cts int32
+		if flags&trunSampleDuration != 0 {
+			s.Duration = int64(binary.BigEndian.Uint32(p[pos : pos+4]))
+			pos += 4
+		}
+		if flags&trunSampleSize != 0 {
+			s.Size = int64(binary.BigEndian.Uint32(p[pos : pos+4]))
+			pos += 4
+		}
+		if flags&trunSampleFlags != 0 {
+			sampleFlags = binary.BigEndian.Uint32(p[pos : pos+4])
+			pos += 4
+		}
+		if hasCTS {
+			// Unsigned in version 0, signed in version 1; both fit int32 in practice
+			cts = int32(binary.BigEndian.Uint32(p[pos : pos+4]))
+			if version == 0 && cts < 0 {
+				cts = 0
+			}
+			pos += 4
+		}
+		s.IsKeyframe = sampleFlags&sampleFlagIsNonSync == 0
+
+		track.Samples = append(track.Samples, s)
+		if hasCTS || len(track.CTSOffsets) > 0 {
+			track.CTSOffsets = append(track.CTSOffsets, cts)
+		}
+		dataPos += s.Size
+		*decodeTime += s.Duration
+	}
+	return dataPos, nil
+}
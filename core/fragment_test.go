@@ -0,0 +1,100 @@
+package core
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+)
+
+// makeFragment builds moof+mdat for one track, with per-sample sizes and
+// durations in the trun and the first sample flagged as the only sync sample
+func makeFragment(trackID uint32, decodeTime uint64, sizes []uint32, duration uint32) []byte {
+	be32 := func(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+
+	tfhd := append(be32(tfhdDefaultBaseIsMoof), be32(trackID)...)
+	tfdt := binary.BigEndian.AppendUint64([]byte{1, 0, 0, 0}, decodeTime)
+
+	trunBody := func(dataOffset uint32) []byte {
+		b := be32(trunDataOffset | trunFirstSampleFlags | trunSampleDuration | trunSampleSize)
+		b = append(b, be32(uint32(len(sizes)))...)
+		b = append(b, be32(dataOffset)...)
+		b = append(b, be32(0)...) // First sample: sync
+		for _, size := range sizes {
+			b = append(b, be32(duration)...)
+			b = append(b, be32(size)...)
+		}
+		return b
+	}
+	build := func(dataOffset uint32) []byte {
+		traf := makeBox("traf", append(append(makeBox("tfhd", tfhd), makeBox("tfdt", tfdt)...), makeBox("trun", trunBody(dataOffset))...))
+		return makeBox("moof", append(makeBox("mfhd", make([]byte, 8)), traf...))
+	}
+
+	moof := build(0)
+	moof = build(uint32(len(moof) + 8)) // Data starts right after the mdat header
+
+	var data []byte
+	for i, size := range sizes {
+		for j := uint32(0); j < size; j++ {
+			data = append(data, byte(i))
+		}
+	}
+	return append(moof, makeBox("mdat", data)...)
+}
+
+func TestExtractAllTracksFragmented(t *testing.T) {
+	// Init segment: a track with empty sample tables plus mvex/trex defaults
+	// marking samples as non-sync unless overridden
+	empty := syntheticTrack(TrackTypeVideo, 90000, 0, 0, 0)
+	empty.Stsd = append([]byte{0, 0, 0, 0, 0, 0, 0, 1}, makeBox("avc1", make([]byte, 78))...)
+	trak := serializeAtom(makeTrakAtom(empty, 1, nil, false, RemuxOptions{}))
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:16], 1000)
+	trex := binary.BigEndian.AppendUint32(make([]byte, 4), 1)
+	trex = append(trex, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0)
+	trex = binary.BigEndian.AppendUint32(trex, sampleFlagIsNonSync)
+	moov := makeBox("moov", append(append(makeBox("mvhd", mvhd), trak...), makeBox("mvex", makeBox("trex", trex))...))
+
+	file := append(makeBox("ftyp", []byte("iso6\x00\x00\x00\x00iso6")), moov...)
+	firstFrag := len(file)
+	file = append(file, makeFragment(1, 0, []uint32{10, 20, 30}, 3000)...)
+	file = append(file, makeFragment(1, 9000, []uint32{40, 50}, 3000)...)
+
+	f, err := os.CreateTemp(t.TempDir(), "frag.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Write(file)
+
+	atoms, err := FastProbe(f)
+	if err != nil {
+		t.Fatalf("FastProbe failed: %v", err)
+	}
+	tracks, err := NewDemuxer(f).ExtractAllTracks(atoms)
+	if err != nil {
+		t.Fatalf("ExtractAllTracks failed: %v", err)
+	}
+	samples := tracks[0].Samples
+	if len(samples) != 5 {
+		t.Fatalf("Expected 5 fragmented samples, got %d", len(samples))
+	}
+
+	wantSizes := []int64{10, 20, 30, 40, 50}
+	wantKey := []bool{true, false, false, true, false}
+	for i, s := range samples {
+		if s.ID != i+1 || s.Size != wantSizes[i] || s.Duration != 3000 || s.Time != int64(i)*3000 || s.IsKeyframe != wantKey[i] {
+			t.Errorf("sample %d: unexpected %+v", i, s)
+		}
+		buf, err := ReadSample(f, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf[0] != byte(i%3) || buf[len(buf)-1] != byte(i%3) {
+			t.Errorf("sample %d: offset %d does not point at its data", i, s.Offset)
+		}
+	}
+	if samples[0].Offset <= int64(firstFrag) {
+		t.Errorf("Expected first sample inside the first fragment's mdat, got offset %d", samples[0].Offset)
+	}
+}
@@ -0,0 +1,116 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ReadSample reads the raw (still compressed) bytes of a sample
+func ReadSample(r io.ReaderAt, s Sample) ([]byte, error) {
+	buf := make([]byte, s.Size)
+	if _, err := r.ReadAt(buf, s.Offset); err != nil {
+		return nil, fmt.Errorf("reading sample %d (%d bytes @ %d): %w", s.ID, s.Size, s.Offset, err)
+	}
+	return buf, nil
+}
+
+// ExtractFrameRange writes every video sample between start and end (start
+// snapped back to a keyframe, so the sequence is decodable) to numbered files
+// in outDir. The decoder configuration box (avcC/hvcC) is saved next to them
+// so an external tool can rebuild a decodable stream. Returns the number of
+// frames written.
+func ExtractFrameRange(file *os.File, track Track, start, end time.Duration, outDir string) (int, error) {
+	if track.Type != TrackTypeVideo {
+		return 0, fmt.Errorf("frame extraction requires a video track, got %s", track.Type)
+	}
+
+	cut, err := NewMultiTrackCutter([]Track{track}).Cut(start, end)
+	if err != nil {
+		return 0, err
+	}
+	if len(cut) == 0 || len(cut[0].Samples) == 0 {
+		return 0, fmt.Errorf("no frames in range %s - %s", start, end)
+	}
+
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return 0, err
+	}
+
+	for _, box := range []string{"avcC", "hvcC"} {
+		if cfg := findSampleEntryBox(track.Stsd, track.Type, box); cfg != nil {
+			if err := os.WriteFile(filepath.Join(outDir, "config."+box), cfg, 0644); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	for i, s := range cut[0].Samples {
+		data, err := ReadSample(file, s)
+		if err != nil {
+			return i, err
+		}
+		name := filepath.Join(outDir, fmt.Sprintf("frame_%05d.bin", i+1))
+		if err := os.WriteFile(name, data, 0644); err != nil {
+			return i, err
+		}
+	}
+
+	return len(cut[0].Samples), nil
+}
+
+// ExtractKeyframes reads count keyframes spread evenly over the track's
+// duration, e.g. for thumbnail sprite sheets. The k-th pick is the last
+// keyframe presented at or before k/count of the duration, so the first is
+// the track's first keyframe. Picks that land on the same keyframe are
+// returned once: tracks with few keyframes yield fewer than count frames.
+// Returns the raw (still compressed) sample bytes and, in a parallel slice,
+// their presentation times.
+func ExtractKeyframes(file *os.File, track Track, count int) ([][]byte, []time.Duration, error) {
+	if count <= 0 {
+		return nil, nil, fmt.Errorf("keyframe count must be positive, got %d", count)
+	}
+	timescale := int64(track.Timescale)
+	if timescale == 0 {
+		timescale = 1000
+	}
+
+	var keyframes []int
+	for i, s := range track.Samples {
+		if s.IsKeyframe {
+			keyframes = append(keyframes, i)
+		}
+	}
+	if len(keyframes) == 0 {
+		return nil, nil, fmt.Errorf("track %d has no keyframes", track.ID)
+	}
+
+	span := track.MediaDuration() - track.MediaTimeOffset
+	var frames [][]byte
+	var times []time.Duration
+	last := -1
+	for k := 0; k < count; k++ {
+		target := span * int64(k) / int64(count)
+		pick := keyframes[0]
+		for _, i := range keyframes {
+			if track.PresentationTime(i) > target {
+				break
+			}
+			pick = i
+		}
+		if pick == last {
+			continue
+		}
+		last = pick
+
+		data, err := ReadSample(file, track.Samples[pick])
+		if err != nil {
+			return frames, times, err
+		}
+		frames = append(frames, data)
+		times = append(times, unitsToDuration(track.PresentationTime(pick), timescale))
+	}
+	return frames, times, nil
+}
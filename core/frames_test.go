@@ -0,0 +1,46 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestExtractKeyframes(t *testing.T) {
+	// 10s at 10fps, keyframes every 5 samples (every 500ms)
+	track := syntheticTrack(TrackTypeVideo, 1000, 100, 100, 20)
+	src := writeSyntheticSource(t, []Track{track})
+
+	frames, times, err := ExtractKeyframes(src, track, 4)
+	if err != nil {
+		t.Fatalf("ExtractKeyframes failed: %v", err)
+	}
+	want := []time.Duration{0, 2500 * time.Millisecond, 5 * time.Second, 7500 * time.Millisecond}
+	if len(frames) != 4 || len(times) != 4 {
+		t.Fatalf("Expected 4 keyframes, got %d (%v)", len(frames), times)
+	}
+	for k, at := range want {
+		if times[k] != at {
+			t.Errorf("Keyframe %d: expected %s, got %s", k, at, times[k])
+		}
+		si := int(at / (100 * time.Millisecond))
+		if !bytes.Equal(frames[k], samplePattern(0, si, track.Samples[si].Size)) {
+			t.Errorf("Keyframe %d: bytes are not those of sample %d", k, si+1)
+		}
+	}
+
+	// More picks than keyframes: each keyframe is returned once
+	if frames, _, err := ExtractKeyframes(src, track, 50); err != nil || len(frames) != 20 {
+		t.Errorf("Expected the 20 keyframes once each, got %d (%v)", len(frames), err)
+	}
+	if _, _, err := ExtractKeyframes(src, track, 0); err == nil {
+		t.Error("Expected an error for a zero count")
+	}
+
+	// 10 MHz timescale, 400s samples: the keyframe at 2000s must not wrap
+	long := syntheticTrack(TrackTypeVideo, 10000000, 10, 4000000000, 20)
+	longSrc := writeSyntheticSource(t, []Track{long})
+	if _, times, err := ExtractKeyframes(longSrc, long, 2); err != nil || len(times) != 2 || times[1] != 2000*time.Second {
+		t.Errorf("Expected keyframes at 0s and 2000s, got %v (%v)", times, err)
+	}
+}
@@ -53,6 +53,14 @@ import (
 	"unsafe"
 )
 
+// Codec tags NVENC can process
+var nvencCodecs = map[string]bool{
+	"avc1": true,
+	"avc3": true,
+	"hvc1": true,
+	"hev1": true,
+}
+
 type NvenCTranscoder struct {
 	handle unsafe.Pointer
 }
@@ -82,6 +90,11 @@ func NewNVENCTranscoder() (core.Transcoder, error) {
 }
 
 func (n *NvenCTranscoder) Transcode(gop *core.GOP) ([]byte, error) {
+	// NVENC only handles H.264/HEVC video
+	if gop.CodecTag != "" && !nvencCodecs[gop.CodecTag] {
+		return nil, &core.UnsupportedCodecError{CodecTag: gop.CodecTag, TrackType: gop.TrackType}
+	}
+
 	// Simulate encoding needed for this GOP
 	// Ideally we loop over samples, decode them (not implemented) and encode.
 	// Here we just call the Encode API mock for each sample.
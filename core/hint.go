@@ -0,0 +1,92 @@
+package core
+
+import (
+	"encoding/binary"
+	"strings"
+)
+
+// Fixed fields of an RTP/SRTP hint sample entry: SampleEntry, then
+// hinttrackversion(2) + highestcompatibleversion(2) + maxpacketsize(4)
+const hintSampleEntrySize = sampleEntryHeaderSize + 8
+
+// HintInfo describes a hint track ('rtp ', 'srtp' or 'rrtp' sample entry):
+// what it packetizes and which media track it was built from
+type HintInfo struct {
+	Format         string // Sample entry type, e.g. "rtp "
+	MaxPacketSize  uint32
+	Timescale      uint32   // RTP timescale from the 'tims' box, 0 if absent
+	HintedTrackIDs []uint32 // Media tracks referenced by tref/hint
+	Payload        string   // RTP payload from the SDP rtpmap, e.g. "H264/90000"
+}
+
+// parseHintSampleEntry reads the first sample entry of a hint track's stsd
+func parseHintSampleEntry(stsd []byte) (HintInfo, bool) {
+	var info HintInfo
+	entry := firstSampleEntry(stsd)
+	if len(entry) < hintSampleEntrySize {
+		return info, false
+	}
+	info.Format = string(entry[4:8])
+	info.MaxPacketSize = binary.BigEndian.Uint32(entry[20:24])
+	if tims := findBox(entry[hintSampleEntrySize:], "tims"); len(tims) >= 4 {
+		info.Timescale = binary.BigEndian.Uint32(tims[0:4])
+	}
+	return info, true
+}
+
+// parseTrefIDs returns the track IDs of the given reference type in a tref payload
+func parseTrefIDs(tref []byte, refType string) []uint32 {
+	ref := findBox(tref, refType)
+	ids := make([]uint32, 0, len(ref)/4)
+	for pos := 0; pos+4 <= len(ref); pos += 4 {
+		ids = append(ids, binary.BigEndian.Uint32(ref[pos:pos+4]))
+	}
+	return ids
+}
+
+// sdpPayload extracts the encoding from the first "a=rtpmap:<pt> <encoding>"
+// line of an SDP fragment
+func sdpPayload(sdp string) string {
+	for _, line := range strings.Split(sdp, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "a=rtpmap:") {
+			continue
+		}
+		if fields := strings.Fields(strings.TrimPrefix(line, "a=rtpmap:")); len(fields) >= 2 {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// parseHintInfo gathers the hint description of a hint trak: sample entry,
+// tref/hint references and the track SDP (udta/hnti/sdp)
+func (d *Demuxer) parseHintInfo(trak Atom, stsd []byte) *HintInfo {
+	info, ok := parseHintSampleEntry(stsd)
+	if !ok {
+		return nil
+	}
+	if tref := findChildPath(trak, "tref"); tref != nil {
+		info.HintedTrackIDs = parseTrefIDs(d.readPayload(tref), "hint")
+	}
+	if udta := findChildPath(trak, "udta"); udta != nil {
+		if hnti := findChildPath(*udta, "hnti"); hnti != nil {
+			if sdp := findBox(d.readPayload(hnti), "sdp "); sdp != nil {
+				info.Payload = sdpPayload(string(sdp))
+			}
+		}
+	}
+	return &info
+}
+
+// DropHintTracks returns tracks without hint tracks. Hint samples address
+// media samples by number, so they are invalid once the media is cut.
+func DropHintTracks(tracks []Track) []Track {
+	var kept []Track
+	for _, t := range tracks {
+		if t.Type != TrackTypeHint {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
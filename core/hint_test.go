@@ -0,0 +1,42 @@
+package core
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestParseHintSampleEntry(t *testing.T) {
+	fields := make([]byte, 16)
+	binary.BigEndian.PutUint16(fields[6:8], 1)      // data_reference_index
+	binary.BigEndian.PutUint16(fields[8:10], 1)     // hinttrackversion
+	binary.BigEndian.PutUint16(fields[10:12], 1)    // highestcompatibleversion
+	binary.BigEndian.PutUint32(fields[12:16], 1450) // maxpacketsize
+	fields = append(fields, makeBox("tims", []byte{0, 1, 0x5F, 0x90})...)
+	stsd := append([]byte{0, 0, 0, 0, 0, 0, 0, 1}, makeBox("rtp ", fields)...)
+
+	info, ok := parseHintSampleEntry(stsd)
+	if !ok {
+		t.Fatal("Expected rtp hint sample entry to parse")
+	}
+	if info.Format != "rtp " || info.MaxPacketSize != 1450 || info.Timescale != 90000 {
+		t.Errorf("Unexpected hint info %+v", info)
+	}
+
+	tref := makeBox("hint", []byte{0, 0, 0, 1, 0, 0, 0, 3})
+	if ids := parseTrefIDs(tref, "hint"); len(ids) != 2 || ids[0] != 1 || ids[1] != 3 {
+		t.Errorf("Expected hinted tracks [1 3], got %v", ids)
+	}
+
+	sdp := "m=video 0 RTP/AVP 96\r\nb=AS:512\r\na=rtpmap:96 H264/90000\r\na=control:trackID=3\r\n"
+	if got := sdpPayload(sdp); got != "H264/90000" {
+		t.Errorf("Expected payload H264/90000, got %q", got)
+	}
+}
+
+func TestDropHintTracks(t *testing.T) {
+	tracks := []Track{{Type: TrackTypeVideo}, {Type: TrackTypeHint}, {Type: TrackTypeAudio}, {Type: TrackTypeHint}}
+	kept := DropHintTracks(tracks)
+	if len(kept) != 2 || kept[0].Type != TrackTypeVideo || kept[1].Type != TrackTypeAudio {
+		t.Errorf("Expected only video and audio to remain, got %v", kept)
+	}
+}
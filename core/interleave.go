@@ -0,0 +1,92 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Byte distance between consecutive audio/video reads above which a player
+// has to buffer (or seek) more than a typical progressive download window.
+const interleaveGapThreshold = 1 << 20 // 1 MiB
+
+// InterleaveReport summarizes how well audio and video samples are interleaved
+// in the source's mdat, measured in playback order.
+type InterleaveReport struct {
+	Transitions int   // Audio<->video switches in playback order
+	MaxGap      int64 // Largest byte distance across a switch
+	MaxGapTime  float64
+	PoorCount   int // Switches whose gap exceeds interleaveGapThreshold
+	Score       int // 0-100, percentage of switches within the threshold
+}
+
+// NeedsRemux reports whether the layout is poor enough to recommend a remux
+func (r InterleaveReport) NeedsRemux() bool {
+	return r.Transitions > 0 && (r.Score < 90 || r.MaxGap > 4*interleaveGapThreshold)
+}
+
+func (r InterleaveReport) String() string {
+	if r.Transitions == 0 {
+		return "no audio/video transitions"
+	}
+	return fmt.Sprintf("score %d/100, max gap %d bytes @ %.3fs (%d of %d switches over %d bytes)",
+		r.Score, r.MaxGap, r.MaxGapTime, r.PoorCount, r.Transitions, interleaveGapThreshold)
+}
+
+// AnalyzeInterleave walks the audio and video samples of tracks in playback
+// order and measures the byte distance a reader must cover each time it
+// switches from one track to the other. Other track types are ignored.
+func AnalyzeInterleave(tracks []Track) InterleaveReport {
+	type entry struct {
+		track  int
+		time   float64
+		offset int64
+		size   int64
+	}
+
+	var all []entry
+	for ti, t := range tracks {
+		if t.Type != TrackTypeVideo && t.Type != TrackTypeAudio {
+			continue
+		}
+		ts := float64(t.Timescale)
+		if ts == 0 {
+			ts = 1000
+		}
+		for _, s := range t.Samples {
+			all = append(all, entry{track: ti, time: float64(s.Time) / ts, offset: s.Offset, size: s.Size})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].time < all[j].time
+	})
+
+	var r InterleaveReport
+	for i := 1; i < len(all); i++ {
+		prev, cur := all[i-1], all[i]
+		if prev.track == cur.track {
+			continue
+		}
+		r.Transitions++
+
+		// Distance from the end of the previous read to the next sample
+		gap := cur.offset - (prev.offset + prev.size)
+		if gap < 0 {
+			gap = prev.offset - (cur.offset + cur.size)
+			if gap < 0 {
+				gap = 0 // Overlapping or adjacent
+			}
+		}
+		if gap > r.MaxGap {
+			r.MaxGap = gap
+			r.MaxGapTime = cur.time
+		}
+		if gap > interleaveGapThreshold {
+			r.PoorCount++
+		}
+	}
+
+	if r.Transitions > 0 {
+		r.Score = 100 * (r.Transitions - r.PoorCount) / r.Transitions
+	}
+	return r
+}
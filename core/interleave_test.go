@@ -0,0 +1,38 @@
+package core
+
+import "testing"
+
+func TestAnalyzeInterleave(t *testing.T) {
+	video := syntheticTrack(TrackTypeVideo, 30000, 30, 1001, 1000)
+	audio := syntheticTrack(TrackTypeAudio, 48000, 47, 1024, 100)
+
+	// Interleaved: offsets follow playback order
+	tracks := []Track{video, audio}
+	order := buildInterleavedOrder(tracks, RemuxOptions{})
+	offset := int64(0)
+	for _, is := range order {
+		s := &tracks[is.TrackIndex].Samples[is.SampleIndex]
+		s.Offset = offset
+		offset += s.Size
+	}
+	good := AnalyzeInterleave(tracks)
+	if good.Transitions == 0 || good.Score != 100 || good.NeedsRemux() {
+		t.Errorf("Expected a clean interleave report, got %+v", good)
+	}
+
+	// Not interleaved: all video, then all audio 8 MiB later
+	offset = 0
+	for i := range tracks[0].Samples {
+		tracks[0].Samples[i].Offset = offset
+		offset += tracks[0].Samples[i].Size
+	}
+	offset += 8 << 20
+	for i := range tracks[1].Samples {
+		tracks[1].Samples[i].Offset = offset
+		offset += tracks[1].Samples[i].Size
+	}
+	bad := AnalyzeInterleave(tracks)
+	if !bad.NeedsRemux() || bad.MaxGap < 8<<20 {
+		t.Errorf("Expected a poor interleave report, got %+v", bad)
+	}
+}
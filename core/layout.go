@@ -0,0 +1,57 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+)
+
+// LayoutIssue describes a sample whose byte range conflicts with another
+// sample of the same track, as found by ValidateSampleLayout
+type LayoutIssue struct {
+	SampleIndex int    // 0-based index into Track.Samples
+	OtherIndex  int    // The sample it collides with or follows
+	Kind        string // "duplicate", "overlap" or "gap"
+	Bytes       int64  // Overlapping or missing byte count
+}
+
+func (i LayoutIssue) String() string {
+	switch i.Kind {
+	case "duplicate":
+		return fmt.Sprintf("sample %d has the same offset as sample %d", i.SampleIndex, i.OtherIndex)
+	case "gap":
+		return fmt.Sprintf("sample %d starts %d bytes after sample %d in the same chunk", i.SampleIndex, i.Bytes, i.OtherIndex)
+	}
+	return fmt.Sprintf("sample %d overlaps sample %d by %d bytes", i.SampleIndex, i.OtherIndex, i.Bytes)
+}
+
+// ValidateSampleLayout sorts the track's sample byte ranges and reports
+// samples that share an offset or overlap, which points at a damaged chunk
+// offset table. Gaps between samples are normal (other tracks are interleaved
+// in between) and only reported inside a single chunk, where samples must be
+// contiguous.
+func (t Track) ValidateSampleLayout() []LayoutIssue {
+	order := make([]int, len(t.Samples))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return t.Samples[order[a]].Offset < t.Samples[order[b]].Offset
+	})
+
+	var issues []LayoutIssue
+	for k := 1; k < len(order); k++ {
+		prevIdx, curIdx := order[k-1], order[k]
+		prev, cur := t.Samples[prevIdx], t.Samples[curIdx]
+		prevEnd := prev.Offset + prev.Size
+
+		switch {
+		case cur.Offset == prev.Offset:
+			issues = append(issues, LayoutIssue{SampleIndex: curIdx, OtherIndex: prevIdx, Kind: "duplicate", Bytes: min(prev.Size, cur.Size)})
+		case cur.Offset < prevEnd:
+			issues = append(issues, LayoutIssue{SampleIndex: curIdx, OtherIndex: prevIdx, Kind: "overlap", Bytes: prevEnd - cur.Offset})
+		case cur.Offset > prevEnd && cur.Chunk != 0 && cur.Chunk == prev.Chunk && curIdx == prevIdx+1:
+			issues = append(issues, LayoutIssue{SampleIndex: curIdx, OtherIndex: prevIdx, Kind: "gap", Bytes: cur.Offset - prevEnd})
+		}
+	}
+	return issues
+}
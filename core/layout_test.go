@@ -0,0 +1,36 @@
+package core
+
+import "testing"
+
+func TestValidateSampleLayout(t *testing.T) {
+	track := syntheticTrack(TrackTypeAudio, 1000, 6, 100, 10)
+	// Two chunks of three contiguous samples
+	offsets := []int64{0, 10, 20, 100, 110, 120}
+	for i := range track.Samples {
+		track.Samples[i].Size = 10
+		track.Samples[i].Offset = offsets[i]
+		track.Samples[i].Chunk = i/3 + 1
+	}
+	if issues := track.ValidateSampleLayout(); len(issues) != 0 {
+		t.Fatalf("Expected a clean layout, got %v", issues)
+	}
+
+	track.Samples[2].Offset = 15  // Overlaps sample 1 by 5 bytes
+	track.Samples[4].Offset = 100 // Same offset as sample 3
+	track.Samples[5].Offset = 130 // Hole inside chunk 2
+	issues := track.ValidateSampleLayout()
+
+	kinds := map[string]LayoutIssue{}
+	for _, issue := range issues {
+		kinds[issue.Kind] = issue
+	}
+	if o, ok := kinds["overlap"]; !ok || o.SampleIndex != 2 || o.OtherIndex != 1 || o.Bytes != 5 {
+		t.Errorf("Expected sample 2 to overlap sample 1 by 5 bytes, got %v", issues)
+	}
+	if d, ok := kinds["duplicate"]; !ok || d.SampleIndex != 4 || d.OtherIndex != 3 {
+		t.Errorf("Expected sample 4 to duplicate sample 3, got %v", issues)
+	}
+	if g, ok := kinds["gap"]; !ok || g.SampleIndex != 5 || g.Bytes != 20 {
+		t.Errorf("Expected a 20-byte gap before sample 5, got %v", issues)
+	}
+}
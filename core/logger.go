@@ -0,0 +1,28 @@
+package core
+
+import "fmt"
+
+// Logger receives the library's diagnostic messages. *log.Logger satisfies
+// it, so embedders can redirect, prefix or translate output.
+type Logger interface {
+	Printf(format string, v ...any)
+}
+
+type stdoutLogger struct{}
+
+func (stdoutLogger) Printf(format string, v ...any) { fmt.Printf(format, v...) }
+
+type discardLogger struct{}
+
+func (discardLogger) Printf(string, ...any) {}
+
+// DiscardLogger drops every message; use it to silence library output
+var DiscardLogger Logger = discardLogger{}
+
+// loggerOr returns l, or the default stdout logger when l is nil
+func loggerOr(l Logger) Logger {
+	if l == nil {
+		return stdoutLogger{}
+	}
+	return l
+}
@@ -0,0 +1,120 @@
+package core
+
+import "fmt"
+
+// DownmixPair matches a sample of the primary audio track with the sample of
+// the secondary track playing at the same time. Index -1 means no sample.
+type DownmixPair struct {
+	PrimaryIndex   int
+	SecondaryIndex int
+	TimeSeconds    float64 // Start of the primary sample
+	OffsetSeconds  float64 // Secondary sample start relative to the primary one
+}
+
+// PlanDownmix pairs the samples of two audio tracks by presentation time, as
+// the input for an external mixer combining them (e.g. L/R or commentary
+// into stereo). No audio is decoded; only the time alignment is computed.
+func PlanDownmix(primary, secondary Track) ([]DownmixPair, error) {
+	if primary.Type != TrackTypeAudio || secondary.Type != TrackTypeAudio {
+		return nil, fmt.Errorf("downmix requires two audio tracks, got %s and %s", primary.Type, secondary.Type)
+	}
+
+	primTS := float64(primary.Timescale)
+	if primTS == 0 {
+		primTS = 1000
+	}
+	secTS := float64(secondary.Timescale)
+	if secTS == 0 {
+		secTS = 1000
+	}
+
+	// Sweep both timelines, keeping j on the secondary sample that is
+	// playing when the current primary sample starts.
+	var pairs []DownmixPair
+	j := -1
+	for i, p := range primary.Samples {
+		t := float64(p.Time) / primTS
+		for j+1 < len(secondary.Samples) && float64(secondary.Samples[j+1].Time)/secTS <= t {
+			j++
+		}
+
+		pair := DownmixPair{PrimaryIndex: i, SecondaryIndex: -1, TimeSeconds: t}
+		if j >= 0 {
+			s := secondary.Samples[j]
+			start := float64(s.Time) / secTS
+			end := float64(s.Time+s.Duration) / secTS
+			if t < end {
+				pair.SecondaryIndex = j
+				pair.OffsetSeconds = start - t
+			}
+		}
+		pairs = append(pairs, pair)
+	}
+
+	return pairs, nil
+}
+
+// FadeSample describes the gain ramp an external mixer should apply across
+// one audio sample (access unit). Gains are linear, 0 = silent, 1 = unity.
+type FadeSample struct {
+	SampleIndex int // 0-based index into the cut track's Samples
+	GainStart   float64
+	GainEnd     float64
+}
+
+// FadePlan lists the samples to fade in at the start of a cut and out at its
+// end, so the boundaries don't click
+type FadePlan struct {
+	FadeIn  []FadeSample
+	FadeOut []FadeSample
+}
+
+// PlanFades builds a linear fade-in over the first n samples and a fade-out
+// over the last n samples of a cut audio track. The envelope follows the
+// samples' actual durations, so it is sample-exact even with variable frame
+// sizes. If the track has fewer than 2n samples, n is halved to fit.
+// The package does no DSP; apply the gains while decoding.
+func PlanFades(track Track, n int) (FadePlan, error) {
+	var plan FadePlan
+	if track.Type != TrackTypeAudio {
+		return plan, fmt.Errorf("fade plan requires an audio track, got %s", track.Type)
+	}
+	if n > len(track.Samples)/2 {
+		n = len(track.Samples) / 2
+	}
+	if n <= 0 {
+		return plan, nil
+	}
+
+	ramp := func(indices []int, rising bool) []FadeSample {
+		total := int64(0)
+		for _, i := range indices {
+			total += track.Samples[i].Duration
+		}
+		if total == 0 {
+			total = 1
+		}
+		out := make([]FadeSample, 0, len(indices))
+		elapsed := int64(0)
+		for _, i := range indices {
+			g0 := float64(elapsed) / float64(total)
+			elapsed += track.Samples[i].Duration
+			g1 := float64(elapsed) / float64(total)
+			if !rising {
+				g0, g1 = 1-g0, 1-g1
+			}
+			out = append(out, FadeSample{SampleIndex: i, GainStart: g0, GainEnd: g1})
+		}
+		return out
+	}
+
+	head := make([]int, n)
+	tail := make([]int, n)
+	for k := 0; k < n; k++ {
+		head[k] = k
+		tail[k] = len(track.Samples) - n + k
+	}
+	plan.FadeIn = ramp(head, true)
+	plan.FadeOut = ramp(tail, false)
+	return plan, nil
+}
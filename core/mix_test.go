@@ -0,0 +1,60 @@
+package core
+
+import "testing"
+
+func TestPlanDownmixPairsByTime(t *testing.T) {
+	left := syntheticTrack(TrackTypeAudio, 48000, 4, 1024, 10)
+	right := syntheticTrack(TrackTypeAudio, 44100, 3, 1024, 10)
+
+	pairs, err := PlanDownmix(left, right)
+	if err != nil {
+		t.Fatalf("PlanDownmix failed: %v", err)
+	}
+	if len(pairs) != 4 {
+		t.Fatalf("Expected one pair per primary sample, got %d", len(pairs))
+	}
+	// 48k sample 3 starts at 64ms; 44.1k sample 2 covers 46.4ms..69.7ms
+	want := []int{0, 0, 1, 2}
+	for i, p := range pairs {
+		if p.SecondaryIndex != want[i] {
+			t.Errorf("pair %d: expected secondary %d, got %d", i, want[i], p.SecondaryIndex)
+		}
+	}
+
+	if _, err := PlanDownmix(left, syntheticTrack(TrackTypeVideo, 30000, 1, 1001, 10)); err == nil {
+		t.Error("Expected an error when pairing with a video track")
+	}
+}
+
+func TestPlanFades(t *testing.T) {
+	track := syntheticTrack(TrackTypeAudio, 48000, 10, 1024, 10)
+	track.Samples[1].Duration = 2048 // Variable frame size
+
+	plan, err := PlanFades(track, 3)
+	if err != nil {
+		t.Fatalf("PlanFades failed: %v", err)
+	}
+	if len(plan.FadeIn) != 3 || len(plan.FadeOut) != 3 {
+		t.Fatalf("Expected 3 samples per fade, got %d/%d", len(plan.FadeIn), len(plan.FadeOut))
+	}
+
+	// Fade in over 1024+2048+1024 units: 0 → 0.25 → 0.75 → 1
+	in := plan.FadeIn
+	if in[0].GainStart != 0 || in[0].GainEnd != 0.25 || in[1].GainEnd != 0.75 || in[2].GainEnd != 1 {
+		t.Errorf("Unexpected fade-in envelope %+v", in)
+	}
+	out := plan.FadeOut
+	if out[0].SampleIndex != 7 || out[0].GainStart != 1 || out[2].GainEnd != 0 {
+		t.Errorf("Unexpected fade-out envelope %+v", out)
+	}
+
+	// Short tracks get a shorter fade
+	short := syntheticTrack(TrackTypeAudio, 48000, 3, 1024, 10)
+	if plan, _ := PlanFades(short, 5); len(plan.FadeIn) != 1 {
+		t.Errorf("Expected fade clamped to 1 sample, got %d", len(plan.FadeIn))
+	}
+
+	if _, err := PlanFades(syntheticTrack(TrackTypeVideo, 30000, 10, 1001, 10), 2); err == nil {
+		t.Error("Expected an error for a video track")
+	}
+}
@@ -0,0 +1,353 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Movie holds file-level metadata gathered from the top-level atoms
+type Movie struct {
+	// File type (ftyp)
+	FtypInfo
+
+	// Movie header (mvhd)
+	Timescale uint32
+	Duration  uint64 // In movie timescale units
+	Matrix    []byte // 36-byte display matrix (nil if mvhd is too short)
+
+	// mvhd creation/modification times (zero when unset in the file)
+	CreationTime     time.Time
+	ModificationTime time.Time
+
+	// HasMvex is set when moov declares movie fragments (mvex)
+	HasMvex bool
+
+	// Total fragment duration from mvex/mehd (fragmented files only, 0 if absent)
+	FragmentDuration uint64
+
+	// DRM systems declared by pssh boxes in moov or moof
+	ProtectionSystems []ProtectionSystem
+
+	// Producer reference times (prft) of live/fragmented files, in file order
+	ProducerTimes []ProducerReferenceTime
+}
+
+// FtypInfo is the parsed payload of an 'ftyp' (File Type) atom
+type FtypInfo struct {
+	MajorBrand       string
+	MinorVersion     uint32
+	CompatibleBrands []string
+}
+
+// IsQuickTime reports whether the file declares itself as a QuickTime movie
+func (f FtypInfo) IsQuickTime() bool {
+	return f.MajorBrand == "qt  "
+}
+
+// fragmentBrands are the brands that promise a fragmented (DASH/CMAF) layout.
+// iso6 is a general ISO BMFF brand, so it is kept.
+var fragmentBrands = map[string]bool{"dash": true, "msdh": true, "msix": true, "cmfc": true}
+
+// WithoutFragmentBrands returns a copy without the fragmented-file brands, for
+// writing a progressive file with the source's remaining brands. A fragmented
+// major brand is replaced by the first remaining compatible brand, or "isom".
+func (f FtypInfo) WithoutFragmentBrands() FtypInfo {
+	out := FtypInfo{MajorBrand: f.MajorBrand, MinorVersion: f.MinorVersion}
+	for _, brand := range f.CompatibleBrands {
+		if !fragmentBrands[brand] {
+			out.CompatibleBrands = append(out.CompatibleBrands, brand)
+		}
+	}
+	if fragmentBrands[out.MajorBrand] {
+		out.MajorBrand, out.MinorVersion = "isom", 0
+		if len(out.CompatibleBrands) > 0 {
+			out.MajorBrand = out.CompatibleBrands[0]
+		}
+	}
+	return out
+}
+
+// ProducerReferenceTime is a parsed 'prft' box: it ties a media time of the
+// reference track to the wall-clock (NTP) time at which it was produced.
+type ProducerReferenceTime struct {
+	Offset         int64 // File offset of the prft box (precedes its moof)
+	ReferenceTrack uint32
+	NTPTimestamp   uint64 // 32.32 fixed point seconds since 1900-01-01 UTC
+	MediaTime      uint64 // In the reference track's media timescale
+}
+
+// Seconds between the NTP epoch (1900) and the Unix epoch (1970)
+const ntpUnixOffset = 2208988800
+
+// Seconds between the MP4 epoch (1904-01-01 UTC) used by mvhd/tkhd/mdhd
+// times and the Unix epoch
+const mp4UnixOffset = 2082844800
+
+// fromMP4Time converts seconds since 1904 to a time.Time; 0 (unset) gives
+// the zero time
+func fromMP4Time(secs uint64) time.Time {
+	if secs == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(secs)-mp4UnixOffset, 0).UTC()
+}
+
+// toMP4Time converts t to seconds since 1904; the zero time and times
+// before 1904 give 0 (unset)
+func toMP4Time(t time.Time) uint64 {
+	if t.IsZero() || t.Unix() < -mp4UnixOffset {
+		return 0
+	}
+	return uint64(t.Unix() + mp4UnixOffset)
+}
+
+// headerTimestamps reads creation_time and modification_time from an
+// mvhd/tkhd/mdhd payload: 32-bit fields in version 0, 64-bit in version 1
+func headerTimestamps(p []byte) (creation, modification time.Time) {
+	if len(p) >= 20 && p[0] == 1 {
+		return fromMP4Time(binary.BigEndian.Uint64(p[4:12])), fromMP4Time(binary.BigEndian.Uint64(p[12:20]))
+	}
+	if len(p) >= 12 && p[0] == 0 {
+		return fromMP4Time(uint64(binary.BigEndian.Uint32(p[4:8]))), fromMP4Time(uint64(binary.BigEndian.Uint32(p[8:12])))
+	}
+	return time.Time{}, time.Time{}
+}
+
+// WallClock converts the NTP timestamp to a time.Time
+func (p ProducerReferenceTime) WallClock() time.Time {
+	secs := int64(p.NTPTimestamp>>32) - ntpUnixOffset
+	frac := p.NTPTimestamp & 0xFFFFFFFF
+	nanos := int64((frac * uint64(time.Second)) >> 32)
+	return time.Unix(secs, nanos).UTC()
+}
+
+// IsFragmented reports whether the movie declares movie fragments (mvex).
+// mehd is optional, so this does not imply a known FragmentDuration.
+func (m Movie) IsFragmented() bool {
+	return m.HasMvex
+}
+
+// DurationSeconds returns the movie duration, preferring the mehd fragment
+// duration for fragmented files (where mvhd usually only covers the moov samples)
+func (m Movie) DurationSeconds() float64 {
+	if m.Timescale == 0 {
+		return 0
+	}
+	if m.FragmentDuration > 0 {
+		return float64(m.FragmentDuration) / float64(m.Timescale)
+	}
+	return float64(m.Duration) / float64(m.Timescale)
+}
+
+// ProtectionSystem is a parsed 'pssh' (Protection System Specific Header) box
+type ProtectionSystem struct {
+	SystemID [16]byte
+	Name     string     // Well-known system name, or "unknown"
+	KeyIDs   [][16]byte // Only present in version 1 boxes
+	DataSize uint32
+}
+
+// Well-known DRM system IDs
+var knownSystemIDs = map[string]string{
+	"edef8ba979d64acea3c827dcd51d21ed": "Widevine",
+	"9a04f07998404286ab92e65be0885f95": "PlayReady",
+	"94ce86fb07ff4f43adb893d2fa968ca2": "FairPlay",
+	"1077efecc0b24d02ace33c1e52e2fb4b": "ClearKey",
+}
+
+// SystemIDString returns the system ID as a UUID string
+func (p ProtectionSystem) SystemIDString() string {
+	id := p.SystemID
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16])
+}
+
+// ParseMovie collects movie-level metadata from the probed atom tree
+func (d *Demuxer) ParseMovie(atoms []Atom) (*Movie, error) {
+	movie := &Movie{}
+
+	for _, top := range atoms {
+		if top.Type == "ftyp" {
+			ftyp, err := d.ParseFtyp(top)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse ftyp: %w", err)
+			}
+			movie.FtypInfo = ftyp
+			continue
+		}
+		if top.Type == "prft" {
+			prft, err := d.ParsePrft(top)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse prft @ %d: %w", top.Offset, err)
+			}
+			movie.ProducerTimes = append(movie.ProducerTimes, prft)
+			continue
+		}
+		if top.Type != "moov" && top.Type != "moof" {
+			continue
+		}
+		for _, child := range top.Children {
+			switch child.Type {
+			case "mvhd":
+				// mvhd starts with the same fields as mdhd (times, timescale, duration)
+				timescale, duration, _, err := d.ParseMdhd(child)
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse mvhd: %w", err)
+				}
+				movie.Timescale = timescale
+				movie.Duration = duration
+				payload := d.readPayload(&child)
+				movie.Matrix = mvhdMatrix(payload)
+				movie.CreationTime, movie.ModificationTime = headerTimestamps(payload)
+			case "mvex":
+				movie.HasMvex = true
+				if mehd := findChildPath(child, "mehd"); mehd != nil {
+					dur, err := d.ParseMehd(*mehd)
+					if err != nil {
+						return nil, fmt.Errorf("failed to parse mehd: %w", err)
+					}
+					movie.FragmentDuration = dur
+				}
+			case "pssh":
+				ps, err := d.ParsePssh(child)
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse pssh @ %d: %w", child.Offset, err)
+				}
+				movie.ProtectionSystems = append(movie.ProtectionSystems, ps)
+			}
+		}
+	}
+
+	return movie, nil
+}
+
+// mvhdMatrix returns the display matrix of an mvhd payload: after the
+// times, timescale and duration (20 bytes in v0, 32 in v1), rate(4),
+// volume(2) and reserved(10)
+func mvhdMatrix(p []byte) []byte {
+	if len(p) < 4 {
+		return nil
+	}
+	start := 36
+	if p[0] == 1 {
+		start = 48
+	}
+	if len(p) < start+36 {
+		return nil
+	}
+	return append([]byte(nil), p[start:start+36]...)
+}
+
+// ParseFtyp parses a File Type atom: major_brand, minor_version, then
+// compatible brands up to the end of the box
+func (d *Demuxer) ParseFtyp(atom Atom) (FtypInfo, error) {
+	var info FtypInfo
+	if atom.Size < 16 {
+		return info, fmt.Errorf("ftyp too small (%d bytes)", atom.Size)
+	}
+	payload := d.readPayload(&atom)
+	if len(payload) < 8 {
+		return info, fmt.Errorf("ftyp payload truncated")
+	}
+	info.MajorBrand = string(payload[0:4])
+	info.MinorVersion = binary.BigEndian.Uint32(payload[4:8])
+	for pos := 8; pos+4 <= len(payload); pos += 4 {
+		info.CompatibleBrands = append(info.CompatibleBrands, string(payload[pos:pos+4]))
+	}
+	return info, nil
+}
+
+// ParseMehd parses the Movie Extends Header (total fragment duration in movie timescale)
+func (d *Demuxer) ParseMehd(atom Atom) (uint64, error) {
+	if _, err := d.file.Seek(atom.Offset+8, io.SeekStart); err != nil {
+		return 0, err
+	}
+	version, _, err := readFullBoxHeader(d.file)
+	if err != nil {
+		return 0, err
+	}
+
+	if version == 1 {
+		var dur uint64
+		if err := binary.Read(d.file, binary.BigEndian, &dur); err != nil {
+			return 0, err
+		}
+		return dur, nil
+	}
+	var dur32 uint32
+	if err := binary.Read(d.file, binary.BigEndian, &dur32); err != nil {
+		return 0, err
+	}
+	return uint64(dur32), nil
+}
+
+// ParsePrft parses a Producer Reference Time box
+func (d *Demuxer) ParsePrft(atom Atom) (ProducerReferenceTime, error) {
+	prft := ProducerReferenceTime{Offset: atom.Offset}
+	if _, err := d.file.Seek(atom.Offset+8, io.SeekStart); err != nil {
+		return prft, err
+	}
+	version, _, err := readFullBoxHeader(d.file)
+	if err != nil {
+		return prft, err
+	}
+
+	if err := binary.Read(d.file, binary.BigEndian, &prft.ReferenceTrack); err != nil {
+		return prft, err
+	}
+	if err := binary.Read(d.file, binary.BigEndian, &prft.NTPTimestamp); err != nil {
+		return prft, err
+	}
+	if version == 0 {
+		var mt32 uint32
+		if err := binary.Read(d.file, binary.BigEndian, &mt32); err != nil {
+			return prft, err
+		}
+		prft.MediaTime = uint64(mt32)
+	} else if err := binary.Read(d.file, binary.BigEndian, &prft.MediaTime); err != nil {
+		return prft, err
+	}
+	return prft, nil
+}
+
+// ParsePssh parses a Protection System Specific Header box (identification only)
+func (d *Demuxer) ParsePssh(atom Atom) (ProtectionSystem, error) {
+	var ps ProtectionSystem
+	if _, err := d.file.Seek(atom.Offset+8, io.SeekStart); err != nil {
+		return ps, err
+	}
+	version, _, err := readFullBoxHeader(d.file)
+	if err != nil {
+		return ps, err
+	}
+
+	if _, err := io.ReadFull(d.file, ps.SystemID[:]); err != nil {
+		return ps, err
+	}
+	ps.Name = "unknown"
+	if name, ok := knownSystemIDs[fmt.Sprintf("%x", ps.SystemID)]; ok {
+		ps.Name = name
+	}
+
+	if version > 0 {
+		var kidCount uint32
+		if err := binary.Read(d.file, binary.BigEndian, &kidCount); err != nil {
+			return ps, err
+		}
+		if int64(kidCount)*16 > atom.Size {
+			return ps, fmt.Errorf("pssh declares %d key IDs, exceeds box size %d", kidCount, atom.Size)
+		}
+		ps.KeyIDs = make([][16]byte, kidCount)
+		for i := range ps.KeyIDs {
+			if _, err := io.ReadFull(d.file, ps.KeyIDs[i][:]); err != nil {
+				return ps, err
+			}
+		}
+	}
+
+	if err := binary.Read(d.file, binary.BigEndian, &ps.DataSize); err != nil {
+		return ps, err
+	}
+	return ps, nil
+}
@@ -0,0 +1,176 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseMovieProtectionSystems(t *testing.T) {
+	widevine, _ := hex.DecodeString("edef8ba979d64acea3c827dcd51d21ed")
+	payload := append([]byte{0, 0, 0, 0}, widevine...)
+	payload = append(payload, 0, 0, 0, 2, 0xAB, 0xCD) // DataSize + Data
+	moov := makeBox("moov", append(makeBox("mvhd", make([]byte, 100)), makeBox("pssh", payload)...))
+
+	f, err := os.CreateTemp(t.TempDir(), "drm.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Write(moov)
+
+	atoms, err := FastProbe(f)
+	if err != nil {
+		t.Fatalf("FastProbe failed: %v", err)
+	}
+	movie, err := NewDemuxer(f).ParseMovie(atoms)
+	if err != nil {
+		t.Fatalf("ParseMovie failed: %v", err)
+	}
+	if len(movie.ProtectionSystems) != 1 {
+		t.Fatalf("Expected 1 protection system, got %d", len(movie.ProtectionSystems))
+	}
+	ps := movie.ProtectionSystems[0]
+	if ps.Name != "Widevine" || ps.DataSize != 2 {
+		t.Errorf("Unexpected protection system: %+v", ps)
+	}
+	if got := ps.SystemIDString(); got != "edef8ba9-79d6-4ace-a3c8-27dcd51d21ed" {
+		t.Errorf("Unexpected system ID string %s", got)
+	}
+}
+
+func TestParseMovieFragmentDuration(t *testing.T) {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:16], 1000) // Timescale
+	mehd := []byte{0, 0, 0, 0, 0, 0, 0x75, 0x30}  // v0, 30000 units
+	moov := makeBox("moov", append(makeBox("mvhd", mvhd), makeBox("mvex", makeBox("mehd", mehd))...))
+
+	f, err := os.CreateTemp(t.TempDir(), "frag.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Write(moov)
+
+	atoms, err := FastProbe(f)
+	if err != nil {
+		t.Fatalf("FastProbe failed: %v", err)
+	}
+	movie, err := NewDemuxer(f).ParseMovie(atoms)
+	if err != nil {
+		t.Fatalf("ParseMovie failed: %v", err)
+	}
+	if !movie.IsFragmented() || movie.DurationSeconds() != 30 {
+		t.Errorf("Expected 30s fragmented duration, got %.3fs (fragment=%d)", movie.DurationSeconds(), movie.FragmentDuration)
+	}
+
+	// mehd is optional: an empty mvex still marks the movie as fragmented
+	moov = makeBox("moov", append(makeBox("mvhd", mvhd), makeBox("mvex", nil)...))
+	atoms, err = FastProbeReader(bytes.NewReader(moov), int64(len(moov)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movie, err := NewDemuxer(bytes.NewReader(moov)).ParseMovie(atoms); err != nil || !movie.IsFragmented() || movie.FragmentDuration != 0 {
+		t.Errorf("Expected a fragmented movie without mehd duration, got %+v (%v)", movie, err)
+	}
+	if (Movie{}).IsFragmented() {
+		t.Error("Expected a movie without mvex not to be fragmented")
+	}
+}
+
+func TestParseMovieProducerReferenceTime(t *testing.T) {
+	// v1 prft: track 1, NTP 2024-01-01T00:00:00.5Z, media time 90000
+	payload := []byte{1, 0, 0, 0, 0, 0, 0, 1}
+	ntp := make([]byte, 8)
+	binary.BigEndian.PutUint64(ntp, uint64(1704067200+ntpUnixOffset)<<32|0x80000000)
+	payload = append(payload, ntp...)
+	payload = append(payload, 0, 0, 0, 0, 0, 0x01, 0x5F, 0x90)
+	file := append(makeBox("prft", payload), makeBox("moof", makeBox("mfhd", make([]byte, 8)))...)
+
+	f, err := os.CreateTemp(t.TempDir(), "live.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Write(file)
+
+	atoms, err := FastProbe(f)
+	if err != nil {
+		t.Fatalf("FastProbe failed: %v", err)
+	}
+	movie, err := NewDemuxer(f).ParseMovie(atoms)
+	if err != nil {
+		t.Fatalf("ParseMovie failed: %v", err)
+	}
+	if len(movie.ProducerTimes) != 1 {
+		t.Fatalf("Expected 1 prft, got %d", len(movie.ProducerTimes))
+	}
+	p := movie.ProducerTimes[0]
+	if p.ReferenceTrack != 1 || p.MediaTime != 90000 || p.Offset != 0 {
+		t.Errorf("Unexpected prft: %+v", p)
+	}
+	if got := p.WallClock().Format(time.RFC3339Nano); got != "2024-01-01T00:00:00.5Z" {
+		t.Errorf("Unexpected wall clock %s", got)
+	}
+}
+
+func TestParseMovieFtypBrands(t *testing.T) {
+	ftyp := makeBox("ftyp", []byte("qt  \x20\x05\x03\x00qt  isomiso2"))
+
+	f, err := os.CreateTemp(t.TempDir(), "brands.mov")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Write(ftyp)
+
+	atoms, err := FastProbe(f)
+	if err != nil {
+		t.Fatalf("FastProbe failed: %v", err)
+	}
+	movie, err := NewDemuxer(f).ParseMovie(atoms)
+	if err != nil {
+		t.Fatalf("ParseMovie failed: %v", err)
+	}
+	if movie.MajorBrand != "qt  " || movie.MinorVersion != 0x20050300 {
+		t.Errorf("Unexpected major brand %q / minor version %#x", movie.MajorBrand, movie.MinorVersion)
+	}
+	want := []string{"qt  ", "isom", "iso2"}
+	if len(movie.CompatibleBrands) != len(want) {
+		t.Fatalf("Expected compatible brands %q, got %q", want, movie.CompatibleBrands)
+	}
+	for i := range want {
+		if movie.CompatibleBrands[i] != want[i] {
+			t.Errorf("Expected compatible brands %q, got %q", want, movie.CompatibleBrands)
+		}
+	}
+}
+
+func TestFtypWithoutFragmentBrands(t *testing.T) {
+	dash := FtypInfo{MajorBrand: "dash", MinorVersion: 1, CompatibleBrands: []string{"iso6", "avc1", "mp41", "msdh", "cmfc"}}
+	got := dash.WithoutFragmentBrands()
+	if got.MajorBrand != "iso6" || got.MinorVersion != 0 {
+		t.Errorf("Unexpected major brand %q / minor version %d", got.MajorBrand, got.MinorVersion)
+	}
+	if len(got.CompatibleBrands) != 3 || got.CompatibleBrands[0] != "iso6" || got.CompatibleBrands[1] != "avc1" || got.CompatibleBrands[2] != "mp41" {
+		t.Errorf("Unexpected compatible brands %q", got.CompatibleBrands)
+	}
+	if len(dash.CompatibleBrands) != 5 {
+		t.Error("Source brands were modified")
+	}
+
+	if got := (FtypInfo{MajorBrand: "msix", CompatibleBrands: []string{"msix"}}).WithoutFragmentBrands(); got.MajorBrand != "isom" {
+		t.Errorf("Expected isom fallback, got %q", got.MajorBrand)
+	}
+	qt := FtypInfo{MajorBrand: "qt  ", MinorVersion: 0x20050300, CompatibleBrands: []string{"qt  "}}
+	if got := qt.WithoutFragmentBrands(); got.MajorBrand != "qt  " || got.MinorVersion != qt.MinorVersion || len(got.CompatibleBrands) != 1 {
+		t.Errorf("Progressive brands changed: %+v", got)
+	}
+	iso6 := FtypInfo{MajorBrand: "iso6", MinorVersion: 512, CompatibleBrands: []string{"iso6", "mp41"}}
+	if got := iso6.WithoutFragmentBrands(); got.MajorBrand != "iso6" || got.MinorVersion != 512 || len(got.CompatibleBrands) != 2 {
+		t.Errorf("iso6 brands changed: %+v", got)
+	}
+}
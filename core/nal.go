@@ -0,0 +1,224 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrNoAvcC is returned by ParseAvcC when the sample entry has no avcC box
+var ErrNoAvcC = errors.New("avcC box not found in sample description")
+
+// Default NAL unit length prefix size for avcC/hvcC streams (lengthSizeMinusOne = 3)
+const defaultNALLengthSize = 4
+
+// Limit on NAL units inspected per sample before giving up on finding a VCL unit
+const maxNALScan = 16
+
+// isAVC reports whether the codec tag is an H.264 sample entry
+func isAVC(tag string) bool {
+	return tag == "avc1" || tag == "avc3"
+}
+
+// isHEVCTag reports whether the codec tag is an HEVC sample entry
+func isHEVCTag(tag string) bool {
+	return tag == "hvc1" || tag == "hev1"
+}
+
+// IsHEVC reports whether the track is HEVC video (hvc1/hev1). HEVC is stream
+// copied like H.264: the hvcC inside stsd is written back verbatim and stss
+// marks the IRAP pictures cuts snap to.
+func (t Track) IsHEVC() bool {
+	return t.Type == TrackTypeVideo && isHEVCTag(t.CodecTag)
+}
+
+// nalLengthPrefixSize returns the NAL unit length prefix size declared by
+// the decoder configuration of the first sample entry: lengthSizeMinusOne+1
+// from avcC (byte 4) or hvcC (byte 21), else defaultNALLengthSize
+func nalLengthPrefixSize(stsd []byte, codecTag string) int {
+	var config []byte
+	at := 0
+	switch {
+	case isAVC(codecTag):
+		config, at = findSampleEntryBox(stsd, TrackTypeVideo, "avcC"), 4
+	case isHEVCTag(codecTag):
+		config, at = findSampleEntryBox(stsd, TrackTypeVideo, "hvcC"), 21
+	}
+	if len(config) <= at {
+		return defaultNALLengthSize
+	}
+	return int(config[at]&0x03) + 1
+}
+
+// isRandomAccessSample reads the NAL units of a length-prefixed video sample
+// and reports whether its first VCL unit is an IDR (H.264) or IRAP (HEVC)
+// picture. The second return value is false when the codec is not supported
+// or no VCL unit was found, in which case the caller should trust stss.
+func isRandomAccessSample(r io.ReaderAt, s Sample, codecTag string, lengthSize int) (bool, bool, error) {
+	if !isAVC(codecTag) && !isHEVCTag(codecTag) {
+		return false, false, nil
+	}
+	if lengthSize <= 0 || lengthSize > 4 {
+		lengthSize = defaultNALLengthSize
+	}
+
+	pos := int64(0)
+	header := make([]byte, lengthSize+1)
+	for n := 0; n < maxNALScan && pos+int64(len(header)) <= s.Size; n++ {
+		if _, err := r.ReadAt(header, s.Offset+pos); err != nil {
+			return false, false, fmt.Errorf("reading NAL header of sample %d: %w", s.ID, err)
+		}
+		nalSize := int64(0)
+		for _, b := range header[:lengthSize] {
+			nalSize = nalSize<<8 | int64(b)
+		}
+		nalHeader := header[lengthSize]
+
+		if isAVC(codecTag) {
+			nalType := nalHeader & 0x1F
+			if nalType >= 1 && nalType <= 5 {
+				return nalType == 5, true, nil
+			}
+		} else {
+			nalType := (nalHeader >> 1) & 0x3F
+			if nalType <= 31 {
+				return nalType >= 16 && nalType <= 23, true, nil
+			}
+		}
+
+		pos += int64(lengthSize) + nalSize
+	}
+	return false, false, nil
+}
+
+// ParseAvcC returns the SPS and PPS NAL units and the NAL length prefix size
+// stored in the avcC box (AVCDecoderConfigurationRecord, ISO/IEC 14496-15
+// 5.3.3.1) of the first sample entry of a video stsd payload. Returns
+// ErrNoAvcC when the entry carries no avcC, e.g. for non-H.264 tracks.
+func (d *Demuxer) ParseAvcC(stsd []byte) (sps [][]byte, pps [][]byte, nalLengthSize int, err error) {
+	avcC := findSampleEntryBox(stsd, TrackTypeVideo, "avcC")
+	if avcC == nil {
+		return nil, nil, 0, ErrNoAvcC
+	}
+	if len(avcC) < 7 {
+		return nil, nil, 0, fmt.Errorf("avcC too short (%d bytes)", len(avcC))
+	}
+	if avcC[0] != 1 {
+		return nil, nil, 0, fmt.Errorf("unsupported avcC configurationVersion %d", avcC[0])
+	}
+	nalLengthSize = int(avcC[4]&0x03) + 1
+
+	pos := 5
+	readSets := func(what string, count int) ([][]byte, error) {
+		var sets [][]byte
+		for i := 0; i < count; i++ {
+			if pos+2 > len(avcC) {
+				return nil, fmt.Errorf("avcC truncated at %s %d", what, i)
+			}
+			n := int(binary.BigEndian.Uint16(avcC[pos : pos+2]))
+			pos += 2
+			if pos+n > len(avcC) {
+				return nil, fmt.Errorf("avcC %s %d declares %d bytes, only %d left", what, i, n, len(avcC)-pos)
+			}
+			sets = append(sets, avcC[pos:pos+n])
+			pos += n
+		}
+		return sets, nil
+	}
+
+	numSPS := int(avcC[pos] & 0x1F)
+	pos++
+	if sps, err = readSets("SPS", numSPS); err != nil {
+		return nil, nil, 0, err
+	}
+	if pos >= len(avcC) {
+		return nil, nil, 0, fmt.Errorf("avcC truncated before the PPS count")
+	}
+	numPPS := int(avcC[pos])
+	pos++
+	if pps, err = readSets("PPS", numPPS); err != nil {
+		return nil, nil, 0, err
+	}
+	return sps, pps, nalLengthSize, nil
+}
+
+// annexBStartCode precedes every NAL unit of an Annex-B byte stream
+var annexBStartCode = []byte{0, 0, 0, 1}
+
+// parameterSets returns the parameter set NAL units of the first sample entry
+// of a video stsd payload: SPS and PPS from avcC, or every array of hvcC
+// (VPS, SPS, PPS and SEI) in order
+func parameterSets(stsd []byte, codecTag string) ([][]byte, error) {
+	switch {
+	case isAVC(codecTag):
+		sps, pps, _, err := (&Demuxer{}).ParseAvcC(stsd)
+		if err != nil {
+			return nil, err
+		}
+		return append(sps, pps...), nil
+	case isHEVCTag(codecTag):
+		hvcC := findSampleEntryBox(stsd, TrackTypeVideo, "hvcC")
+		if hvcC == nil {
+			return nil, fmt.Errorf("hvcC box not found in sample description")
+		}
+		return parseHvcCArrays(hvcC)
+	}
+	return nil, fmt.Errorf("no parameter sets for codec '%s'", codecTag)
+}
+
+// parseHvcCArrays reads the NAL unit arrays that follow the 22-byte fixed
+// part of an HEVCDecoderConfigurationRecord (ISO/IEC 14496-15 8.3.3.1)
+func parseHvcCArrays(hvcC []byte) ([][]byte, error) {
+	if len(hvcC) < 23 {
+		return nil, fmt.Errorf("hvcC too short (%d bytes)", len(hvcC))
+	}
+	numArrays := int(hvcC[22])
+	pos := 23
+	var nals [][]byte
+	for i := 0; i < numArrays; i++ {
+		if pos+3 > len(hvcC) {
+			return nil, fmt.Errorf("hvcC truncated at array %d", i)
+		}
+		count := int(binary.BigEndian.Uint16(hvcC[pos+1 : pos+3]))
+		pos += 3
+		for j := 0; j < count; j++ {
+			if pos+2 > len(hvcC) {
+				return nil, fmt.Errorf("hvcC truncated at array %d NAL %d", i, j)
+			}
+			n := int(binary.BigEndian.Uint16(hvcC[pos : pos+2]))
+			pos += 2
+			if pos+n > len(hvcC) {
+				return nil, fmt.Errorf("hvcC array %d NAL %d declares %d bytes, only %d left", i, j, n, len(hvcC)-pos)
+			}
+			nals = append(nals, hvcC[pos:pos+n])
+			pos += n
+		}
+	}
+	return nals, nil
+}
+
+// appendAnnexB converts a length-prefixed sample to Annex-B, replacing each
+// NAL unit's length prefix with a start code, and appends it to dst
+func appendAnnexB(dst, sample []byte, lengthSize int) ([]byte, error) {
+	if lengthSize <= 0 || lengthSize > 4 {
+		lengthSize = defaultNALLengthSize
+	}
+	for pos := 0; pos < len(sample); {
+		if pos+lengthSize > len(sample) {
+			return nil, fmt.Errorf("NAL length prefix truncated at byte %d", pos)
+		}
+		n := 0
+		for _, b := range sample[pos : pos+lengthSize] {
+			n = n<<8 | int(b)
+		}
+		pos += lengthSize
+		if n > len(sample)-pos {
+			return nil, fmt.Errorf("NAL unit declares %d bytes, only %d left", n, len(sample)-pos)
+		}
+		dst = append(dst, annexBStartCode...)
+		dst = append(dst, sample[pos:pos+n]...)
+		pos += n
+	}
+	return dst, nil
+}
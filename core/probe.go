@@ -2,9 +2,9 @@ package core
 
 import (
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"io"
-	"os"
 )
 
 // ContainerAtoms defines which atoms should be parsed recursively
@@ -18,14 +18,39 @@ var ContainerAtoms = map[string]bool{
 	"mvex": true,
 	"edts": true,
 	"udta": true,
+	"moof": true,
+	"traf": true,
+	"meta": true, // FullBox: see metaChildOffset
+	"ilst": true,
+}
+
+// metaChildOffset returns how many bytes follow the header of a 'meta' atom
+// before its first child. ISO meta is a FullBox (4-byte version/flags), but
+// QuickTime files (e.g. iPhone moov/meta) write it as a plain container,
+// recognizable by a child box type ('hdlr') right after the header.
+func metaChildOffset(r io.ReaderAt, payloadStart, end int64) int64 {
+	probe := make([]byte, 8)
+	if end-payloadStart < 8 {
+		return 0
+	}
+	if _, err := r.ReadAt(probe, payloadStart); err != nil {
+		return 4
+	}
+	if string(probe[4:8]) == "hdlr" {
+		return 0 // QuickTime style: children start immediately
+	}
+	return 4
 }
 
 // Atom represents an MP4 box/atom
 type Atom struct {
-	Offset   int64
-	Size     int64
-	Type     string
-	Children []Atom
+	Offset   int64  `json:"offset"`
+	Size     int64  `json:"size"`
+	Type     string `json:"type"`
+	Children []Atom `json:"children,omitempty"`
+
+	// HeaderSize is 8, or 16 with a 64-bit large size (0 = unknown, taken as 8)
+	HeaderSize int64 `json:"-"`
 }
 
 // String returns a formatted string representation of the Atom
@@ -33,33 +58,106 @@ func (a Atom) String() string {
 	return fmt.Sprintf("[%s] @ %d (Size: %d)", a.Type, a.Offset, a.Size)
 }
 
-// FastProbe analyzes the file structure without loading payloads
-func FastProbe(file *os.File) ([]Atom, error) {
-	info, err := file.Stat()
+// ProbeWarning describes a recoverable problem found while probing, e.g.
+// trailing garbage after the last valid atom. Probing stops at that point and
+// the atoms parsed so far are kept.
+type ProbeWarning struct {
+	Offset  int64  `json:"offset"`
+	Message string `json:"message"`
+}
+
+func (w ProbeWarning) String() string {
+	return fmt.Sprintf("@ %d: %s", w.Offset, w.Message)
+}
+
+// FastProbe analyzes the file structure without loading payloads. Any
+// seekable input works; the CLI passes the *os.File directly.
+func FastProbe(rs io.ReadSeeker) ([]Atom, error) {
+	size, err := streamSize(rs)
 	if err != nil {
 		return nil, err
 	}
-	fileSize := info.Size()
 
-	return parseAtoms(file, 0, fileSize)
+	return parseAtoms(asReaderAt(rs), 0, size)
+}
+
+// FastProbeReader is FastProbe over any io.ReaderAt holding size bytes,
+// e.g. an in-memory file via bytes.NewReader. Like FastProbe it drops the
+// probe warnings; use ProbeWithWarnings to get them.
+func FastProbeReader(r io.ReaderAt, size int64) ([]Atom, error) {
+	return parseAtoms(r, 0, size)
+}
+
+// ProbeWithWarnings is FastProbeReader returning the probe warnings instead
+// of logging them
+func ProbeWithWarnings(r io.ReaderAt, size int64) ([]Atom, []ProbeWarning, error) {
+	var warnings []ProbeWarning
+	atoms, err := parseAtomsDepth(r, 0, size, "", 0, &warnings)
+	return atoms, warnings, err
+}
+
+// FastProbeMoov is like FastProbe but returns as soon as the top-level moov has
+// been parsed. For faststart files this avoids walking past mdat entirely.
+func FastProbeMoov(rs io.ReadSeeker) ([]Atom, error) {
+	size, err := streamSize(rs)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseAtomsUntil(asReaderAt(rs), 0, size, "moov")
 }
 
 // parseAtoms is the recursive function to traverse the atom tree
-func parseAtoms(file *os.File, start, end int64) ([]Atom, error) {
+func parseAtoms(r io.ReaderAt, start, end int64) ([]Atom, error) {
+	return parseAtomsUntil(r, start, end, "")
+}
+
+// Nesting limit for container atoms; real files rarely exceed 10 levels
+const maxAtomDepth = 32
+
+// parseAtomsUntil traverses atoms in [start, end), stopping right after an
+// atom of type stopAfter has been parsed (empty means read to the end).
+// Probe warnings are discarded.
+func parseAtomsUntil(r io.ReaderAt, start, end int64, stopAfter string) ([]Atom, error) {
+	var warnings []ProbeWarning
+	return parseAtomsDepth(r, start, end, stopAfter, 0, &warnings)
+}
+
+// isAtomType reports whether typ looks like a box type: four non-control
+// characters. Bytes above 0x7F are allowed for iTunes-style items ('\xa9too').
+func isAtomType(typ string) bool {
+	if len(typ) != 4 {
+		return false
+	}
+	for i := 0; i < len(typ); i++ {
+		if typ[i] < 0x20 || typ[i] == 0x7F {
+			return false
+		}
+	}
+	return true
+}
+
+func parseAtomsDepth(r io.ReaderAt, start, end int64, stopAfter string, depth int, warnings *[]ProbeWarning) ([]Atom, error) {
+	if depth > maxAtomDepth {
+		return nil, fmt.Errorf("%w: atom nesting exceeds %d levels at offset %d", ErrMalformedAtom, maxAtomDepth, start)
+	}
+
 	var atoms []Atom
 	offset := start
+	warn := func(format string, v ...any) {
+		*warnings = append(*warnings, ProbeWarning{Offset: offset, Message: fmt.Sprintf(format, v...)})
+	}
 
 	for offset < end {
-		// Seek to the current atom header
-		_, err := file.Seek(offset, io.SeekStart)
-		if err != nil {
-			return nil, err
+		if end-offset < 8 {
+			warn("%d trailing bytes after the last atom, ignored", end-offset)
+			break
 		}
 
 		// Read Header (8 bytes: 4 size + 4 type)
 		header := make([]byte, 8)
-		if _, err := file.Read(header); err != nil {
-			if err == io.EOF {
+		if _, err := r.ReadAt(header, offset); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
 				break
 			}
 			return nil, err
@@ -67,52 +165,195 @@ func parseAtoms(file *os.File, start, end int64) ([]Atom, error) {
 
 		size := int64(binary.BigEndian.Uint32(header[0:4]))
 		typ := string(header[4:8])
+		headerSize := int64(8)
 
 		// Handle Special Case: Size 1 means extended size (64-bit) follows
 		if size == 1 {
+			if end-offset < 16 {
+				warn("truncated extended header for [%s], ignored %d trailing bytes", typ, end-offset)
+				break
+			}
 			extendedHeader := make([]byte, 8)
-			if _, err := file.Read(extendedHeader); err != nil {
+			if _, err := r.ReadAt(extendedHeader, offset+8); err != nil {
+				if err == io.EOF || err == io.ErrUnexpectedEOF {
+					return nil, fmt.Errorf("%w: extended header of [%s] @ %d", ErrTruncatedAtom, typ, offset)
+				}
 				return nil, err
 			}
-			size = int64(binary.BigEndian.Uint64(extendedHeader))
-			// Adjust offset for extended header reading
-			// Note: The extended size includes the 8 bytes of the extended header + 8 bytes of standard header
+			// The extended size includes the 8 bytes of the standard header + 8 bytes of the extended one
+			ext := binary.BigEndian.Uint64(extendedHeader)
+			if ext > uint64(end-offset) {
+				ext = uint64(end - offset) // Truncated file: clamp to what we can address
+			}
+			size = int64(ext)
+			headerSize = 16
+		} else if size == 0 {
+			// Size 0 means "rest of the file"
+			size = end - offset
 		}
 
-		if size == 0 {
-			// Size 0 means "rest of the file"
+		if size < headerSize || !isAtomType(typ) {
+			// Garbage (e.g. a bad concatenation): keep what was parsed so far
+			warn("invalid atom header (size %d, type %q), ignored %d trailing bytes", size, typ, end-offset)
+			break
+		}
+		if size > end-offset {
+			warn("[%s] declares %d bytes but only %d remain; truncated", typ, size, end-offset)
 			size = end - offset
 		}
 
 		atom := Atom{
-			Offset: offset,
-			Size:   size,
-			Type:   typ,
+			Offset:     offset,
+			Size:       size,
+			Type:       typ,
+			HeaderSize: headerSize,
 		}
 
 		// Recursion for known containers
 		if ContainerAtoms[typ] {
-			// Payload starts after the header.
-			// Standard header is 8 bytes.
-			// Extended header logic is simplified here; full spec requires checking extensions.
-			// For this MVP, assuming standard 8-byte header for containers unless size=1 logic is hit.
-			headerSize := int64(8)
-			if size == 1 {
-				headerSize = 16
+			// Payload starts after the (standard or extended) header.
+			// Children never extend past the parent's declared range.
+			childEnd := offset + size
+			childStart := offset + headerSize
+			if typ == "meta" {
+				childStart += metaChildOffset(r, childStart, childEnd)
 			}
 
-			children, err := parseAtoms(file, offset+headerSize, offset+size)
+			children, err := parseAtomsDepth(r, childStart, childEnd, "", depth+1, warnings)
 			if err != nil {
-				// Don't fail completely on malformed children, just log/warn?
-				// For now, return error to be strict.
 				return nil, err
 			}
 			atom.Children = children
 		}
 
 		atoms = append(atoms, atom)
+		if stopAfter != "" && typ == stopAfter {
+			break
+		}
 		offset += size
 	}
 
 	return atoms, nil
 }
+
+// IsFastStart reports whether the top-level moov precedes the first mdat,
+// i.e. whether a player can start streaming without seeking to the end.
+func IsFastStart(atoms []Atom) bool {
+	for _, a := range atoms {
+		switch a.Type {
+		case "moov":
+			return true
+		case "mdat":
+			return false
+		}
+	}
+	return false
+}
+
+// ByteRange is a contiguous region of the file
+type ByteRange struct {
+	Offset int64
+	Size   int64
+}
+
+// Contains reports whether [offset, offset+size) lies entirely inside the range
+func (r ByteRange) Contains(offset, size int64) bool {
+	return offset >= r.Offset && size >= 0 && offset+size <= r.Offset+r.Size
+}
+
+// FindAtom returns the first atom of the given type in atoms, without
+// descending into children, or nil when there is none
+func FindAtom(atoms []Atom, typ string) *Atom {
+	for i := range atoms {
+		if atoms[i].Type == typ {
+			return &atoms[i]
+		}
+	}
+	return nil
+}
+
+// Payload returns the byte range of the atom's payload, after its header
+func (a Atom) Payload() ByteRange {
+	header := a.HeaderSize
+	if header == 0 {
+		header = 8
+	}
+	return ByteRange{Offset: a.Offset + header, Size: max(0, a.Size-header)}
+}
+
+// MdatRanges returns the payload range of every top-level mdat atom, in file
+// order: the sample data, without the box header
+func MdatRanges(atoms []Atom) []ByteRange {
+	var ranges []ByteRange
+	for _, a := range atoms {
+		if a.Type == "mdat" {
+			ranges = append(ranges, a.Payload())
+		}
+	}
+	return ranges
+}
+
+// InMdat reports whether a sample's bytes fall entirely within one of the ranges
+func InMdat(ranges []ByteRange, s Sample) bool {
+	for _, r := range ranges {
+		if r.Contains(s.Offset, s.Size) {
+			return true
+		}
+	}
+	return false
+}
+
+// ProbeReport is the JSON document emitted by MarshalAtomsJSON
+type ProbeReport struct {
+	HasCtts  bool           `json:"has_ctts"` // B-frames present (composition offsets)
+	HasEdts  bool           `json:"has_edts"` // Edit lists present
+	Atoms    []Atom         `json:"atoms"`
+	Warnings []ProbeWarning `json:"warnings,omitempty"`
+}
+
+// MarshalAtomsJSON serializes the atom tree, with the critical ctts/edts
+// checks precomputed on the root so tooling doesn't have to re-scan
+func MarshalAtomsJSON(atoms []Atom) ([]byte, error) {
+	return MarshalProbeJSON(atoms, nil)
+}
+
+// MarshalProbeJSON is MarshalAtomsJSON with the warnings returned by
+// ProbeWithWarnings included in the report
+func MarshalProbeJSON(atoms []Atom, warnings []ProbeWarning) ([]byte, error) {
+	report := ProbeReport{
+		HasCtts:  containsAtom(atoms, "ctts"),
+		HasEdts:  containsAtom(atoms, "edts"),
+		Atoms:    atoms,
+		Warnings: warnings,
+	}
+	if report.Atoms == nil {
+		report.Atoms = []Atom{}
+	}
+	return json.MarshalIndent(report, "", "  ")
+}
+
+// atomPaths lists the slash-separated type paths of every descendant of a,
+// relative to a itself, in tree order
+func atomPaths(a Atom) []string {
+	var paths []string
+	var walk func(children []Atom, prefix string)
+	walk = func(children []Atom, prefix string) {
+		for _, c := range children {
+			path := prefix + c.Type
+			paths = append(paths, path)
+			walk(c.Children, path+"/")
+		}
+	}
+	walk(a.Children, "")
+	return paths
+}
+
+// containsAtom reports whether an atom of type typ exists anywhere in the tree
+func containsAtom(atoms []Atom, typ string) bool {
+	for _, a := range atoms {
+		if a.Type == typ || containsAtom(a.Children, typ) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,52 +1,46 @@
 package core
 
 import (
+	"bytes"
 	"encoding/binary"
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestFastProbe(t *testing.T) {
-	// Create a temporary file mimicking an MP4
-	tmpfile, err := ioutil.TempFile("", "example.mp4")
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer os.Remove(tmpfile.Name()) // clean up
+	var buf bytes.Buffer
 
-	// Writes an atom to the file
+	// Writes an atom header to the buffer
 	writeAtom := func(typ string, size uint32) {
 		b := make([]byte, 8)
 		binary.BigEndian.PutUint32(b[0:4], size)
 		copy(b[4:8], []byte(typ))
-		tmpfile.Write(b)
+		buf.Write(b)
 	}
 
 	// Write 'ftyp' atom (size 20)
 	writeAtom("ftyp", 20)
-	tmpfile.Write(make([]byte, 12)) // payload
+	buf.Write(make([]byte, 12)) // payload
 
 	// Write 'moov' atom (container)
-	// We'll calculate size later or just hardcode for this simple test
 	// moov header (8) + mvhd (100) = 108
 	writeAtom("moov", 108)
 
 	// Write 'mvhd' inside 'moov'
 	writeAtom("mvhd", 100)
-	tmpfile.Write(make([]byte, 92)) // payload
+	buf.Write(make([]byte, 92)) // payload
 
 	// Write 'mdat' (size 1000)
 	writeAtom("mdat", 1000)
-	tmpfile.Write(make([]byte, 992))
-
-	tmpfile.Sync()
-	tmpfile.Seek(0, 0)
+	buf.Write(make([]byte, 992))
 
 	// Test Probing
-	atoms, err := FastProbe(tmpfile)
+	atoms, err := FastProbeReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
 	if err != nil {
-		t.Fatalf("FastProbe failed: %v", err)
+		t.Fatalf("FastProbeReader failed: %v", err)
 	}
 
 	if len(atoms) != 3 {
@@ -69,3 +63,230 @@ func TestFastProbe(t *testing.T) {
 		t.Errorf("Expected child of moov to be mvhd, got %s", atoms[1].Children[0].Type)
 	}
 }
+
+func TestFastProbeMoovStopsAfterMoov(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "faststart.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	writeAtom := func(typ string, size uint32) {
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint32(b[0:4], size)
+		copy(b[4:8], []byte(typ))
+		tmpfile.Write(b)
+	}
+
+	writeAtom("ftyp", 16)
+	tmpfile.Write(make([]byte, 8))
+	writeAtom("moov", 16)
+	writeAtom("mvhd", 8)
+	writeAtom("mdat", 108)
+	tmpfile.Write(make([]byte, 100))
+	tmpfile.Sync()
+
+	atoms, err := FastProbeMoov(tmpfile)
+	if err != nil {
+		t.Fatalf("FastProbeMoov failed: %v", err)
+	}
+	if len(atoms) != 2 {
+		t.Fatalf("Expected 2 top-level atoms (ftyp, moov), got %d", len(atoms))
+	}
+	if atoms[1].Type != "moov" || len(atoms[1].Children) != 1 {
+		t.Errorf("Expected parsed moov with 1 child, got %v", atoms[1])
+	}
+}
+
+func FuzzParseAtoms(f *testing.F) {
+	atom := func(typ string, size uint32, payload []byte) []byte {
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint32(b[0:4], size)
+		copy(b[4:8], typ)
+		return append(b, payload...)
+	}
+	f.Add(atom("ftyp", 16, make([]byte, 8)))
+	f.Add(atom("moov", 16, atom("mvhd", 8, nil)))
+	f.Add(atom("moov", 1, append([]byte{0, 0, 0, 0, 0, 0, 0, 24}, atom("trak", 8, nil)...)))
+	f.Add(atom("mdat", 0, []byte{1, 2, 3}))
+	f.Add(atom("trak", 4, nil))
+	f.Add(atom("moov", 1, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			atoms, err := FastProbeReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				return
+			}
+			var check func(atoms []Atom, start, end int64)
+			check = func(atoms []Atom, start, end int64) {
+				for _, a := range atoms {
+					if a.Offset < start || a.Offset >= end || a.Size < 8 {
+						t.Errorf("atom %v outside parent range [%d, %d)", a, start, end)
+					}
+					check(a.Children, a.Offset, a.Offset+a.Size)
+				}
+			}
+			check(atoms, 0, int64(len(data)))
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("FastProbeReader did not return within 2s for %d-byte input", len(data))
+		}
+	})
+}
+
+func TestIsFastStart(t *testing.T) {
+	faststart := []Atom{{Type: "ftyp"}, {Type: "moov"}, {Type: "mdat"}}
+	if !IsFastStart(faststart) {
+		t.Error("Expected moov-before-mdat to be fast start")
+	}
+	regular := []Atom{{Type: "ftyp"}, {Type: "free"}, {Type: "mdat"}, {Type: "moov"}}
+	if IsFastStart(regular) {
+		t.Error("Expected mdat-before-moov not to be fast start")
+	}
+}
+
+func TestMdatRanges(t *testing.T) {
+	atoms := []Atom{
+		{Type: "ftyp", Offset: 0, Size: 24},
+		{Type: "mdat", Offset: 24, Size: 1000},
+		{Type: "moov", Offset: 1024, Size: 500},
+		{Type: "mdat", Offset: 1524, Size: 200, HeaderSize: 16},
+	}
+	ranges := MdatRanges(atoms)
+	if len(ranges) != 2 || ranges[0] != (ByteRange{Offset: 32, Size: 992}) || ranges[1] != (ByteRange{Offset: 1540, Size: 184}) {
+		t.Fatalf("Unexpected mdat payload ranges: %v", ranges)
+	}
+	if !InMdat(ranges, Sample{Offset: 1600, Size: 100}) {
+		t.Error("Expected sample inside second mdat")
+	}
+	if InMdat(ranges, Sample{Offset: 1000, Size: 100}) {
+		t.Error("Expected sample straddling moov to be outside mdat")
+	}
+	if InMdat(ranges, Sample{Offset: 24, Size: 100}) || InMdat(ranges, Sample{Offset: 1530, Size: 100}) {
+		t.Error("Expected samples overlapping an mdat header to be outside mdat")
+	}
+
+	// A probed mdat with a 64-bit large size has a 16-byte header
+	large := []byte{0, 0, 0, 1, 'm', 'd', 'a', 't', 0, 0, 0, 0, 0, 0, 0, 48}
+	large = append(large, make([]byte, 32)...)
+	probed, err := FastProbeReader(bytes.NewReader(large), int64(len(large)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := MdatRanges(probed); len(got) != 1 || got[0] != (ByteRange{Offset: 16, Size: 32}) {
+		t.Errorf("Expected the large-size mdat payload at 16 (32 bytes), got %v", got)
+	}
+}
+
+func TestMarshalAtomsJSON(t *testing.T) {
+	atoms := []Atom{
+		{Type: "ftyp", Offset: 0, Size: 24},
+		{Type: "moov", Offset: 24, Size: 100, Children: []Atom{
+			{Type: "trak", Offset: 32, Size: 92, Children: []Atom{{Type: "edts", Offset: 40, Size: 36}}},
+		}},
+	}
+	data, err := MarshalAtomsJSON(atoms)
+	if err != nil {
+		t.Fatalf("MarshalAtomsJSON failed: %v", err)
+	}
+
+	var report ProbeReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("Output is not valid JSON: %v", err)
+	}
+	if report.HasCtts || !report.HasEdts {
+		t.Errorf("Expected has_ctts=false, has_edts=true, got %v/%v", report.HasCtts, report.HasEdts)
+	}
+	if len(report.Atoms) != 2 || report.Atoms[1].Children[0].Children[0].Offset != 40 {
+		t.Errorf("Atom tree did not round-trip: %s", data)
+	}
+}
+
+func TestMarshalProbeJSONWarnings(t *testing.T) {
+	// Trailing garbage after a valid ftyp
+	data := append(makeBox("ftyp", []byte("isom\x00\x00\x02\x00")), 0xDE, 0xAD)
+	atoms, warnings, err := ProbeWithWarnings(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := MarshalProbeJSON(atoms, warnings)
+	if err != nil {
+		t.Fatalf("MarshalProbeJSON failed: %v", err)
+	}
+	var report ProbeReport
+	if err := json.Unmarshal(out, &report); err != nil {
+		t.Fatalf("Output is not valid JSON: %v", err)
+	}
+	if len(report.Warnings) != 1 || report.Warnings[0].Offset != 16 {
+		t.Errorf("Expected one warning at offset 16 in the report, got %+v", report.Warnings)
+	}
+}
+
+func TestFastProbeMetaFullBox(t *testing.T) {
+	hdlr := makeBox("hdlr", append(make([]byte, 8), []byte("mdir\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")...))
+	ilst := makeBox("ilst", makeBox("\xa9too", makeBox("data", []byte("\x00\x00\x00\x01\x00\x00\x00\x00cromedia"))))
+
+	for _, tc := range []struct {
+		name string
+		meta []byte
+	}{
+		{"iso", makeBox("meta", append(append([]byte{0, 0, 0, 0}, hdlr...), ilst...))},
+		{"quicktime", makeBox("meta", append(append([]byte{}, hdlr...), ilst...))},
+	} {
+		data := makeBox("moov", makeBox("udta", tc.meta))
+		atoms, err := FastProbeReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("%s: FastProbeReader failed: %v", tc.name, err)
+		}
+		meta := atoms[0].Children[0].Children[0]
+		if len(meta.Children) != 2 || meta.Children[0].Type != "hdlr" || meta.Children[1].Type != "ilst" {
+			t.Fatalf("%s: expected meta children [hdlr ilst], got %v", tc.name, meta.Children)
+		}
+		ilstAtom := meta.Children[1]
+		if len(ilstAtom.Children) != 1 || ilstAtom.Children[0].Type != "\xa9too" || ilstAtom.Children[0].Offset != ilstAtom.Offset+8 {
+			t.Errorf("%s: expected aligned ©too item in ilst, got %v", tc.name, ilstAtom.Children)
+		}
+	}
+}
+
+func TestProbeTrailingGarbage(t *testing.T) {
+	valid := append(makeBox("ftyp", make([]byte, 8)), makeBox("moov", makeBox("mvhd", make([]byte, 8)))...)
+
+	for _, tc := range []struct {
+		name     string
+		tail     []byte
+		wantLast string
+	}{
+		{"short tail", []byte{1, 2, 3, 4, 5}, "moov"},
+		{"size below header", []byte{0, 0, 0, 3, 'j', 'u', 'n', 'k', 9, 9, 9, 9}, "moov"},
+		{"zero padding", make([]byte, 64), "moov"},
+		{"binary type", []byte{0, 0, 0, 16, 0xFF, 0x00, 0x13, 0x37, 1, 2, 3, 4, 5, 6, 7, 8}, "moov"},
+		{"truncated atom", append([]byte{0, 0, 0x10, 0, 'm', 'd', 'a', 't'}, make([]byte, 24)...), "mdat"},
+	} {
+		data := append(append([]byte{}, valid...), tc.tail...)
+		atoms, warnings, err := ProbeWithWarnings(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Errorf("%s: expected no error, got %v", tc.name, err)
+			continue
+		}
+		if len(atoms) == 0 || atoms[len(atoms)-1].Type != tc.wantLast {
+			t.Errorf("%s: expected the last atom to be %s, got %v", tc.name, tc.wantLast, atoms)
+		}
+		if len(warnings) != 1 || warnings[0].Offset != int64(len(valid)) {
+			t.Errorf("%s: expected one warning at offset %d, got %v", tc.name, len(valid), warnings)
+		}
+		if last := atoms[len(atoms)-1]; last.Offset+last.Size > int64(len(data)) {
+			t.Errorf("%s: atom %v runs past the end of the data", tc.name, last)
+		}
+	}
+
+	if _, warnings, _ := ProbeWithWarnings(bytes.NewReader(valid), int64(len(valid))); len(warnings) != 0 {
+		t.Errorf("Expected no warnings for a clean file, got %v", warnings)
+	}
+}
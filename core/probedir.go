@@ -0,0 +1,121 @@
+package core
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Extensions picked up by ProbeDir
+var probeExtensions = map[string]bool{
+	".mp4": true,
+	".m4v": true,
+	".m4a": true,
+	".mov": true,
+}
+
+// ProbeResult is the outcome of probing one file in ProbeDir
+type ProbeResult struct {
+	Path   string
+	Atoms  []Atom
+	Tracks []TrackInfo
+	Err    error
+}
+
+// ProgressFunc is called after each file with the number of files done so far
+type ProgressFunc func(done, total int)
+
+// ProbeDir probes every MP4-family file under dir using the given number of
+// workers. Cancelling ctx stops workers promptly; the results gathered so far
+// are returned together with ctx.Err(). progress may be nil.
+func ProbeDir(ctx context.Context, dir string, workers int, progress ProgressFunc) ([]ProbeResult, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && probeExtensions[strings.ToLower(filepath.Ext(path))] {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobs := make(chan string)
+	results := make(chan ProbeResult, workers)
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				if ctx.Err() != nil {
+					continue // Drain without working once cancelled
+				}
+				results <- probeFile(path)
+			}
+		}()
+	}
+
+	// Producer: stop feeding as soon as ctx is cancelled
+	go func() {
+		defer close(jobs)
+		for _, path := range paths {
+			select {
+			case jobs <- path:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var collected []ProbeResult
+	for res := range results {
+		collected = append(collected, res)
+		if progress != nil {
+			progress(len(collected), len(paths))
+		}
+	}
+
+	sort.Slice(collected, func(i, j int) bool { return collected[i].Path < collected[j].Path })
+	return collected, ctx.Err()
+}
+
+// probeFile probes a single file up to its moov and lists its tracks
+func probeFile(path string) ProbeResult {
+	res := ProbeResult{Path: path}
+
+	file, err := os.Open(path)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	defer file.Close()
+
+	res.Atoms, res.Err = FastProbeMoov(file)
+	if res.Err != nil {
+		return res
+	}
+	for _, a := range res.Atoms {
+		if a.Type == "moov" {
+			res.Tracks, res.Err = NewDemuxer(file).ListTracks(a)
+			break
+		}
+	}
+	return res
+}
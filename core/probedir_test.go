@@ -0,0 +1,60 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeProbeDirFixtures(t *testing.T, n int) string {
+	t.Helper()
+	dir := t.TempDir()
+	for i := 0; i < n; i++ {
+		data := append(makeBox("ftyp", make([]byte, 8)), makeBox("mdat", make([]byte, 16))...)
+		name := filepath.Join(dir, string(rune('a'+i))+".mp4")
+		if err := os.WriteFile(name, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("skip me"), 0644)
+	return dir
+}
+
+func TestProbeDirProgress(t *testing.T) {
+	dir := writeProbeDirFixtures(t, 5)
+
+	calls := 0
+	results, err := ProbeDir(context.Background(), dir, 2, func(done, total int) {
+		calls++
+		if total != 5 {
+			t.Errorf("Expected total 5, got %d", total)
+		}
+	})
+	if err != nil {
+		t.Fatalf("ProbeDir failed: %v", err)
+	}
+	if len(results) != 5 || calls != 5 {
+		t.Errorf("Expected 5 results and 5 progress calls, got %d / %d", len(results), calls)
+	}
+	if len(results[0].Atoms) != 2 {
+		t.Errorf("Expected 2 atoms in %s, got %d", results[0].Path, len(results[0].Atoms))
+	}
+}
+
+func TestProbeDirCancelled(t *testing.T) {
+	dir := writeProbeDirFixtures(t, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	results, err := ProbeDir(ctx, dir, 1, func(done, total int) {
+		if done == 2 {
+			cancel()
+		}
+	})
+	if err != context.Canceled {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if len(results) >= 10 {
+		t.Errorf("Expected partial results after cancellation, got %d", len(results))
+	}
+}
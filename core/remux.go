@@ -4,37 +4,301 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
+	"math/bits"
 	"os"
+	"path/filepath"
 	"sort"
+	"strings"
+	"time"
 )
 
+// RemuxOptions tunes how the output container is written
+type RemuxOptions struct {
+	// NormalizeRotation bakes a 90/180/270 tkhd rotation into swapped
+	// width/height and an identity matrix. Only the signaling changes; the
+	// coded pixels are untouched.
+	NormalizeRotation bool
+
+	// CreationTime, when set, is written as the creation and modification
+	// time of mvhd and of every tkhd/mdhd. Otherwise the source times are
+	// kept: Movie's for mvhd, each track's own (or else Movie's) for its
+	// tkhd/mdhd. Ignored in Deterministic mode.
+	CreationTime time.Time
+
+	// Deterministic guarantees byte-identical output for identical input:
+	// creation/modification times are always zero, the clock is never read,
+	// and a fixed-size zeroed 'free' box is reserved after ftyp.
+	Deterministic bool
+
+	// PreserveChunking keeps the source stsc chunk layout for tracks whose
+	// sample set is unchanged (plain remux, no cut) instead of writing one
+	// sample per chunk. Each source chunk is written contiguously.
+	PreserveChunking bool
+
+	// ChunkTarget groups consecutive samples of a track into chunks of up
+	// to this many bytes (see DefaultChunkTarget) instead of writing one
+	// sample per chunk, shrinking stco/co64 to one offset per chunk. A
+	// chunk also closes after maxGroupedChunkDuration of media so audio
+	// and video stay finely interleaved. 0 keeps one sample per chunk;
+	// PreserveChunking takes precedence for the tracks it applies to.
+	ChunkTarget int64
+
+	// WriteToolTag adds a udta/meta/ilst with a ©too item naming the
+	// writing tool, so outputs can be traced back to cromedia.
+	WriteToolTag bool
+
+	// Ftyp overrides the written file type, e.g. the source's brands to keep
+	// a QuickTime ('qt  ') file a QuickTime file. nil writes isom/mp41.
+	Ftyp *FtypInfo
+
+	// Movie is the source movie header: its timescale and display matrix
+	// are written back to mvhd (tkhd and elst durations follow the
+	// timescale). nil, or zero fields, write 1000 and the identity matrix.
+	Movie *Movie
+
+	// Strict refuses to write a file that would silently lose metadata: any
+	// source box under trak (Track.SourceBoxes) that the remuxer does not
+	// write back is reported as an error. The default drops such boxes.
+	Strict bool
+
+	// SortedReads reads the sample data in source offset order, one forward
+	// pass per input, instead of seeking per sample in interleaved order.
+	// The interleaved mdat is staged in memory when it fits in
+	// SortedReadMemory bytes, otherwise in a scratch file next to the output
+	// (needing as much free disk space as the mdat), then copied out
+	// sequentially. Faster on spinning disks and network filesystems.
+	SortedReads      bool
+	SortedReadMemory int64 // Staging limit for SortedReads, 0 = 64MB
+}
+
+const defaultSortedReadMemory = 64 << 20
+
+// outputFtyp returns the file type to write and its well-formed compatible
+// brands
+func (o RemuxOptions) outputFtyp() (FtypInfo, []string) {
+	ftyp := FtypInfo{MajorBrand: "isom", MinorVersion: 512, CompatibleBrands: []string{"isom", "mp41"}}
+	if o.Ftyp != nil && len(o.Ftyp.MajorBrand) == 4 {
+		ftyp = *o.Ftyp
+	}
+	var brands []string
+	for _, brand := range ftyp.CompatibleBrands {
+		if len(brand) == 4 {
+			brands = append(brands, brand)
+		}
+	}
+	return ftyp, brands
+}
+
+// headerSize is the size of what is written before the moov: the ftyp and,
+// for deterministic output, the reserved free box
+func (o RemuxOptions) headerSize() int64 {
+	_, brands := o.outputFtyp()
+	size := int64(16 + 4*len(brands))
+	if o.Deterministic {
+		size += deterministicFreeSize
+	}
+	return size
+}
+
+// DefaultChunkTarget is a chunk size that keeps the chunk offset tables small
+// without hurting progressive playback
+const DefaultChunkTarget = 512 << 10
+
+// Longest span of media time a chunk grouped by ChunkTarget may cover
+const maxGroupedChunkDuration = 500 * time.Millisecond
+
+// Default timescale of the written mvhd, tkhd durations and elst segment durations
+const movieTimescale = uint32(1000)
+
+// movieTimescale is the written mvhd timescale: the source's when known
+func (o RemuxOptions) movieTimescale() uint32 {
+	if o.Movie != nil && o.Movie.Timescale != 0 {
+		return o.Movie.Timescale
+	}
+	return movieTimescale
+}
+
+// movieMatrix is the written mvhd display matrix: the source's when known,
+// identity once NormalizeRotation has baked the rotation into the tracks
+func (o RemuxOptions) movieMatrix() []byte {
+	if o.Movie != nil && len(o.Movie.Matrix) == 36 && !o.NormalizeRotation {
+		return o.Movie.Matrix
+	}
+	return identityMatrix()
+}
+
+// trackMovieDuration is the tkhd duration of t in movieScale: the edited
+// duration when the track has an edit list, otherwise its media duration.
+func trackMovieDuration(t Track, movieScale uint32) int64 {
+	if dur, ok := t.EditedDuration(movieScale); ok {
+		return dur
+	}
+	return convertTime(uint64(t.MediaDuration()), t.Timescale, movieScale)
+}
+
+// Value of the ©too item written when RemuxOptions.WriteToolTag is set
+const toolName = "cromedia"
+
+// Size of the zero-filled 'free' box written in deterministic mode
+const deterministicFreeSize = 64
+
+// headerTimes returns the creation/modification times (seconds since 1904)
+// written into mvhd/tkhd/mdhd: opts.CreationTime for both when set, else the
+// given source times. Deterministic output always uses zero.
+func headerTimes(opts RemuxOptions, creation, modification time.Time) (uint64, uint64) {
+	if opts.Deterministic {
+		return 0, 0
+	}
+	if !opts.CreationTime.IsZero() {
+		t := toMP4Time(opts.CreationTime)
+		return t, t
+	}
+	return toMP4Time(creation), toMP4Time(modification)
+}
+
+// movieHeaderTimes is headerTimes for mvhd, from the source movie header
+func (o RemuxOptions) movieHeaderTimes() (creation, modification uint64) {
+	if o.Movie == nil {
+		return headerTimes(o, time.Time{}, time.Time{})
+	}
+	return headerTimes(o, o.Movie.CreationTime, o.Movie.ModificationTime)
+}
+
+// trackHeaderTimes is headerTimes for the tkhd/mdhd of t, falling back to
+// the movie's times for tracks that carry none
+func (o RemuxOptions) trackHeaderTimes(t Track) (creation, modification uint64) {
+	if t.CreationTime.IsZero() && t.ModificationTime.IsZero() {
+		return o.movieHeaderTimes()
+	}
+	return headerTimes(o, t.CreationTime, t.ModificationTime)
+}
+
+// headerVersion picks the mvhd/tkhd/mdhd version for a duration and header
+// times: version 1 (64-bit fields) only when one does not fit in 32 bits
+func headerVersion(duration int64, times ...uint64) uint8 {
+	if duration > math.MaxUint32 {
+		return 1
+	}
+	for _, t := range times {
+		if t > math.MaxUint32 {
+			return 1
+		}
+	}
+	return 0
+}
+
 // Remuxer handles the reconstruction of MP4 atoms
 type Remuxer struct {
-	InputFile *os.File
+	InputFile io.ReadSeeker
+	Sources   []io.ReadSeeker // Optional: per-sample inputs (Sample.Source), e.g. for Concat
+	Options   RemuxOptions
+
+	// Logger receives the remuxer's messages (nil = stdout). Use
+	// DiscardLogger to suppress them.
+	Logger Logger
+
+	// Sample count of every track of the last WriteMultiTrackFile, for Verify
+	written []int
+}
+
+func (r *Remuxer) logger() Logger {
+	return loggerOr(r.Logger)
+}
+
+// sourceFor returns the file that holds the given sample's bytes
+func (r *Remuxer) sourceFor(s Sample) (io.ReadSeeker, error) {
+	if len(r.Sources) == 0 {
+		return r.InputFile, nil
+	}
+	if s.Source < 0 || s.Source >= len(r.Sources) {
+		return nil, fmt.Errorf("sample %d references unknown source %d", s.ID, s.Source)
+	}
+	return r.Sources[s.Source], nil
+}
+
+// sourceIndex is the index of the input a sample reads from: its Source, or 0
+// when everything reads from InputFile
+func (r *Remuxer) sourceIndex(s Sample) int {
+	if len(r.Sources) == 0 {
+		return 0
+	}
+	return s.Source
+}
+
+// checkSampleBounds verifies that every sample's byte range lies inside its
+// input file, naming the first sample that does not
+func (r *Remuxer) checkSampleBounds(tracks []Track) error {
+	sizes := make(map[int]int64)
+	for _, t := range tracks {
+		for _, s := range t.Samples {
+			src, err := r.sourceFor(s)
+			if err != nil {
+				return err
+			}
+			size, ok := sizes[r.sourceIndex(s)]
+			if !ok {
+				size, err = streamSize(src)
+				if err != nil {
+					return fmt.Errorf("stat input: %w", err)
+				}
+				sizes[r.sourceIndex(s)] = size
+			}
+			if s.Offset < 0 || s.Size < 0 || s.Offset+s.Size > size {
+				return fmt.Errorf("track %d (%s): sample %d at offset %d (%d bytes) ends past the end of its input (%d bytes)",
+					t.ID, t.Type, s.ID, s.Offset, s.Size, size)
+			}
+		}
+	}
+	return nil
 }
 
 // WriteMultiTrackFile generates a valid MP4 from a list of Tracks with interleaved mdat
 func (r *Remuxer) WriteMultiTrackFile(outputFile string, tracks []Track) error {
+	if r.Options.Strict {
+		if err := checkCarriedBoxes(tracks, r.Options); err != nil {
+			return err
+		}
+	}
+
+	// Fail before creating the output rather than writing short sample data
+	if err := r.checkSampleBounds(tracks); err != nil {
+		return err
+	}
+
 	out, err := os.Create(outputFile)
 	if err != nil {
 		return err
 	}
 	defer out.Close()
 
+	r.written = make([]int, len(tracks))
+	for i, t := range tracks {
+		r.written[i] = len(t.Samples)
+	}
+
 	writer := &AtomWriter{w: out}
 
 	// 1. Write ftyp
-	ftypSize := uint32(24)
-	writer.WriteUint32(ftypSize)
+	ftyp, brands := r.Options.outputFtyp()
+	writer.WriteUint32(uint32(16 + 4*len(brands)))
 	writer.WriteTag("ftyp")
-	writer.WriteTag("isom")
-	writer.WriteUint32(512)
-	writer.WriteTag("isom")
-	writer.WriteTag("mp41")
+	writer.WriteTag(ftyp.MajorBrand)
+	writer.WriteUint32(ftyp.MinorVersion)
+	for _, brand := range brands {
+		writer.WriteTag(brand)
+	}
+
+	headerSize := r.Options.headerSize()
+	if r.Options.Deterministic {
+		writer.WriteUint32(deterministicFreeSize)
+		writer.WriteTag("free")
+		writer.WriteBytes(make([]byte, deterministicFreeSize-8))
+	}
 
 	// 2. Build Interleaved Sample Order
-	interleaved := buildInterleavedOrder(tracks)
-	fmt.Printf("[Remuxer] Interleaved %d total samples across %d tracks\n", len(interleaved), len(tracks))
+	interleaved := buildInterleavedOrder(tracks, r.Options)
+	r.logger().Printf("[Remuxer] Interleaved %d total samples across %d tracks\n", len(interleaved), len(tracks))
 
 	// 3. Calculate mdat size
 	mdatDataSize := int64(0)
@@ -42,15 +306,14 @@ func (r *Remuxer) WriteMultiTrackFile(outputFile string, tracks []Track) error {
 		mdatDataSize += is.Sample.Size
 	}
 
-	// 4. Determine if we need co64 (offsets > 4GB)
-	useCo64 := mdatDataSize > (1 << 31) // Conservative: 2GB threshold for safety
-
-	// 5. Generate moov with dummy offsets to calculate its size
-	dummyMoov := makeMoovMultiTrack(tracks, interleaved, 0, useCo64)
-	dummyBytes := serializeAtom(dummyMoov)
-
-	// 6. Calculate real mdat start position
-	mdatStartPos := int64(ftypSize) + int64(len(dummyBytes)) + 8 // +8 for mdat header
+	// 4-6. Decide co64 per track and size the moov to find where mdat starts
+	useCo64, moovSize := layoutMoov(tracks, interleaved, headerSize, r.Options)
+	mdatStartPos := headerSize + moovSize + mdatHeaderSize(mdatDataSize)
+	for i, large := range useCo64 {
+		if large {
+			r.logger().Printf("[Remuxer] Track %d: offsets past %d bytes, using co64\n", i+1, int64(co64Threshold))
+		}
+	}
 
 	// 7. Calculate real offsets per sample based on interleaved order
 	offsets := make([]int64, len(interleaved))
@@ -62,39 +325,129 @@ func (r *Remuxer) WriteMultiTrackFile(outputFile string, tracks []Track) error {
 	}
 
 	// 8. Generate REAL moov with correct offsets
-	moov := makeMoovMultiTrackWithOffsets(tracks, interleaved, offsets, useCo64)
+	moov := makeMoovMultiTrackWithOffsets(tracks, interleaved, offsets, useCo64, r.Options)
 	moovBytes := serializeAtom(moov)
 
 	// 9. Write moov
 	writer.WriteBytes(moovBytes)
 
 	// 10. Write mdat header
-	writer.WriteUint32(uint32(mdatDataSize + 8))
-	writer.WriteTag("mdat")
+	writeMdatHeader(writer, mdatDataSize)
 
 	// 11. Write mdat body (INTERLEAVED!)
-	copyBuffer := make([]byte, 1024*1024)
-	fmt.Printf("[Remuxer] Writing interleaved mdat (%d bytes)...\n", mdatDataSize)
+	r.logger().Printf("[Remuxer] Writing interleaved mdat (%d bytes)...\n", mdatDataSize)
+	if r.Options.SortedReads {
+		return r.writeMdatSorted(out, interleaved, offsets, mdatStartPos, mdatDataSize, filepath.Dir(outputFile))
+	}
 
+	copyBuffer := make([]byte, 1024*1024)
 	for _, is := range interleaved {
-		_, err := r.InputFile.Seek(is.Sample.Offset, 0)
+		src, err := r.sourceFor(is.Sample)
+		if err != nil {
+			return err
+		}
+		_, err = src.Seek(is.Sample.Offset, 0)
 		if err != nil {
 			return fmt.Errorf("seek error at offset %d: %w", is.Sample.Offset, err)
 		}
-		limitReader := io.LimitReader(r.InputFile, is.Sample.Size)
-		_, err = io.CopyBuffer(out, limitReader, copyBuffer)
+		limitReader := io.LimitReader(src, is.Sample.Size)
+		n, err := io.CopyBuffer(out, limitReader, copyBuffer)
 		if err != nil {
 			return fmt.Errorf("copy error: %w", err)
 		}
+		if n != is.Sample.Size {
+			return fmt.Errorf("short read for sample %d at offset %d: got %d of %d bytes", is.Sample.ID, is.Sample.Offset, n, is.Sample.Size)
+		}
 	}
 
 	return nil
 }
 
+// writeMdatSorted is the SortedReads mdat writer: samples are read in
+// (source, offset) order into a staging area at their interleaved position,
+// which is then written to out in one pass
+func (r *Remuxer) writeMdatSorted(out io.Writer, interleaved []InterleavedSample, offsets []int64, mdatStart, mdatSize int64, scratchDir string) error {
+	limit := r.Options.SortedReadMemory
+	if limit <= 0 {
+		limit = defaultSortedReadMemory
+	}
+
+	var staging io.WriterAt
+	var memory []byte
+	var scratch *os.File
+	if mdatSize <= limit {
+		memory = make([]byte, mdatSize)
+	} else {
+		var err error
+		scratch, err = os.CreateTemp(scratchDir, ".cromedia-mdat-*")
+		if err != nil {
+			return fmt.Errorf("create scratch file: %w", err)
+		}
+		defer os.Remove(scratch.Name())
+		defer scratch.Close()
+		staging = scratch
+		r.logger().Printf("[Remuxer] Staging %d bytes in %s\n", mdatSize, scratch.Name())
+	}
+
+	order := make([]int, len(interleaved))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		sa, sb := interleaved[order[a]].Sample, interleaved[order[b]].Sample
+		if sa.Source != sb.Source {
+			return sa.Source < sb.Source
+		}
+		return sa.Offset < sb.Offset
+	})
+
+	// Only seek on gaps (headers, other boxes) or when switching inputs
+	positions := make(map[int]int64)
+	buf := make([]byte, 0, 1024*1024)
+	for _, i := range order {
+		s := interleaved[i].Sample
+		src, err := r.sourceFor(s)
+		if err != nil {
+			return err
+		}
+		if pos, ok := positions[r.sourceIndex(s)]; !ok || pos != s.Offset {
+			if _, err := src.Seek(s.Offset, io.SeekStart); err != nil {
+				return fmt.Errorf("seek error at offset %d: %w", s.Offset, err)
+			}
+		}
+		if int64(cap(buf)) < s.Size {
+			buf = make([]byte, s.Size)
+		}
+		data := buf[:s.Size]
+		if _, err := io.ReadFull(src, data); err != nil {
+			return fmt.Errorf("short read for sample %d at offset %d: %w", s.ID, s.Offset, err)
+		}
+		positions[r.sourceIndex(s)] = s.Offset + s.Size
+
+		at := offsets[i] - mdatStart
+		if memory != nil {
+			copy(memory[at:], data)
+		} else if _, err := staging.WriteAt(data, at); err != nil {
+			return fmt.Errorf("write scratch: %w", err)
+		}
+	}
+
+	if memory != nil {
+		_, err := out.Write(memory)
+		return err
+	}
+	if _, err := io.Copy(out, io.NewSectionReader(scratch, 0, mdatSize)); err != nil {
+		return fmt.Errorf("copy scratch: %w", err)
+	}
+	return nil
+}
+
 // buildInterleavedOrder creates a sorted list of all samples across all tracks,
 // ordered by presentation time in seconds. This ensures audio and video chunks
-// are naturally interleaved for streaming playback.
-func buildInterleavedOrder(tracks []Track) []InterleavedSample {
+// are naturally interleaved for streaming playback. With PreserveChunking or
+// ChunkTarget, samples of a chunk share the chunk's start time so they stay
+// adjacent.
+func buildInterleavedOrder(tracks []Track, opts RemuxOptions) []InterleavedSample {
 	var all []InterleavedSample
 
 	for ti, t := range tracks {
@@ -102,8 +455,26 @@ func buildInterleavedOrder(tracks []Track) []InterleavedSample {
 		if ts == 0 {
 			ts = 1000
 		}
+		keepChunks := opts.PreserveChunking && t.preservedChunks() > 0
+		var groups []int
+		if !keepChunks {
+			groups = groupedChunks(t, opts)
+		}
+		chunkStart := int64(0)
 		for si, s := range t.Samples {
-			timeSeconds := float64(s.Time) / ts
+			sortTime := s.Time
+			if keepChunks {
+				if si == 0 || s.Chunk != t.Samples[si-1].Chunk {
+					chunkStart = s.Time
+				}
+				sortTime = chunkStart
+			} else if groups != nil {
+				if si == 0 || groups[si] != groups[si-1] {
+					chunkStart = s.Time
+				}
+				sortTime = chunkStart
+			}
+			timeSeconds := float64(sortTime) / ts
 			all = append(all, InterleavedSample{
 				TrackIndex:  ti,
 				SampleIndex: si,
@@ -124,17 +495,225 @@ func buildInterleavedOrder(tracks []Track) []InterleavedSample {
 	return all
 }
 
+// groupedChunks assigns the samples of t to chunks for opts.ChunkTarget:
+// consecutive samples are added to a chunk until it holds ChunkTarget bytes
+// or spans maxGroupedChunkDuration. A sample larger than the target gets a
+// chunk of its own, and a chunk never mixes sample descriptions. Returns the
+// 0-based chunk of every sample, or nil when samples are written one per chunk.
+func groupedChunks(t Track, opts RemuxOptions) []int {
+	if opts.ChunkTarget <= 0 || len(t.Samples) == 0 {
+		return nil
+	}
+	timescale := int64(t.Timescale)
+	if timescale == 0 {
+		timescale = 1000
+	}
+	maxSpan := int64(maxGroupedChunkDuration) * timescale / int64(time.Second)
+
+	chunks := make([]int, len(t.Samples))
+	chunk, bytes, start := 0, int64(0), t.Samples[0].Time
+	for i, s := range t.Samples {
+		newDescription := i > 0 && sampleDescription(s) != sampleDescription(t.Samples[i-1])
+		if i > 0 && (bytes+s.Size > opts.ChunkTarget || s.Time-start >= maxSpan || newDescription) {
+			chunk++
+			bytes, start = 0, s.Time
+		}
+		chunks[i] = chunk
+		bytes += s.Size
+	}
+	return chunks
+}
+
+// sampleDescription returns the 1-based stsd entry index of s
+func sampleDescription(s Sample) uint32 {
+	if s.Description < 1 {
+		return 1
+	}
+	return uint32(s.Description)
+}
+
+// mixedDescriptions reports whether samples use more than one stsd entry
+func mixedDescriptions(samples []Sample) bool {
+	for _, s := range samples {
+		if sampleDescription(s) != sampleDescription(samples[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// stscPayload builds the stsc for a per-sample chunk assignment (as returned
+// by groupedChunks), with one entry per run of equally sized chunks of the
+// same sample description
+func stscPayload(chunks []int, samples []Sample) []byte {
+	type entry struct {
+		firstChunk      uint32
+		samplesPerChunk uint32
+		description     uint32
+	}
+	var entries []entry
+	for i := 0; i < len(chunks); {
+		j := i
+		for j < len(chunks) && chunks[j] == chunks[i] {
+			j++
+		}
+		n, desc := uint32(j-i), sampleDescription(samples[i])
+		if k := len(entries); k == 0 || entries[k-1].samplesPerChunk != n || entries[k-1].description != desc {
+			entries = append(entries, entry{firstChunk: uint32(chunks[i]) + 1, samplesPerChunk: n, description: desc})
+		}
+		i = j
+	}
+
+	buf := new(ExcludeBuffer)
+	buf.WriteUint32(0) // Version + Flags
+	buf.WriteUint32(uint32(len(entries)))
+	for _, e := range entries {
+		buf.WriteUint32(e.firstChunk)
+		buf.WriteUint32(e.samplesPerChunk)
+		buf.WriteUint32(e.description)
+	}
+	return buf.Bytes()
+}
+
+// sttsPayload builds the stts for samples, run-length encoding consecutive
+// samples of equal duration into (count, delta) entries the way encoders do:
+// a constant frame rate track needs a single entry.
+func sttsPayload(samples []Sample) []byte {
+	type run struct {
+		count uint32
+		delta uint32
+	}
+	var runs []run
+	for _, s := range samples {
+		delta := uint32(s.Duration)
+		if n := len(runs); n > 0 && runs[n-1].delta == delta {
+			runs[n-1].count++
+			continue
+		}
+		runs = append(runs, run{count: 1, delta: delta})
+	}
+
+	buf := new(ExcludeBuffer)
+	buf.WriteUint32(0) // Version 0 + Flags
+	buf.WriteUint32(uint32(len(runs)))
+	for _, r := range runs {
+		buf.WriteUint32(r.count)
+		buf.WriteUint32(r.delta)
+	}
+	return buf.Bytes()
+}
+
+// cttsPayload builds a ctts covering numSamples samples, run-length encoding
+// identical consecutive offsets into (count, offset) entries. Samples past
+// the end of offsets get 0.
+func cttsPayload(offsets []int32, numSamples int) []byte {
+	type run struct {
+		count  uint32
+		offset int32
+	}
+	var runs []run
+	for i := 0; i < numSamples; i++ {
+		off := int32(0)
+		if i < len(offsets) {
+			off = offsets[i]
+		}
+		if n := len(runs); n > 0 && runs[n-1].offset == off {
+			runs[n-1].count++
+			continue
+		}
+		runs = append(runs, run{count: 1, offset: off})
+	}
+
+	buf := new(ExcludeBuffer)
+	buf.WriteUint32(0) // Version 0 + Flags
+	buf.WriteUint32(uint32(len(runs)))
+	for _, r := range runs {
+		buf.WriteUint32(r.count)
+		buf.WriteUint32(uint32(r.offset))
+	}
+	return buf.Bytes()
+}
+
+// mdatHeaderSize is the size of the mdat header for a payload of dataSize
+// bytes: 8, or 16 for the 64-bit large-size form when the box exceeds 4GB
+func mdatHeaderSize(dataSize int64) int64 {
+	if dataSize+8 > math.MaxUint32 {
+		return 16
+	}
+	return 8
+}
+
+// writeMdatHeader writes an mdat header for a dataSize-byte payload, using
+// size=1 plus a 64-bit largesize when the 32-bit size field would overflow
+func writeMdatHeader(w *AtomWriter, dataSize int64) {
+	if mdatHeaderSize(dataSize) == 16 {
+		w.WriteUint32(1)
+		w.WriteTag("mdat")
+		w.WriteUint64(uint64(dataSize + 16))
+		return
+	}
+	w.WriteUint32(uint32(dataSize + 8))
+	w.WriteTag("mdat")
+}
+
+// Chunk offsets at or past this use co64. Conservative: 2GB rather than 4GB,
+// as some readers treat stco entries as signed.
+const co64Threshold = 1 << 31
+
+// chooseCo64 decides, per track, whether its chunk offsets need co64 when the
+// mdat payload starts at mdatStart. Small tracks keep the compact stco even
+// when another track in the same file needs 64-bit offsets.
+func chooseCo64(tracks []Track, interleaved []InterleavedSample, mdatStart int64) []bool {
+	useCo64 := make([]bool, len(tracks))
+	pos := mdatStart
+	for _, is := range interleaved {
+		if pos >= co64Threshold {
+			useCo64[is.TrackIndex] = true
+		}
+		pos += is.Sample.Size
+	}
+	return useCo64
+}
+
+// layoutMoov returns the per-track co64 decisions and the size of the moov
+// written after headerSize bytes. Switching a track to co64 grows the moov,
+// which moves every offset; iterate until the decisions are stable. Decisions
+// only ever flip to co64, so this ends within len(tracks)+1 rounds.
+func layoutMoov(tracks []Track, interleaved []InterleavedSample, headerSize int64, opts RemuxOptions) ([]bool, int64) {
+	mdatDataSize := int64(0)
+	for _, is := range interleaved {
+		mdatDataSize += is.Sample.Size
+	}
+	mdatHeader := mdatHeaderSize(mdatDataSize)
+
+	useCo64 := chooseCo64(tracks, interleaved, headerSize+mdatHeader)
+	for {
+		moovSize := int64(len(serializeAtom(makeMoovMultiTrack(tracks, interleaved, 0, useCo64, opts))))
+		next := chooseCo64(tracks, interleaved, headerSize+moovSize+mdatHeader)
+		changed := false
+		for i := range next {
+			if next[i] && !useCo64[i] {
+				useCo64[i] = true
+				changed = true
+			}
+		}
+		if !changed {
+			return useCo64, moovSize
+		}
+	}
+}
+
 // makeMoovMultiTrack creates a moov atom with dummy offset 0 (for size calculation)
-func makeMoovMultiTrack(tracks []Track, interleaved []InterleavedSample, baseOffset int64, useCo64 bool) *SimpleAtom {
+func makeMoovMultiTrack(tracks []Track, interleaved []InterleavedSample, baseOffset int64, useCo64 []bool, opts RemuxOptions) *SimpleAtom {
 	dummyOffsets := make([]int64, len(interleaved))
 	for i := range dummyOffsets {
 		dummyOffsets[i] = baseOffset
 	}
-	return makeMoovMultiTrackWithOffsets(tracks, interleaved, dummyOffsets, useCo64)
+	return makeMoovMultiTrackWithOffsets(tracks, interleaved, dummyOffsets, useCo64, opts)
 }
 
 // makeMoovMultiTrackWithOffsets creates moov with real offsets from interleaved order
-func makeMoovMultiTrackWithOffsets(tracks []Track, interleaved []InterleavedSample, offsets []int64, useCo64 bool) *SimpleAtom {
+func makeMoovMultiTrackWithOffsets(tracks []Track, interleaved []InterleavedSample, offsets []int64, useCo64 []bool, opts RemuxOptions) *SimpleAtom {
 	// Build per-track offset maps: trackIndex -> sampleIndex -> offset
 	trackOffsets := make(map[int]map[int]int64)
 	for i, is := range interleaved {
@@ -145,45 +724,148 @@ func makeMoovMultiTrackWithOffsets(tracks []Track, interleaved []InterleavedSamp
 	}
 
 	var traks []*SimpleAtom
-	for i, t := range tracks {
+	for i, t := range remapTrackReferences(tracks) {
 		sampleOffsets := trackOffsets[i]
-		trak := makeTrakAtom(t, i+1, sampleOffsets, useCo64)
+		trak := makeTrakAtom(t, i+1, sampleOffsets, i < len(useCo64) && useCo64[i], opts)
 		traks = append(traks, trak)
 	}
 
 	// mvhd
-	mvhdTimescale := uint32(1000)
 	maxDuration := int64(0)
 	for _, t := range tracks {
-		totalDur := int64(0)
-		for _, s := range t.Samples {
-			totalDur += s.Duration
-		}
-		dur := convertTime(uint64(totalDur), t.Timescale, mvhdTimescale)
+		dur := trackMovieDuration(t, opts.movieTimescale())
 		if dur > maxDuration {
 			maxDuration = dur
 		}
 	}
 
+	creation, modification := opts.movieHeaderTimes()
+
+	mvhdVersion := headerVersion(maxDuration, creation, modification)
 	mvhdData := new(ExcludeBuffer)
-	mvhdData.WriteUint32(0) // Version + Flags
-	mvhdData.WriteUint32(0) // Creation
-	mvhdData.WriteUint32(0) // Modification
-	mvhdData.WriteUint32(mvhdTimescale)
-	mvhdData.WriteUint32(uint32(maxDuration))
+	mvhdData.WriteUint32(uint32(mvhdVersion) << 24) // Version + Flags
+	mvhdData.writeHeaderTimes(mvhdVersion, creation, modification)
+	mvhdData.WriteUint32(opts.movieTimescale())
+	mvhdData.writeVersionedUint(mvhdVersion, uint64(maxDuration))
 	mvhdData.WriteUint32(0x00010000)      // Rate (1.0)
 	mvhdData.WriteUint16(0x0100)          // Volume (1.0)
 	mvhdData.WriteBytes(make([]byte, 10)) // Reserved
-	mvhdData.WriteBytes(identityMatrix())
+	mvhdData.WriteBytes(opts.movieMatrix())
 	mvhdData.WriteBytes(make([]byte, 24))         // Pre-defined
 	mvhdData.WriteUint32(uint32(len(tracks) + 1)) // Next Track ID
 
 	children := []*SimpleAtom{{Type: "mvhd", Data: mvhdData.Bytes()}}
 	children = append(children, traks...)
+	if opts.WriteToolTag {
+		children = append(children, makeToolUdta(toolName))
+	}
 
 	return &SimpleAtom{Type: "moov", Children: children}
 }
 
+// makeToolUdta builds udta/meta with an iTunes-style item list holding a
+// single ©too (encoding tool) entry. meta is a FullBox and must carry an
+// 'mdir' handler for readers to interpret the ilst.
+func makeToolUdta(tool string) *SimpleAtom {
+	hdlrData := new(ExcludeBuffer)
+	hdlrData.WriteUint32(0) // Version + Flags
+	hdlrData.WriteUint32(0) // Pre-defined
+	hdlrData.WriteBytes([]byte("mdir"))
+	hdlrData.WriteBytes([]byte("appl"))  // Reserved[0], conventionally 'appl'
+	hdlrData.WriteBytes(make([]byte, 8)) // Reserved[1..2]
+	hdlrData.WriteBytes([]byte{0})       // Empty name
+
+	data := new(ExcludeBuffer)
+	data.WriteUint32(1) // Well-known type: UTF-8
+	data.WriteUint32(0) // Locale
+	data.WriteBytes([]byte(tool))
+
+	item := &SimpleAtom{Type: "\xa9too", Children: []*SimpleAtom{{Type: "data", Data: data.Bytes()}}}
+
+	meta := &SimpleAtom{
+		Type: "meta",
+		Data: []byte{0, 0, 0, 0}, // Version + Flags
+		Children: []*SimpleAtom{
+			{Type: "hdlr", Data: hdlrData.Bytes()},
+			{Type: "ilst", Children: []*SimpleAtom{item}},
+		},
+	}
+	return &SimpleAtom{Type: "udta", Children: []*SimpleAtom{meta}}
+}
+
+// Overhead compares the container cost (moov) with the media payload (mdat)
+type Overhead struct {
+	HeaderBytes int64 // ftyp and reserved free box before the moov
+	MoovBytes   int64
+	MdatBytes   int64
+	Ratio       float64 // MoovBytes / MdatBytes, 0 when there is no media
+}
+
+func (o Overhead) String() string {
+	return fmt.Sprintf("header %d bytes, moov %d bytes / mdat %d bytes (%.2f%%)", o.HeaderBytes, o.MoovBytes, o.MdatBytes, o.Ratio*100)
+}
+
+// EstimateOverhead builds the moov the remuxer would write for tracks with
+// opts and measures it against the mdat payload, without touching any file.
+// Useful as a before/after metric for table compaction.
+func EstimateOverhead(tracks []Track, opts RemuxOptions) Overhead {
+	interleaved := buildInterleavedOrder(tracks, opts)
+
+	var o Overhead
+	for _, is := range interleaved {
+		o.MdatBytes += is.Sample.Size
+	}
+	o.HeaderBytes = opts.headerSize()
+	_, o.MoovBytes = layoutMoov(tracks, interleaved, o.HeaderBytes, opts)
+	if o.MdatBytes > 0 {
+		o.Ratio = float64(o.MoovBytes) / float64(o.MdatBytes)
+	}
+	return o
+}
+
+// Sample tables the remuxer regenerates from the samples themselves. They may
+// legitimately be absent from the output (e.g. no stss when every sample is a
+// sync sample, co64 replaced by stco) without any information being lost.
+var regeneratedBoxes = map[string]bool{
+	"stts": true, "stss": true, "ctts": true, "stsz": true, "stz2": true,
+	"stsc": true, "stco": true, "co64": true, "edts": true, "elst": true,
+}
+
+// checkCarriedBoxes returns an error listing, per track, the source boxes
+// that the written trak would not contain.
+func checkCarriedBoxes(tracks []Track, opts RemuxOptions) error {
+	var problems []string
+	for i, t := range remapTrackReferences(tracks) {
+		written := make(map[string]bool)
+		var walk func(children []*SimpleAtom, prefix string)
+		walk = func(children []*SimpleAtom, prefix string) {
+			for _, c := range children {
+				path := prefix + c.Type
+				written[path] = true
+				walk(c.Children, path+"/")
+			}
+		}
+		walk(makeTrakAtom(t, i+1, nil, false, opts).Children, "")
+
+		var lost []string
+		for _, path := range t.SourceBoxes {
+			if regeneratedBoxes[path[strings.LastIndex(path, "/")+1:]] {
+				continue
+			}
+			if !written[path] {
+				lost = append(lost, path)
+			}
+		}
+		if len(lost) > 0 {
+			problems = append(problems, fmt.Sprintf("track %d: %s", t.ID, strings.Join(lost, ", ")))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("strict mode: source boxes would be dropped (%s)", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
 func identityMatrix() []byte {
 	return []byte{
 		0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
@@ -192,17 +874,11 @@ func identityMatrix() []byte {
 	}
 }
 
-func makeTrakAtom(t Track, trackID int, sampleOffsets map[int]int64, useCo64 bool) *SimpleAtom {
+func makeTrakAtom(t Track, trackID int, sampleOffsets map[int]int64, useCo64 bool, opts RemuxOptions) *SimpleAtom {
 	numSamples := len(t.Samples)
 
 	// 1. stts (Time-to-Sample)
-	sttsData := new(ExcludeBuffer)
-	sttsData.WriteUint32(0) // Version + Flags
-	sttsData.WriteUint32(uint32(numSamples))
-	for _, s := range t.Samples {
-		sttsData.WriteUint32(1)
-		sttsData.WriteUint32(uint32(s.Duration))
-	}
+	sttsData := sttsPayload(t.Samples)
 
 	// 2. stsz (Sample Sizes)
 	stszData := new(ExcludeBuffer)
@@ -213,14 +889,41 @@ func makeTrakAtom(t Track, trackID int, sampleOffsets map[int]int64, useCo64 boo
 		stszData.WriteUint32(uint32(s.Size))
 	}
 
+	// Chunk layout: one chunk per sample, the source chunks when preserved,
+	// or chunks grouped up to ChunkTarget bytes
+	chunkOffsets := make([]int64, 0, numSamples)
+	numSourceChunks := 0
+	if opts.PreserveChunking {
+		numSourceChunks = t.preservedChunks()
+	}
+	var groups []int
+	if numSourceChunks == 0 {
+		groups = groupedChunks(t, opts)
+	}
+	if groups == nil && numSourceChunks == 0 && mixedDescriptions(t.Samples) {
+		// One sample per chunk, but stsc must say which entry each one uses
+		groups = make([]int, numSamples)
+		for i := range groups {
+			groups[i] = i
+		}
+	}
+	for i := 0; i < numSamples; i++ {
+		if numSourceChunks > 0 && i > 0 && t.Samples[i].Chunk == t.Samples[i-1].Chunk {
+			continue // Not the first sample of its chunk
+		}
+		if groups != nil && i > 0 && groups[i] == groups[i-1] {
+			continue
+		}
+		chunkOffsets = append(chunkOffsets, sampleOffsets[i])
+	}
+
 	// 3. stco/co64 (Chunk Offsets) - Using interleaved offsets!
 	var chunkOffsetAtom *SimpleAtom
 	if useCo64 {
 		co64Data := new(ExcludeBuffer)
 		co64Data.WriteUint32(0)
-		co64Data.WriteUint32(uint32(numSamples))
-		for i := 0; i < numSamples; i++ {
-			off := sampleOffsets[i]
+		co64Data.WriteUint32(uint32(len(chunkOffsets)))
+		for _, off := range chunkOffsets {
 			co64Data.WriteUint32(uint32(off >> 32)) // High 32
 			co64Data.WriteUint32(uint32(off))       // Low 32
 		}
@@ -228,24 +931,35 @@ func makeTrakAtom(t Track, trackID int, sampleOffsets map[int]int64, useCo64 boo
 	} else {
 		stcoData := new(ExcludeBuffer)
 		stcoData.WriteUint32(0)
-		stcoData.WriteUint32(uint32(numSamples))
-		for i := 0; i < numSamples; i++ {
-			stcoData.WriteUint32(uint32(sampleOffsets[i]))
+		stcoData.WriteUint32(uint32(len(chunkOffsets)))
+		for _, off := range chunkOffsets {
+			stcoData.WriteUint32(uint32(off))
 		}
 		chunkOffsetAtom = &SimpleAtom{Type: "stco", Data: stcoData.Bytes()}
 	}
 
 	// 4. stsc (Sample-to-Chunk)
 	stscData := new(ExcludeBuffer)
-	stscData.WriteUint32(0) // Version + Flags
-	stscData.WriteUint32(1) // Entry count
-	stscData.WriteUint32(1) // First Chunk
-	stscData.WriteUint32(1) // Samples Per Chunk (1:1 map for interleaving)
-	stscData.WriteUint32(1) // Sample Description ID
+	if numSourceChunks > 0 {
+		stscData.WriteBytes(t.SourceTables.Stsc)
+	} else if groups != nil {
+		stscData.WriteBytes(stscPayload(groups, t.Samples))
+	} else {
+		stscData.WriteUint32(0) // Version + Flags
+		stscData.WriteUint32(1) // Entry count
+		stscData.WriteUint32(1) // First Chunk
+		stscData.WriteUint32(1) // Samples Per Chunk (1:1 map for interleaving)
+		desc := uint32(1)       // Sample Description ID
+		if numSamples > 0 {
+			desc = sampleDescription(t.Samples[0])
+		}
+		stscData.WriteUint32(desc)
+	}
 
-	// 5. stss (Sync Samples / Keyframes) - Video only
+	// 5. stss (Sync Samples / Keyframes) - Video only. Omitted when every
+	// sample is a sync sample, which is what a missing stss means.
 	var stssAtom *SimpleAtom
-	if t.Type == TrackTypeVideo {
+	if t.Type == TrackTypeVideo && !allKeyframes(t.Samples) {
 		var keyframes []int
 		for i, s := range t.Samples {
 			if s.IsKeyframe {
@@ -264,21 +978,28 @@ func makeTrakAtom(t Track, trackID int, sampleOffsets map[int]int64, useCo64 boo
 	// 6. ctts (Composition Time to Sample) - B-Frame support
 	var cttsAtom *SimpleAtom
 	if len(t.CTSOffsets) > 0 {
-		cttsBuf := new(ExcludeBuffer)
-		cttsBuf.WriteUint32(0) // Version 0 + Flags
-		cttsBuf.WriteUint32(uint32(len(t.CTSOffsets)))
-		for _, off := range t.CTSOffsets {
-			cttsBuf.WriteUint32(1) // Count = 1 per entry (expanded)
-			cttsBuf.WriteUint32(uint32(off))
+		cttsAtom = &SimpleAtom{Type: "ctts", Data: cttsPayload(t.CTSOffsets, numSamples)}
+	}
+
+	// Unchanged sample set: keep the source's compact stts/stsz/stss/ctts
+	// verbatim. Only the chunk layout (stco/co64 + stsc) depends on our mdat.
+	sttsBytes, stszBytes := sttsData, stszData.Bytes()
+	if orig := t.unchangedTables(); orig != nil {
+		sttsBytes, stszBytes = orig.Stts, orig.Stsz
+		stssAtom, cttsAtom = nil, nil
+		if orig.Stss != nil {
+			stssAtom = &SimpleAtom{Type: "stss", Data: orig.Stss}
+		}
+		if orig.Ctts != nil {
+			cttsAtom = &SimpleAtom{Type: "ctts", Data: orig.Ctts}
 		}
-		cttsAtom = &SimpleAtom{Type: "ctts", Data: cttsBuf.Bytes()}
 	}
 
 	// Build stbl
 	stblChildren := []*SimpleAtom{
 		{Type: "stsd", Data: t.Stsd},
-		{Type: "stts", Data: sttsData.Bytes()},
-		{Type: "stsz", Data: stszData.Bytes()},
+		{Type: "stts", Data: sttsBytes},
+		{Type: "stsz", Data: stszBytes},
 		chunkOffsetAtom,
 		{Type: "stsc", Data: stscData.Bytes()},
 	}
@@ -293,36 +1014,46 @@ func makeTrakAtom(t Track, trackID int, sampleOffsets map[int]int64, useCo64 boo
 	// minf
 	minfChildren := []*SimpleAtom{}
 	if t.MediaHeader != nil {
-		headerType := "vmhd"
-		if t.Type == TrackTypeAudio {
-			headerType = "smhd"
+		headerType := t.MediaHeaderType
+		if headerType == "" {
+			headerType = "vmhd"
+			if t.Type == TrackTypeAudio {
+				headerType = "smhd"
+			}
 		}
 		minfChildren = append(minfChildren, &SimpleAtom{Type: headerType, Data: t.MediaHeader})
+	} else if t.Type == TrackTypeMeta {
+		// minf requires a media header: timed metadata uses the null media header
+		minfChildren = append(minfChildren, &SimpleAtom{Type: "nmhd", Data: []byte{0, 0, 0, 0}})
 	}
-	dinf := &SimpleAtom{Type: "dinf", Children: []*SimpleAtom{
-		{Type: "dref", Data: []byte{
+	// Keep the source dref so the sample entry's data_reference_index stays valid
+	drefData := t.Dref
+	if drefData == nil {
+		drefData = []byte{
 			0, 0, 0, 0, // Version + Flags
 			0, 0, 0, 1, // Entry count
 			0, 0, 0, 12, 117, 114, 108, 32, 0, 0, 0, 1, // url entry
-		}},
+		}
+	}
+	dinf := &SimpleAtom{Type: "dinf", Children: []*SimpleAtom{
+		{Type: "dref", Data: drefData},
 	}}
 	minfChildren = append(minfChildren, dinf, stbl)
 	minf := &SimpleAtom{Type: "minf", Children: minfChildren}
 
-	// mdia
-	totalDur := int64(0)
-	for _, s := range t.Samples {
-		totalDur += s.Duration
-	}
+	// mdia: mdhd carries the media duration, before edits
+	totalDur := t.MediaDuration()
+
+	creation, modification := opts.trackHeaderTimes(t)
 
+	mdhdVersion := headerVersion(totalDur, creation, modification)
 	mdhdData := new(ExcludeBuffer)
-	mdhdData.WriteUint32(0)           // Version + Flags
-	mdhdData.WriteUint32(0)           // Creation
-	mdhdData.WriteUint32(0)           // Modification
+	mdhdData.WriteUint32(uint32(mdhdVersion) << 24) // Version + Flags
+	mdhdData.writeHeaderTimes(mdhdVersion, creation, modification)
 	mdhdData.WriteUint32(t.Timescale) // Timescale
-	mdhdData.WriteUint32(uint32(totalDur))
-	mdhdData.WriteUint16(0x55c4) // Language (undetermined)
-	mdhdData.WriteUint16(0)      // Quality
+	mdhdData.writeVersionedUint(mdhdVersion, uint64(totalDur))
+	mdhdData.WriteUint16(packLanguage(t.Language))
+	mdhdData.WriteUint16(0) // Quality
 
 	mdia := &SimpleAtom{Type: "mdia", Children: []*SimpleAtom{
 		{Type: "mdhd", Data: mdhdData.Bytes()},
@@ -331,14 +1062,14 @@ func makeTrakAtom(t Track, trackID int, sampleOffsets map[int]int64, useCo64 boo
 	}}
 
 	// tkhd
+	tkhdDur := trackMovieDuration(t, opts.movieTimescale()) // After edits, movie timescale
+	tkhdVersion := headerVersion(tkhdDur, creation, modification)
 	tkhdData := new(ExcludeBuffer)
-	tkhdData.WriteUint32(0x00000003) // Flags: Enabled(1) + InMovie(2)
-	tkhdData.WriteUint32(0)          // Creation
-	tkhdData.WriteUint32(0)          // Modification
+	tkhdData.WriteUint32(uint32(tkhdVersion)<<24 | 0x000003) // Flags: Enabled(1) + InMovie(2)
+	tkhdData.writeHeaderTimes(tkhdVersion, creation, modification)
 	tkhdData.WriteUint32(uint32(trackID))
 	tkhdData.WriteUint32(0) // Reserved
-	durMvhd := convertTime(uint64(totalDur), t.Timescale, 1000)
-	tkhdData.WriteUint32(uint32(durMvhd))
+	tkhdData.writeVersionedUint(tkhdVersion, uint64(tkhdDur))
 	tkhdData.WriteUint32(0) // Reserved
 	tkhdData.WriteUint32(0) // Reserved
 	tkhdData.WriteUint16(0) // Layer
@@ -346,31 +1077,48 @@ func makeTrakAtom(t Track, trackID int, sampleOffsets map[int]int64, useCo64 boo
 	vol := uint16(0)
 	if t.Type == TrackTypeAudio {
 		vol = 0x0100
+		if t.Volume != 0 {
+			vol = t.Volume
+		}
 	}
 	tkhdData.WriteUint16(vol) // Volume
 	tkhdData.WriteUint16(0)   // Reserved
 	// Use original matrix (preserves rotation) or fallback to identity
-	if len(t.Matrix) == 36 {
-		tkhdData.WriteBytes(t.Matrix)
-	} else {
-		tkhdData.WriteBytes(identityMatrix())
-	}
-	tkhdData.WriteUint32(t.Width)
-	tkhdData.WriteUint32(t.Height)
+	width, height, matrix := normalizedGeometry(t, opts.NormalizeRotation)
+	tkhdData.WriteBytes(matrix)
+	tkhdData.WriteUint32(width)
+	tkhdData.WriteUint32(height)
 
 	// Build trak children
 	trakChildren := []*SimpleAtom{
 		{Type: "tkhd", Data: tkhdData.Bytes()},
 	}
+	if tref := makeTrefAtom(t.References); tref != nil {
+		trakChildren = append(trakChildren, tref)
+	}
 
 	// edts (Edit List) — Sync correction propagation
 	if len(t.EditList) > 0 {
+		// Segments are clamped to the available media, as in the tkhd
+		// duration; version 1 when a duration or media time needs 64 bits
+		segs := t.editSegments(opts.movieTimescale())
+		version := uint8(0)
+		for i, e := range t.EditList {
+			if segs[i] > math.MaxUint32 || e.MediaTime > math.MaxInt32 || e.MediaTime < math.MinInt32 {
+				version = 1
+			}
+		}
 		elstData := new(ExcludeBuffer)
-		elstData.WriteUint32(0) // Version 0 + Flags
+		elstData.WriteUint32(uint32(version) << 24) // Version + Flags
 		elstData.WriteUint32(uint32(len(t.EditList)))
-		for _, e := range t.EditList {
-			elstData.WriteUint32(uint32(e.SegmentDuration))
-			elstData.WriteUint32(uint32(e.MediaTime)) // int32 in v0
+		for i, e := range t.EditList {
+			if version == 1 {
+				elstData.WriteUint64(uint64(segs[i]))
+				elstData.WriteUint64(uint64(e.MediaTime)) // -1 (empty edit) is all ones
+			} else {
+				elstData.WriteUint32(uint32(segs[i]))
+				elstData.WriteUint32(uint32(int32(e.MediaTime))) // int32 in v0: -1 (empty edit) is 0xFFFFFFFF
+			}
 			elstData.WriteUint16(uint16(e.MediaRateInt))
 			elstData.WriteUint16(uint16(e.MediaRateFrac))
 		}
@@ -385,11 +1133,21 @@ func makeTrakAtom(t Track, trackID int, sampleOffsets map[int]int64, useCo64 boo
 	return &SimpleAtom{Type: "trak", Children: trakChildren}
 }
 
+// convertTime rescales val from fromScale to toScale units, rounding down.
+// The product is taken in 128 bits; results past int64 saturate.
 func convertTime(val uint64, fromScale, toScale uint32) int64 {
 	if fromScale == 0 {
 		return 0
 	}
-	return int64(val) * int64(toScale) / int64(fromScale)
+	hi, lo := bits.Mul64(val, uint64(toScale))
+	if hi >= uint64(fromScale) {
+		return math.MaxInt64
+	}
+	q, _ := bits.Div64(hi, lo, uint64(fromScale))
+	if q > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(q)
 }
 
 // --- Atom Writer Helpers ---
@@ -402,6 +1160,10 @@ func (w *AtomWriter) WriteUint32(val uint32) {
 	binary.Write(w.w, binary.BigEndian, val)
 }
 
+func (w *AtomWriter) WriteUint64(val uint64) {
+	binary.Write(w.w, binary.BigEndian, val)
+}
+
 func (w *AtomWriter) WriteUint16(val uint16) {
 	binary.Write(w.w, binary.BigEndian, val)
 }
@@ -430,6 +1192,27 @@ func (b *ExcludeBuffer) WriteUint16(val uint16) {
 	b.buf = append(b.buf, tmp...)
 }
 
+func (b *ExcludeBuffer) WriteUint64(val uint64) {
+	tmp := make([]byte, 8)
+	binary.BigEndian.PutUint64(tmp, val)
+	b.buf = append(b.buf, tmp...)
+}
+
+// writeVersionedUint writes a field that is 32-bit in version 0 boxes and
+// 64-bit in version 1 boxes (creation/modification times, durations)
+func (b *ExcludeBuffer) writeVersionedUint(version uint8, val uint64) {
+	if version == 1 {
+		b.WriteUint64(val)
+		return
+	}
+	b.WriteUint32(uint32(val))
+}
+
+func (b *ExcludeBuffer) writeHeaderTimes(version uint8, creation, modification uint64) {
+	b.writeVersionedUint(version, creation)
+	b.writeVersionedUint(version, modification)
+}
+
 func (b *ExcludeBuffer) WriteBytes(data []byte) {
 	b.buf = append(b.buf, data...)
 }
@@ -0,0 +1,1200 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// makeHdlr builds a minimal hdlr payload for the given handler type
+func makeHdlr(handler string) []byte {
+	b := make([]byte, 25)
+	copy(b[8:12], handler)
+	return b
+}
+
+// writeSyntheticSource writes each track's samples to a temp file, filling every
+// sample with a distinct byte pattern, and fixes up the sample offsets.
+func writeSyntheticSource(t *testing.T, tracks []Track) *os.File {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "source.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+
+	offset := int64(0)
+	for ti := range tracks {
+		for si := range tracks[ti].Samples {
+			s := &tracks[ti].Samples[si]
+			s.Offset = offset
+			if _, err := f.Write(samplePattern(ti, si, s.Size)); err != nil {
+				t.Fatal(err)
+			}
+			offset += s.Size
+		}
+	}
+	return f
+}
+
+func samplePattern(trackIdx, sampleIdx int, size int64) []byte {
+	b := make([]byte, size)
+	for i := range b {
+		b[i] = byte(trackIdx*31 + sampleIdx*7 + i)
+	}
+	return b
+}
+
+func syntheticTrack(typ TrackType, timescale uint32, count int, duration, size int64) Track {
+	handler := string(typ)
+	tr := Track{
+		Type:      typ,
+		Timescale: timescale,
+		Hdlr:      makeHdlr(handler),
+		Stsd:      make([]byte, 8),
+	}
+	for i := 0; i < count; i++ {
+		tr.Samples = append(tr.Samples, Sample{
+			ID:         i + 1,
+			IsKeyframe: i%5 == 0,
+			Size:       size + int64(i%3),
+			Time:       int64(i) * duration,
+			Duration:   duration,
+		})
+	}
+	return tr
+}
+
+func TestWriteMultiTrackFileOffsets(t *testing.T) {
+	tracks := []Track{
+		syntheticTrack(TrackTypeVideo, 30000, 20, 1001, 300),
+		syntheticTrack(TrackTypeAudio, 48000, 30, 1024, 40),
+	}
+	src := writeSyntheticSource(t, tracks)
+
+	outPath := filepath.Join(t.TempDir(), "out.mp4")
+	remuxer := &Remuxer{InputFile: src}
+	if err := remuxer.WriteMultiTrackFile(outPath, tracks); err != nil {
+		t.Fatalf("WriteMultiTrackFile failed: %v", err)
+	}
+
+	out, err := os.Open(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	atoms, err := FastProbe(out)
+	if err != nil {
+		t.Fatalf("FastProbe on output failed: %v", err)
+	}
+	var moov *Atom
+	for i := range atoms {
+		if atoms[i].Type == "moov" {
+			moov = &atoms[i]
+		}
+	}
+	if moov == nil {
+		t.Fatal("output has no moov")
+	}
+
+	demuxer := NewDemuxer(out)
+	trakIdx := 0
+	for _, trak := range moov.Children {
+		if trak.Type != "trak" {
+			continue
+		}
+		_, _, stco, stsz, _ := demuxer.LocateTables(trak)
+		if stco == nil || stsz == nil {
+			t.Fatalf("trak %d: missing stco/stsz", trakIdx)
+		}
+		offsets, err := demuxer.ParseStco(*stco)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, sizes, err := demuxer.ParseStsz(*stsz)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(offsets) != len(tracks[trakIdx].Samples) {
+			t.Fatalf("trak %d: expected %d offsets, got %d", trakIdx, len(tracks[trakIdx].Samples), len(offsets))
+		}
+
+		for _, si := range []int{0, len(offsets) - 1} {
+			buf := make([]byte, sizes[si])
+			if _, err := out.Seek(int64(offsets[si]), io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.ReadFull(out, buf); err != nil {
+				t.Fatalf("trak %d sample %d: read failed: %v", trakIdx, si, err)
+			}
+			want := samplePattern(trakIdx, si, int64(sizes[si]))
+			if !bytes.Equal(buf, want) {
+				t.Errorf("trak %d sample %d: offset %d does not point at the sample bytes", trakIdx, si, offsets[si])
+			}
+		}
+		trakIdx++
+	}
+	if trakIdx != len(tracks) {
+		t.Errorf("expected %d traks in output, got %d", len(tracks), trakIdx)
+	}
+}
+
+func TestWriteMultiTrackFileDeterministic(t *testing.T) {
+	tracks := []Track{
+		syntheticTrack(TrackTypeVideo, 30000, 10, 1001, 100),
+		syntheticTrack(TrackTypeAudio, 48000, 15, 1024, 20),
+	}
+	src := writeSyntheticSource(t, tracks)
+	remuxer := &Remuxer{InputFile: src, Options: RemuxOptions{Deterministic: true}}
+
+	var outputs [][]byte
+	for i := 0; i < 2; i++ {
+		outPath := filepath.Join(t.TempDir(), "det.mp4")
+		if err := remuxer.WriteMultiTrackFile(outPath, tracks); err != nil {
+			t.Fatalf("WriteMultiTrackFile failed: %v", err)
+		}
+		data, err := os.ReadFile(outPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, data)
+	}
+
+	if !bytes.Equal(outputs[0], outputs[1]) {
+		t.Fatal("Deterministic outputs differ between runs")
+	}
+	if string(outputs[0][28:32]) != "free" {
+		t.Errorf("Expected fixed 'free' box after ftyp, got %q", outputs[0][28:32])
+	}
+}
+
+func TestMakeTrakAtomReusesUnchangedTables(t *testing.T) {
+	track := syntheticTrack(TrackTypeVideo, 30000, 50, 1001, 100)
+	compactStts := []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 50, 0, 0, 0x03, 0xE9}
+	track.SourceTables = &SampleTables{SampleCount: 50, Stts: compactStts, Stsz: []byte{0, 0, 0, 0, 0, 0, 0, 100, 0, 0, 0, 50}}
+
+	findStts := func(trak *SimpleAtom) []byte {
+		var walk func(a *SimpleAtom) []byte
+		walk = func(a *SimpleAtom) []byte {
+			if a.Type == "stts" {
+				return a.Data
+			}
+			for _, c := range a.Children {
+				if d := walk(c); d != nil {
+					return d
+				}
+			}
+			return nil
+		}
+		return walk(trak)
+	}
+
+	trak := makeTrakAtom(track, 1, map[int]int64{}, false, RemuxOptions{})
+	if !bytes.Equal(findStts(trak), compactStts) {
+		t.Error("Expected unchanged track to reuse the source stts")
+	}
+
+	// A cut drops samples: tables must be rebuilt
+	cut := track
+	cut.Samples = track.Samples[10:20]
+	trak = makeTrakAtom(cut, 1, map[int]int64{}, false, RemuxOptions{})
+	if bytes.Equal(findStts(trak), compactStts) {
+		t.Error("Expected cut track to rebuild stts")
+	}
+}
+
+func TestTimedMetadataTrackSurvivesCutAndRemux(t *testing.T) {
+	video := syntheticTrack(TrackTypeVideo, 30000, 30, 1001, 100)
+	meta := syntheticTrack(TrackTypeMeta, 1000, 10, 100, 24)
+	meta.Stsd = append([]byte{0, 0, 0, 0, 0, 0, 0, 1}, makeBox("mett", make([]byte, 8))...)
+	tracks := []Track{video, meta}
+	src := writeSyntheticSource(t, tracks)
+
+	cut, err := NewMultiTrackCutter(tracks).Cut(200*time.Millisecond, 600*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Cut failed: %v", err)
+	}
+
+	outPath := filepath.Join(t.TempDir(), "meta.mp4")
+	if err := (&Remuxer{InputFile: src}).WriteMultiTrackFile(outPath, cut); err != nil {
+		t.Fatalf("WriteMultiTrackFile failed: %v", err)
+	}
+
+	out, err := os.Open(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	atoms, err := FastProbe(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var moov Atom
+	for _, a := range atoms {
+		if a.Type == "moov" {
+			moov = a
+		}
+	}
+	got, err := NewDemuxer(out).ExtractTracks(moov)
+	if err != nil {
+		t.Fatalf("ExtractTracks on output failed: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 tracks in output, got %d", len(got))
+	}
+	m := got[1]
+	if m.Type != TrackTypeMeta || m.CodecTag != "mett" || m.MediaHeaderType != "nmhd" {
+		t.Errorf("Expected meta/mett track with nmhd, got %s/%s/%s", m.Type, m.CodecTag, m.MediaHeaderType)
+	}
+	if len(m.Samples) != len(cut[1].Samples) {
+		t.Errorf("Expected %d metadata samples, got %d", len(cut[1].Samples), len(m.Samples))
+	}
+}
+
+func TestWriteMultiTrackFilePreserveChunking(t *testing.T) {
+	stsc := func(perChunk uint32) []byte {
+		return []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, byte(perChunk), 0, 0, 0, 1}
+	}
+	withChunks := func(tr Track, perChunk int) Track {
+		for i := range tr.Samples {
+			tr.Samples[i].Chunk = i/perChunk + 1
+		}
+		stts, stsz := new(ExcludeBuffer), new(ExcludeBuffer)
+		stts.WriteUint32(0)
+		stts.WriteUint32(1)
+		stts.WriteUint32(uint32(len(tr.Samples)))
+		stts.WriteUint32(uint32(tr.Samples[0].Duration))
+		stsz.WriteUint32(0)
+		stsz.WriteUint32(0)
+		stsz.WriteUint32(uint32(len(tr.Samples)))
+		for _, s := range tr.Samples {
+			stsz.WriteUint32(uint32(s.Size))
+		}
+		tr.SourceTables = &SampleTables{SampleCount: len(tr.Samples), Stts: stts.Bytes(), Stsz: stsz.Bytes(), Stsc: stsc(uint32(perChunk))}
+		return tr
+	}
+	tracks := []Track{
+		withChunks(syntheticTrack(TrackTypeVideo, 30000, 20, 1001, 300), 5),
+		withChunks(syntheticTrack(TrackTypeAudio, 48000, 30, 1024, 40), 10),
+	}
+	src := writeSyntheticSource(t, tracks)
+
+	outPath := filepath.Join(t.TempDir(), "chunked.mp4")
+	remuxer := &Remuxer{InputFile: src, Options: RemuxOptions{PreserveChunking: true}}
+	if err := remuxer.WriteMultiTrackFile(outPath, tracks); err != nil {
+		t.Fatalf("WriteMultiTrackFile failed: %v", err)
+	}
+
+	out, err := os.Open(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	atoms, err := FastProbe(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewDemuxer(out).ExtractTracks(*FindAtom(atoms, "moov"))
+	if err != nil {
+		t.Fatalf("ExtractTracks on output failed: %v", err)
+	}
+
+	for ti, tr := range got {
+		want := tracks[ti]
+		if len(tr.Samples) != len(want.Samples) {
+			t.Fatalf("track %d: expected %d samples, got %d", ti, len(want.Samples), len(tr.Samples))
+		}
+		if last := tr.Samples[len(tr.Samples)-1].Chunk; last != want.preservedChunks() {
+			t.Errorf("track %d: expected %d chunks, got %d", ti, want.preservedChunks(), last)
+		}
+		for si, s := range tr.Samples {
+			buf, err := ReadSample(out, s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf, samplePattern(ti, si, s.Size)) {
+				t.Fatalf("track %d sample %d: bytes do not match source", ti, si)
+			}
+		}
+	}
+}
+
+func TestWriteMultiTrackFileGroupsChunks(t *testing.T) {
+	// Video samples are 300-302 bytes: three fit in a 1000-byte chunk.
+	// Audio samples last ~21ms: the 500ms cap closes chunks of 24.
+	tracks := []Track{
+		syntheticTrack(TrackTypeVideo, 30000, 30, 1001, 300),
+		syntheticTrack(TrackTypeAudio, 48000, 60, 1024, 10),
+	}
+	src := writeSyntheticSource(t, tracks)
+
+	outPath := filepath.Join(t.TempDir(), "grouped.mp4")
+	remuxer := &Remuxer{InputFile: src, Options: RemuxOptions{ChunkTarget: 1000}}
+	if err := remuxer.WriteMultiTrackFile(outPath, tracks); err != nil {
+		t.Fatalf("WriteMultiTrackFile failed: %v", err)
+	}
+	out, err := os.Open(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	atoms, err := FastProbe(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewDemuxer(out).ExtractTracks(*FindAtom(atoms, "moov"))
+	if err != nil {
+		t.Fatalf("ExtractTracks on output failed: %v", err)
+	}
+
+	for ti, want := range []int{10, 3} {
+		tr := got[ti]
+		if chunks := tr.Samples[len(tr.Samples)-1].Chunk; chunks != want {
+			t.Errorf("track %d: expected %d chunks, got %d", ti, want, chunks)
+		}
+		for si, s := range tr.Samples {
+			buf, err := ReadSample(out, s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf, samplePattern(ti, si, s.Size)) {
+				t.Fatalf("track %d sample %d: bytes do not match source", ti, si)
+			}
+		}
+	}
+	if r := AnalyzeInterleave(got); r.Transitions < 10 {
+		t.Errorf("Expected the tracks to stay interleaved, got %s", r)
+	}
+}
+
+// remuxAndDemux writes tracks (whose samples point into src) to a new file
+// and parses the tracks back from it.
+func remuxAndDemux(t *testing.T, src *os.File, tracks []Track) []Track {
+	t.Helper()
+	outPath := filepath.Join(t.TempDir(), "roundtrip.mp4")
+	if err := (&Remuxer{InputFile: src}).WriteMultiTrackFile(outPath, tracks); err != nil {
+		t.Fatalf("WriteMultiTrackFile failed: %v", err)
+	}
+	out, err := os.Open(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { out.Close() })
+	atoms, err := FastProbe(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moov := FindAtom(atoms, "moov")
+	if moov == nil {
+		t.Fatal("output has no moov")
+	}
+	got, err := NewDemuxer(out).ExtractTracks(*moov)
+	if err != nil {
+		t.Fatalf("ExtractTracks on output failed: %v", err)
+	}
+	return got
+}
+
+func TestRemuxTrackWithUnmappedSamples(t *testing.T) {
+	tracks := []Track{syntheticTrack(TrackTypeVideo, 30000, 10, 1001, 100)}
+	src := writeSyntheticSource(t, tracks)
+	path := filepath.Join(t.TempDir(), "short.mp4")
+	if err := (&Remuxer{InputFile: src}).WriteMultiTrackFile(path, tracks); err != nil {
+		t.Fatalf("WriteMultiTrackFile failed: %v", err)
+	}
+
+	// One sample per chunk; let stco locate only 7 of the 10 that stsz declares
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stco := bytes.Index(data, []byte("stco"))
+	binary.BigEndian.PutUint32(data[stco+8:], 7)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	atoms, err := FastProbe(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDemuxer(f)
+	d.Logger = DiscardLogger
+	short, err := d.ExtractTracks(*FindAtom(atoms, "moov"))
+	if err != nil {
+		t.Fatalf("ExtractTracks failed: %v", err)
+	}
+	if len(short[0].Samples) != 7 {
+		t.Fatalf("Expected 7 mapped samples, got %d", len(short[0].Samples))
+	}
+
+	// The remux must describe the 7 samples it writes, not the source's 10
+	got := remuxAndDemux(t, f, short)
+	stsz := got[0].SourceTables.Stsz
+	if n := binary.BigEndian.Uint32(stsz[8:12]); n != 7 || len(got[0].Samples) != 7 {
+		t.Errorf("Expected 7 samples in stsz and the track, got %d and %d", n, len(got[0].Samples))
+	}
+	if last := got[0].Samples[6]; last.Time != 6*1001 {
+		t.Errorf("Unexpected decode time %d for the last sample", last.Time)
+	}
+}
+
+func TestMakeToolUdta(t *testing.T) {
+	udta := serializeAtom(makeToolUdta("cromedia"))
+	if int(binary.BigEndian.Uint32(udta[0:4])) != len(udta) {
+		t.Fatalf("udta size field %d does not match %d serialized bytes", binary.BigEndian.Uint32(udta[0:4]), len(udta))
+	}
+	meta := findBox(udta[8:], "meta")
+	if meta == nil || !bytes.Equal(meta[:4], []byte{0, 0, 0, 0}) {
+		t.Fatal("Expected meta FullBox with version/flags header")
+	}
+	if hdlr := findBox(meta[4:], "hdlr"); hdlr == nil || string(hdlr[8:12]) != "mdir" {
+		t.Error("Expected meta handler 'mdir'")
+	}
+	ilst := findBox(meta[4:], "ilst")
+	item := findBox(ilst, "\xa9too")
+	data := findBox(item, "data")
+	if data == nil || string(data[8:]) != "cromedia" {
+		t.Errorf("Expected ©too data 'cromedia', got %q", data)
+	}
+}
+
+func TestMakeTrakAtomTrackAndMediaDurations(t *testing.T) {
+	// 48 kHz audio, 100 x 1024 = 102400 units (~2.133s), AAC priming skipped
+	track := syntheticTrack(TrackTypeAudio, 48000, 100, 1024, 10)
+	track.MovieTimescale = 600
+	track.EditList = []EditListEntry{
+		{SegmentDuration: 600, MediaTime: -1, MediaRateInt: 1},    // 1s empty edit
+		{SegmentDuration: 1200, MediaTime: 2112, MediaRateInt: 1}, // 2s of media
+	}
+	trak := makeTrakAtom(track, 1, map[int]int64{}, false, RemuxOptions{})
+
+	var tkhd, mdhd []byte
+	var walk func(a *SimpleAtom)
+	walk = func(a *SimpleAtom) {
+		switch a.Type {
+		case "tkhd":
+			tkhd = a.Data
+		case "mdhd":
+			mdhd = a.Data
+		}
+		for _, c := range a.Children {
+			walk(c)
+		}
+	}
+	walk(trak)
+
+	if got := binary.BigEndian.Uint32(mdhd[16:20]); got != 102400 {
+		t.Errorf("Expected mdhd duration 102400 (media, before edits), got %d", got)
+	}
+	if got := binary.BigEndian.Uint32(tkhd[20:24]); got != 3000 {
+		t.Errorf("Expected tkhd duration 3000ms (sum of edits), got %d", got)
+	}
+
+	// Edits past the end of the media are clamped to what is available
+	track.EditList[1].SegmentDuration = 6000
+	if dur, _ := track.EditedDuration(1000); dur != 1000+convertTime(102400-2112, 48000, 1000) {
+		t.Errorf("Expected edit clamped to the available media, got %d", dur)
+	}
+}
+
+func TestRemuxPromotesLongDurationsToVersion1(t *testing.T) {
+	// ~37h at 90 kHz: 3 x 4e9 units, past the 32-bit range (each stts delta still fits)
+	long := syntheticTrack(TrackTypeVideo, 90000, 3, 4000000000, 100)
+	short := syntheticTrack(TrackTypeAudio, 48000, 10, 1024, 10)
+	tracks := []Track{long, short}
+	src := writeSyntheticSource(t, tracks)
+
+	got := remuxAndDemux(t, src, tracks)
+	if want := uint64(3 * 4000000000); got[0].Duration != want {
+		t.Errorf("Expected 64-bit mdhd duration %d, got %d", want, got[0].Duration)
+	}
+	if got[0].Tkhd[0] != 0 {
+		t.Errorf("Expected tkhd to stay version 0 (fits in ms), got version %d", got[0].Tkhd[0])
+	}
+	if got[1].Duration != 10240 {
+		t.Errorf("Expected short track mdhd duration 10240, got %d", got[1].Duration)
+	}
+	if got[0].Width != long.Width || tkhdTrackID(got[0].Tkhd) != 1 {
+		t.Error("Expected tkhd fields to survive alongside a version 1 mdhd")
+	}
+
+	trak := makeTrakAtom(long, 1, map[int]int64{}, false, RemuxOptions{})
+	for _, c := range trak.Children {
+		if c.Type == "mdia" && c.Children[0].Data[0] != 1 {
+			t.Error("Expected mdhd version 1 for a duration past 32 bits")
+		}
+	}
+}
+
+func TestRemuxLongEditListUsesVersion1(t *testing.T) {
+	// ~37h at 90 kHz in a 90 kHz movie: the media time and the edit (clamped
+	// from 20e9 to the 9e9 units left) both need 64 bits
+	long := syntheticTrack(TrackTypeVideo, 90000, 3, 4000000000, 100)
+	long.MovieTimescale = 90000
+	long.EditList = []EditListEntry{{SegmentDuration: 20000000000, MediaTime: 3000000000, MediaRateInt: 1}}
+	long.MediaTimeOffset = 3000000000
+	tracks := []Track{long}
+	src := writeSyntheticSource(t, tracks)
+
+	outPath := filepath.Join(t.TempDir(), "long.mp4")
+	opts := RemuxOptions{Movie: &Movie{Timescale: 90000}}
+	if err := (&Remuxer{InputFile: src, Options: opts}).WriteMultiTrackFile(outPath, tracks); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.Open(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	atoms, err := FastProbe(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewDemuxer(out).ExtractTracks(*FindAtom(atoms, "moov"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := EditListEntry{SegmentDuration: 9000000000, MediaTime: 3000000000, MediaRateInt: 1}
+	if len(got[0].EditList) != 1 || got[0].EditList[0] != want {
+		t.Errorf("Expected edit %+v, got %+v", want, got[0].EditList)
+	}
+
+	// Short edits stay version 0
+	long.EditList[0] = EditListEntry{SegmentDuration: 90000, MediaTime: 0, MediaRateInt: 1}
+	trak := makeTrakAtom(long, 1, map[int]int64{}, false, opts)
+	for _, c := range trak.Children {
+		if c.Type == "edts" && c.Children[0].Data[0] != 0 {
+			t.Error("Expected elst version 0 for edits that fit in 32 bits")
+		}
+	}
+}
+
+func TestRemuxPreservesSourceFtyp(t *testing.T) {
+	tracks := []Track{syntheticTrack(TrackTypeVideo, 30000, 10, 1001, 100)}
+	src := writeSyntheticSource(t, tracks)
+
+	qt := &FtypInfo{MajorBrand: "qt  ", MinorVersion: 0x20050300, CompatibleBrands: []string{"qt  "}}
+	outPath := filepath.Join(t.TempDir(), "out.mov")
+	if err := (&Remuxer{InputFile: src, Options: RemuxOptions{Ftyp: qt}}).WriteMultiTrackFile(outPath, tracks); err != nil {
+		t.Fatalf("WriteMultiTrackFile failed: %v", err)
+	}
+
+	out, err := os.Open(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	atoms, err := FastProbe(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDemuxer(out)
+	ftyp, err := d.ParseFtyp(atoms[0])
+	if err != nil {
+		t.Fatalf("ParseFtyp failed: %v", err)
+	}
+	if !ftyp.IsQuickTime() || ftyp.MinorVersion != qt.MinorVersion || len(ftyp.CompatibleBrands) != 1 {
+		t.Errorf("Expected source QuickTime brands on output, got %+v", ftyp)
+	}
+	got, err := d.ExtractTracks(*FindAtom(atoms, "moov"))
+	if err != nil || len(got[0].Samples) != 10 {
+		t.Fatalf("Expected output to stay demuxable after a shorter ftyp, got %v", err)
+	}
+	buf, _ := ReadSample(out, got[0].Samples[9])
+	if !bytes.Equal(buf, samplePattern(0, 9, got[0].Samples[9].Size)) {
+		t.Error("Sample offsets do not account for the ftyp size")
+	}
+}
+
+func TestEstimateOverhead(t *testing.T) {
+	tracks := []Track{
+		syntheticTrack(TrackTypeVideo, 30000, 20, 1001, 300),
+		syntheticTrack(TrackTypeAudio, 48000, 30, 1024, 40),
+	}
+	src := writeSyntheticSource(t, tracks)
+
+	opts := RemuxOptions{
+		ChunkTarget:   1000,
+		WriteToolTag:  true,
+		Deterministic: true,
+		Ftyp:          &FtypInfo{MajorBrand: "qt  ", CompatibleBrands: []string{"qt  ", "isom", "mp41"}},
+	}
+	o := EstimateOverhead(tracks, opts)
+	outPath := filepath.Join(t.TempDir(), "out.mp4")
+	if err := (&Remuxer{InputFile: src, Options: opts}).WriteMultiTrackFile(outPath, tracks); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.Open(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	atoms, err := FastProbe(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moov := FindAtom(atoms, "moov"); moov == nil || moov.Size != o.MoovBytes || moov.Offset != o.HeaderBytes {
+		t.Errorf("Expected estimated header and moov sizes to match the written moov (%v), got %d and %d", moov, o.HeaderBytes, o.MoovBytes)
+	}
+	if mdat := FindAtom(atoms, "mdat"); mdat == nil || mdat.Size-8 != o.MdatBytes {
+		t.Errorf("Expected estimated mdat payload to match the written mdat, got %d", o.MdatBytes)
+	}
+	if o.Ratio <= 0 {
+		t.Errorf("Expected a positive overhead ratio, got %f", o.Ratio)
+	}
+}
+
+func TestLayoutMoovChoosesCo64PerTrack(t *testing.T) {
+	// Audio is written first and stays small; video runs past the threshold
+	audio := syntheticTrack(TrackTypeAudio, 48000, 4, 1024, 40)
+	video := syntheticTrack(TrackTypeVideo, 30000, 3, 1001, 0)
+	for i := range video.Samples {
+		video.Samples[i].Size = 1 << 30
+	}
+	tracks := []Track{audio, video}
+	var interleaved []InterleavedSample
+	for ti, tr := range tracks {
+		for si, s := range tr.Samples {
+			interleaved = append(interleaved, InterleavedSample{TrackIndex: ti, SampleIndex: si, Sample: s})
+		}
+	}
+
+	useCo64, moovSize := layoutMoov(tracks, interleaved, 32, RemuxOptions{})
+	if useCo64[0] || !useCo64[1] {
+		t.Fatalf("Expected stco for audio and co64 for video, got %v", useCo64)
+	}
+
+	moov := serializeAtom(makeMoovMultiTrack(tracks, interleaved, 0, useCo64, RemuxOptions{}))
+	if int64(len(moov)) != moovSize {
+		t.Errorf("Expected moov size %d, got %d", moovSize, len(moov))
+	}
+	atoms, err := FastProbeReader(bytes.NewReader(moov), int64(len(moov)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var offsetTables []string
+	for _, trak := range atoms[0].Children {
+		if trak.Type != "trak" {
+			continue
+		}
+		mdia := findChildPath(trak, "mdia")
+		minf := findChildPath(*mdia, "minf")
+		stbl := findChildPath(*minf, "stbl")
+		for _, c := range stbl.Children {
+			if c.Type == "stco" || c.Type == "co64" {
+				offsetTables = append(offsetTables, c.Type)
+			}
+		}
+	}
+	if strings.Join(offsetTables, ",") != "stco,co64" {
+		t.Errorf("Expected stco,co64 offset tables, got %v", offsetTables)
+	}
+}
+
+func TestStrictRemuxReportsDroppedBoxes(t *testing.T) {
+	// SourceBoxes as they would be read back from our own output
+	track := syntheticTrack(TrackTypeVideo, 30000, 20, 1001, 300)
+	trak := serializeAtom(makeTrakAtom(track, 1, map[int]int64{}, false, RemuxOptions{}))
+	atoms, err := FastProbeReader(bytes.NewReader(trak), int64(len(trak)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	track.SourceBoxes = append(atomPaths(atoms[0]), "mdia/minf/stbl/co64", "edts", "edts/elst")
+	tracks := []Track{track}
+	src := writeSyntheticSource(t, tracks)
+	outPath := filepath.Join(t.TempDir(), "out.mp4")
+
+	strict := &Remuxer{InputFile: src, Options: RemuxOptions{Strict: true}}
+	if err := strict.WriteMultiTrackFile(outPath, tracks); err != nil {
+		t.Fatalf("Expected strict remux to accept carried and regenerated boxes, got %v", err)
+	}
+
+	tracks[0].SourceBoxes = append(tracks[0].SourceBoxes, "udta", "mdia/minf/stbl/sgpd")
+	err = strict.WriteMultiTrackFile(outPath, tracks)
+	if err == nil || !strings.Contains(err.Error(), "udta") || !strings.Contains(err.Error(), "mdia/minf/stbl/sgpd") {
+		t.Errorf("Expected strict remux to list the dropped boxes, got %v", err)
+	}
+
+	lenient := &Remuxer{InputFile: src}
+	if err := lenient.WriteMultiTrackFile(outPath, tracks); err != nil {
+		t.Errorf("Expected the default mode to drop unknown boxes silently, got %v", err)
+	}
+}
+
+func TestWriteMultiTrackFileRejectsSamplePastEOF(t *testing.T) {
+	tracks := []Track{syntheticTrack(TrackTypeVideo, 30000, 10, 1001, 300)}
+	src := writeSyntheticSource(t, tracks)
+	info, err := src.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Sample 7 now claims bytes beyond the end of the source
+	tracks[0].Samples[6].Offset = info.Size() - 10
+
+	outPath := filepath.Join(t.TempDir(), "out.mp4")
+	err = (&Remuxer{InputFile: src}).WriteMultiTrackFile(outPath, tracks)
+	if err == nil || !strings.Contains(err.Error(), "sample 7") {
+		t.Fatalf("Expected an error naming sample 7, got %v", err)
+	}
+	if _, statErr := os.Stat(outPath); !os.IsNotExist(statErr) {
+		t.Error("Expected no output file to be created")
+	}
+}
+
+func TestWriteMdatHeaderLargeSize(t *testing.T) {
+	var small bytes.Buffer
+	writeMdatHeader(&AtomWriter{w: &small}, 1000)
+	if got := small.Bytes(); len(got) != 8 || binary.BigEndian.Uint32(got[0:4]) != 1008 || string(got[4:8]) != "mdat" {
+		t.Errorf("Unexpected 32-bit mdat header %x", got)
+	}
+
+	// Only the header is written: the payload size is never materialized
+	const huge = int64(5) << 30
+	var large bytes.Buffer
+	writeMdatHeader(&AtomWriter{w: &large}, huge)
+	got := large.Bytes()
+	if len(got) != 16 || mdatHeaderSize(huge) != 16 {
+		t.Fatalf("Expected a 16-byte large-size header, got %d bytes", len(got))
+	}
+	if binary.BigEndian.Uint32(got[0:4]) != 1 || string(got[4:8]) != "mdat" || binary.BigEndian.Uint64(got[8:16]) != uint64(huge+16) {
+		t.Errorf("Unexpected large-size mdat header %x", got)
+	}
+
+	// The parser reads it back with the payload starting 16 bytes in
+	atoms, err := FastProbeReader(bytes.NewReader(got), int64(len(got)))
+	if err != nil || len(atoms) != 1 || atoms[0].Type != "mdat" {
+		t.Fatalf("Expected the header to parse as mdat, got %v (%v)", atoms, err)
+	}
+
+	// Offsets computed for a huge mdat start after the 16-byte header
+	video := syntheticTrack(TrackTypeVideo, 30000, 2, 1001, 0)
+	video.Samples[0].Size, video.Samples[1].Size = huge/2, huge/2
+	interleaved := buildInterleavedOrder([]Track{video}, RemuxOptions{})
+	useCo64, moovSize := layoutMoov([]Track{video}, interleaved, 32, RemuxOptions{})
+	moov := makeMoovMultiTrackWithOffsets([]Track{video}, interleaved, []int64{32 + moovSize + 16, 32 + moovSize + 16 + huge/2}, useCo64, RemuxOptions{})
+	if int64(len(serializeAtom(moov))) != moovSize || !useCo64[0] {
+		t.Errorf("Expected a stable co64 moov of %d bytes, got %d (co64=%v)", moovSize, len(serializeAtom(moov)), useCo64)
+	}
+}
+
+// seekOnly hides ReadAt and Stat so the io.ReadSeeker fallbacks are exercised
+type seekOnly struct {
+	io.ReadSeeker
+}
+
+func TestRemuxInMemoryReadSeeker(t *testing.T) {
+	tracks := []Track{
+		syntheticTrack(TrackTypeVideo, 30000, 10, 1001, 200),
+		syntheticTrack(TrackTypeAudio, 48000, 15, 1024, 30),
+	}
+	src := writeSyntheticSource(t, tracks)
+	raw, err := os.ReadFile(src.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outPath := filepath.Join(t.TempDir(), "out.mp4")
+	remuxer := &Remuxer{InputFile: seekOnly{bytes.NewReader(raw)}}
+	if err := remuxer.WriteMultiTrackFile(outPath, tracks); err != nil {
+		t.Fatalf("WriteMultiTrackFile from memory failed: %v", err)
+	}
+
+	out, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := seekOnly{bytes.NewReader(out)}
+	atoms, err := FastProbe(in)
+	if err != nil {
+		t.Fatalf("FastProbe from memory failed: %v", err)
+	}
+	moov := FindAtom(atoms, "moov")
+	if moov == nil {
+		t.Fatal("output has no moov")
+	}
+	got, err := NewDemuxer(in).ExtractTracks(*moov)
+	if err != nil {
+		t.Fatalf("ExtractTracks from memory failed: %v", err)
+	}
+	if len(got) != 2 || len(got[0].Samples) != 10 || len(got[1].Samples) != 15 {
+		t.Fatalf("Unexpected tracks from memory: %d", len(got))
+	}
+	s := got[1].Samples[14]
+	if !bytes.Equal(out[s.Offset:s.Offset+s.Size], samplePattern(1, 14, s.Size)) {
+		t.Error("Last audio sample does not round-trip through an in-memory remux")
+	}
+}
+
+func TestCttsRunLengthEncoded(t *testing.T) {
+	video := syntheticTrack(TrackTypeVideo, 30000, 40, 1001, 50)
+	// Long constant-offset run, then an I-P-B pattern
+	video.CTSOffsets = make([]int32, 40)
+	for i := range video.CTSOffsets {
+		video.CTSOffsets[i] = 2002
+	}
+	copy(video.CTSOffsets[30:], []int32{1001, 3003, 0, 1001, 3003, 0})
+
+	payload := cttsPayload(video.CTSOffsets, len(video.Samples))
+	// Runs: 2002 x30, then 1001, 3003, 0, 1001, 3003, 0, then 2002 x4
+	if entries := binary.BigEndian.Uint32(payload[4:8]); entries != 8 {
+		t.Errorf("Expected 8 ctts entries, got %d", entries)
+	}
+	if count := binary.BigEndian.Uint32(payload[8:12]); count != 30 {
+		t.Errorf("Expected the first run to cover 30 samples, got %d", count)
+	}
+
+	src := writeSyntheticSource(t, []Track{video})
+	got := remuxAndDemux(t, src, []Track{video})
+	if len(got[0].CTSOffsets) != 40 {
+		t.Fatalf("Expected 40 CTS offsets after remux, got %d", len(got[0].CTSOffsets))
+	}
+	for i, off := range got[0].CTSOffsets {
+		if off != video.CTSOffsets[i] {
+			t.Fatalf("Sample %d: CTS offset %d, want %d", i, off, video.CTSOffsets[i])
+		}
+	}
+
+	// Offsets shorter than the sample list are padded, not misaligned
+	short := cttsPayload([]int32{500, 500}, 5)
+	if entries := binary.BigEndian.Uint32(short[4:8]); entries != 2 || binary.BigEndian.Uint32(short[16:20]) != 3 {
+		t.Errorf("Expected (2,500)+(3,0), got %x", short[8:])
+	}
+}
+
+func TestSttsRunLengthEncoded(t *testing.T) {
+	// One minute at 30fps: a single (1800, 1001) entry
+	video := syntheticTrack(TrackTypeVideo, 30000, 1800, 1001, 10)
+	payload := sttsPayload(video.Samples)
+	if entries := binary.BigEndian.Uint32(payload[4:8]); entries != 1 || len(payload) != 16 {
+		t.Fatalf("Expected 1 stts entry for a constant-duration track, got %d (%d bytes)", entries, len(payload))
+	}
+	if count, delta := binary.BigEndian.Uint32(payload[8:12]), binary.BigEndian.Uint32(payload[12:16]); count != 1800 || delta != 1001 {
+		t.Errorf("Expected (1800, 1001), got (%d, %d)", count, delta)
+	}
+
+	// A shorter last sample starts a new run
+	audio := syntheticTrack(TrackTypeAudio, 48000, 10, 1024, 10)
+	audio.Samples[9].Duration = 512
+	if entries := binary.BigEndian.Uint32(sttsPayload(audio.Samples)[4:8]); entries != 2 {
+		t.Errorf("Expected 2 stts entries, got %d", entries)
+	}
+
+	src := writeSyntheticSource(t, []Track{audio})
+	got := remuxAndDemux(t, src, []Track{audio})
+	for i, s := range got[0].Samples {
+		if s.Duration != audio.Samples[i].Duration || s.Time != audio.Samples[i].Time {
+			t.Fatalf("Sample %d: time %d duration %d, want %d/%d", i, s.Time, s.Duration, audio.Samples[i].Time, audio.Samples[i].Duration)
+		}
+	}
+}
+
+func TestMdhdLanguageRoundTrip(t *testing.T) {
+	if got := unpackLanguage(0x55c4); got != "und" {
+		t.Errorf("0x55c4: expected und, got %q", got)
+	}
+	if got := packLanguage("eng"); got != 0x15c7 {
+		t.Errorf("eng: expected 0x15c7, got %#x", got)
+	}
+	if got := unpackLanguage(0); got != "" {
+		t.Errorf("Macintosh code 0: expected empty, got %q", got)
+	}
+	if got := packLanguage("EN"); got != 0x55c4 {
+		t.Errorf("Invalid code: expected und, got %#x", got)
+	}
+
+	audio := syntheticTrack(TrackTypeAudio, 48000, 10, 1024, 20)
+	audio.Language = "spa"
+	video := syntheticTrack(TrackTypeVideo, 30000, 5, 1001, 50)
+	tracks := []Track{video, audio}
+	src := writeSyntheticSource(t, tracks)
+
+	got := remuxAndDemux(t, src, tracks)
+	if got[0].Language != "und" || got[1].Language != "spa" {
+		t.Errorf("Expected languages und/spa, got %q/%q", got[0].Language, got[1].Language)
+	}
+}
+
+func TestSortedReadsMatchInterleavedCopy(t *testing.T) {
+	tracks := []Track{
+		syntheticTrack(TrackTypeVideo, 30000, 30, 1001, 400),
+		syntheticTrack(TrackTypeAudio, 48000, 45, 1024, 60),
+	}
+	src := writeSyntheticSource(t, tracks)
+	dir := t.TempDir()
+
+	log := &recordingLogger{}
+	write := func(name string, opts RemuxOptions) []byte {
+		opts.Deterministic = true
+		path := filepath.Join(dir, name)
+		if err := (&Remuxer{InputFile: src, Options: opts, Logger: log}).WriteMultiTrackFile(path, tracks); err != nil {
+			t.Fatalf("%s: WriteMultiTrackFile failed: %v", name, err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	want := write("seek.mp4", RemuxOptions{})
+	if got := write("memory.mp4", RemuxOptions{SortedReads: true}); !bytes.Equal(got, want) {
+		t.Error("Sorted reads staged in memory produced a different file")
+	}
+	// A tiny limit forces the scratch file path
+	if got := write("scratch.mp4", RemuxOptions{SortedReads: true, SortedReadMemory: 1024}); !bytes.Equal(got, want) {
+		t.Error("Sorted reads staged on disk produced a different file")
+	}
+	if !strings.Contains(strings.Join(log.lines, ""), "[Remuxer] Staging") {
+		t.Errorf("Expected the staging message on the remuxer's logger, got %q", log.lines)
+	}
+
+	leftovers, _ := filepath.Glob(filepath.Join(dir, ".cromedia-mdat-*"))
+	if len(leftovers) != 0 {
+		t.Errorf("Scratch files left behind: %v", leftovers)
+	}
+}
+
+// unhashableSource is a ReadSeeker value that cannot be used as a map key
+type unhashableSource struct {
+	*bytes.Reader
+	_ []byte
+}
+
+// unhashableRemuxer reads tracks' samples through an unhashableSource
+func unhashableRemuxer(t *testing.T, tracks []Track, opts RemuxOptions) *Remuxer {
+	t.Helper()
+	src := writeSyntheticSource(t, tracks)
+	data, err := os.ReadFile(src.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Remuxer{Sources: []io.ReadSeeker{unhashableSource{Reader: bytes.NewReader(data)}}, Options: opts}
+}
+
+func TestRemuxUnhashableSource(t *testing.T) {
+	tracks := []Track{syntheticTrack(TrackTypeVideo, 30000, 10, 1001, 100)}
+	r := unhashableRemuxer(t, tracks, RemuxOptions{})
+	if err := r.WriteMultiTrackFile(filepath.Join(t.TempDir(), "out.mp4"), tracks); err != nil {
+		t.Fatalf("WriteMultiTrackFile failed: %v", err)
+	}
+}
+
+func TestSortedReadsUnhashableSource(t *testing.T) {
+	tracks := []Track{syntheticTrack(TrackTypeVideo, 30000, 10, 1001, 100)}
+	r := unhashableRemuxer(t, tracks, RemuxOptions{SortedReads: true})
+	if err := r.WriteMultiTrackFile(filepath.Join(t.TempDir(), "out.mp4"), tracks); err != nil {
+		t.Fatalf("WriteMultiTrackFile failed: %v", err)
+	}
+}
+
+// rotation90Matrix is the tkhd/mvhd matrix of a portrait phone recording
+func rotation90Matrix() []byte {
+	m := identityMatrix()
+	binary.BigEndian.PutUint32(m[0:4], 0)
+	binary.BigEndian.PutUint32(m[4:8], matrixOne)
+	binary.BigEndian.PutUint32(m[12:16], matrixMinusOne)
+	binary.BigEndian.PutUint32(m[16:20], 0)
+	return m
+}
+
+func TestRemuxPreservesMovieHeaderAndMatrix(t *testing.T) {
+	video := syntheticTrack(TrackTypeVideo, 30000, 30, 1001, 80)
+	video.Width, video.Height = 1920<<16, 1080<<16
+	video.Matrix = rotation90Matrix()
+	tracks := []Track{video}
+	src := writeSyntheticSource(t, tracks)
+
+	outPath := filepath.Join(t.TempDir(), "rotated.mp4")
+	opts := RemuxOptions{Movie: &Movie{Timescale: 600, Matrix: rotation90Matrix()}}
+	if err := (&Remuxer{InputFile: src, Options: opts}).WriteMultiTrackFile(outPath, tracks); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := os.Open(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	atoms, err := FastProbe(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDemuxer(out)
+	movie, err := d.ParseMovie(atoms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movie.Timescale != 600 || !bytes.Equal(movie.Matrix, rotation90Matrix()) {
+		t.Errorf("mvhd not preserved: timescale %d, matrix %x", movie.Timescale, movie.Matrix)
+	}
+	// 30 frames at 1001/30000 = 1.001s
+	if movie.Duration != 600 {
+		t.Errorf("Expected mvhd duration 600 in the source timescale, got %d", movie.Duration)
+	}
+
+	got, err := d.ExtractTracks(*FindAtom(atoms, "moov"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0].RotationDegrees() != 90 || !bytes.Equal(got[0].Matrix, rotation90Matrix()) {
+		t.Errorf("tkhd matrix not preserved: rotation %d", got[0].RotationDegrees())
+	}
+	if w, h := got[0].DisplayDimensions(); w != 1080 || h != 1920 {
+		t.Errorf("Expected portrait display 1080x1920, got %dx%d", w, h)
+	}
+
+	// Normalizing bakes the rotation into the tracks: the movie must not
+	// rotate the picture again
+	opts.NormalizeRotation = true
+	normPath := filepath.Join(t.TempDir(), "normalized.mp4")
+	if err := (&Remuxer{InputFile: src, Options: opts}).WriteMultiTrackFile(normPath, tracks); err != nil {
+		t.Fatal(err)
+	}
+	norm, err := os.Open(normPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer norm.Close()
+	atoms, err = FastProbe(norm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	movie, err = NewDemuxer(norm).ParseMovie(atoms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(movie.Matrix, identityMatrix()) || movie.Timescale != 600 {
+		t.Errorf("Expected an identity mvhd matrix in timescale 600 after normalizing, got %x (%d)", movie.Matrix, movie.Timescale)
+	}
+}
+
+func TestIntraOnlyTrackOmitsStss(t *testing.T) {
+	intra := syntheticTrack(TrackTypeVideo, 25, 6, 1, 40)
+	for i := range intra.Samples {
+		intra.Samples[i].IsKeyframe = true
+	}
+	gop := syntheticTrack(TrackTypeVideo, 30000, 10, 1001, 50)
+	tracks := []Track{intra, gop}
+	src := writeSyntheticSource(t, tracks)
+
+	got := remuxAndDemux(t, src, tracks)
+	if got[0].SourceTables.Stss != nil {
+		t.Error("Intra-only track was written with an stss")
+	}
+	if !got[0].AllKeyframes {
+		t.Error("Expected AllKeyframes on the intra-only track")
+	}
+	for _, s := range got[0].Samples {
+		if !s.IsKeyframe {
+			t.Fatalf("Sample %d demuxed as non-keyframe", s.ID)
+		}
+	}
+
+	if got[1].SourceTables.Stss == nil || got[1].AllKeyframes {
+		t.Error("Track with non-sync samples lost its stss")
+	}
+	if !got[1].Samples[5].IsKeyframe || got[1].Samples[6].IsKeyframe {
+		t.Error("Sync samples changed in the GOP track")
+	}
+}
+
+func TestTrackReferencesRemappedThroughCut(t *testing.T) {
+	tref := append(makeBox("chap", []byte{0, 0, 0, 7}), makeBox("sync", []byte{0, 0, 0, 9})...)
+	refs := parseTrackReferences(tref)
+	if len(refs["chap"]) != 1 || refs["chap"][0] != 7 || len(refs["sync"]) != 1 {
+		t.Fatalf("Unexpected parsed references %v", refs)
+	}
+
+	video := syntheticTrack(TrackTypeVideo, 30000, 30, 1001, 100)
+	video.ID = 3
+	video.References = refs // Track 9 is not part of the output
+	chapters := syntheticTrack(TrackTypeMeta, 1000, 10, 100, 24)
+	chapters.ID = 7
+	tracks := []Track{video, chapters}
+	src := writeSyntheticSource(t, tracks)
+
+	cut, err := NewMultiTrackCutter(tracks).Cut(200*time.Millisecond, 600*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Cut failed: %v", err)
+	}
+	got := remuxAndDemux(t, src, cut)
+	if ids := got[0].References["chap"]; len(ids) != 1 || ids[0] != 2 {
+		t.Errorf("Expected chap reference to output track 2, got %v", got[0].References)
+	}
+	if _, ok := got[0].References["sync"]; ok {
+		t.Error("Reference to a missing track was written")
+	}
+	if cut[0].References["chap"][0] != 7 {
+		t.Error("Remuxing modified the input track references")
+	}
+}
+
+func TestRemuxPreservesHeaderTimes(t *testing.T) {
+	captured := time.Date(2021, 6, 1, 12, 30, 0, 0, time.UTC)
+	edited := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	far := time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC) // Past 2040: needs version 1 fields
+
+	video := syntheticTrack(TrackTypeVideo, 30000, 10, 1001, 50)
+	video.CreationTime, video.ModificationTime = far, far
+	audio := syntheticTrack(TrackTypeAudio, 48000, 10, 1024, 20) // No times: uses the movie's
+	tracks := []Track{video, audio}
+	src := writeSyntheticSource(t, tracks)
+
+	write := func(opts RemuxOptions) (*Movie, []Track) {
+		outPath := filepath.Join(t.TempDir(), "times.mp4")
+		if err := (&Remuxer{InputFile: src, Options: opts}).WriteMultiTrackFile(outPath, tracks); err != nil {
+			t.Fatal(err)
+		}
+		out, err := os.Open(outPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { out.Close() })
+		atoms, err := FastProbe(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := NewDemuxer(out)
+		movie, err := d.ParseMovie(atoms)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := d.ExtractTracks(*FindAtom(atoms, "moov"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return movie, got
+	}
+
+	movie, got := write(RemuxOptions{Movie: &Movie{CreationTime: captured, ModificationTime: edited}})
+	if !movie.CreationTime.Equal(captured) || !movie.ModificationTime.Equal(edited) {
+		t.Errorf("mvhd times not preserved: %s / %s", movie.CreationTime, movie.ModificationTime)
+	}
+	if !got[0].CreationTime.Equal(far) || got[0].Tkhd[0] != 1 {
+		t.Errorf("Expected a version 1 tkhd created %s, got v%d %s", far, got[0].Tkhd[0], got[0].CreationTime)
+	}
+	if !got[1].CreationTime.Equal(captured) || !got[1].ModificationTime.Equal(edited) {
+		t.Errorf("Track without times should use the movie's, got %s / %s", got[1].CreationTime, got[1].ModificationTime)
+	}
+
+	movie, got = write(RemuxOptions{CreationTime: edited, Movie: &Movie{CreationTime: captured}})
+	if !movie.CreationTime.Equal(edited) || !got[0].ModificationTime.Equal(edited) {
+		t.Errorf("CreationTime override not applied: mvhd %s, tkhd %s", movie.CreationTime, got[0].ModificationTime)
+	}
+
+	movie, got = write(RemuxOptions{Deterministic: true, CreationTime: edited})
+	if !movie.CreationTime.IsZero() || !got[0].CreationTime.IsZero() {
+		t.Errorf("Deterministic output must have zero times, got %s / %s", movie.CreationTime, got[0].CreationTime)
+	}
+}
@@ -0,0 +1,65 @@
+package core
+
+import "encoding/binary"
+
+// Fixed-point constants used by the tkhd transformation matrix
+const (
+	matrixOne      = 0x00010000 // 1.0 in 16.16
+	matrixMinusOne = 0xFFFF0000 // -1.0 in 16.16 (two's complement)
+)
+
+// RotationDegrees returns the clockwise rotation encoded in the track matrix.
+// Only the pure 0/90/180/270 rotations are recognized; anything else reports 0.
+func (t Track) RotationDegrees() int {
+	if len(t.Matrix) != 36 {
+		return 0
+	}
+	a := binary.BigEndian.Uint32(t.Matrix[0:4])
+	b := binary.BigEndian.Uint32(t.Matrix[4:8])
+	c := binary.BigEndian.Uint32(t.Matrix[12:16])
+	d := binary.BigEndian.Uint32(t.Matrix[16:20])
+
+	switch {
+	case a == 0 && b == matrixOne && c == matrixMinusOne && d == 0:
+		return 90
+	case a == matrixMinusOne && b == 0 && c == 0 && d == matrixMinusOne:
+		return 180
+	case a == 0 && b == matrixMinusOne && c == matrixOne && d == 0:
+		return 270
+	}
+	return 0
+}
+
+// DisplayDimensions returns the width and height (in pixels) as a viewer sees
+// the track, swapping the stored tkhd dimensions for 90/270 rotations.
+func (t Track) DisplayDimensions() (width, height uint32) {
+	width = t.Width >> 16 // tkhd stores 16.16 fixed point
+	height = t.Height >> 16
+	if rot := t.RotationDegrees(); rot == 90 || rot == 270 {
+		return height, width
+	}
+	return width, height
+}
+
+// normalizedGeometry returns the tkhd width/height (16.16) and matrix to write
+// for a track. With normalize set, a 90/270 rotation is baked into swapped
+// dimensions and the matrix is reset to identity for players that ignore it.
+func normalizedGeometry(t Track, normalize bool) (width, height uint32, matrix []byte) {
+	width, height = t.Width, t.Height
+	if len(t.Matrix) == 36 {
+		matrix = t.Matrix
+	} else {
+		matrix = identityMatrix()
+	}
+	if !normalize {
+		return width, height, matrix
+	}
+
+	switch t.RotationDegrees() {
+	case 90, 270:
+		return height, width, identityMatrix()
+	case 180:
+		return width, height, identityMatrix()
+	}
+	return width, height, matrix
+}
@@ -1,26 +1,75 @@
 package core
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"sync"
 )
 
 // GOP (Group of Pictures) represents a slice of samples starting with a Keyframe
 type GOP struct {
-	ID      int
-	Samples []Sample
+	ID          int // Sequential: 0, 1, 2, ... in segmentation order
+	StartSample int // Index of the GOP's first sample in the segmented list
+	Samples     []Sample
+
+	// Source track info (empty when segmenting a bare sample list)
+	CodecTag  string
+	TrackType TrackType
+
+	// EndOfStream is set on the last GOP, which ends with the samples
+	// rather than at the next keyframe
+	EndOfStream bool
+
+	// Skip is the number of leading samples the transcoder only decodes as
+	// references and must not output (a smart cut's frames before the start)
+	Skip int
+}
+
+// GOPStats summarizes a GOP for bitrate analysis, without decoding
+type GOPStats struct {
+	Samples        int
+	Bytes          int64
+	Duration       int64 // Sum of Sample.Duration, in track timescale units
+	StartsOnSync   bool  // First sample is a keyframe (false for a leading orphan run)
+	EndsAtKeyframe bool  // Followed by a keyframe; false at end of stream
+}
+
+// Stats computes the GOP's sample count, byte size and duration
+func (g *GOP) Stats() GOPStats {
+	st := GOPStats{
+		Samples:        len(g.Samples),
+		EndsAtKeyframe: !g.EndOfStream,
+	}
+	for _, s := range g.Samples {
+		st.Bytes += s.Size
+		st.Duration += s.Duration
+	}
+	if len(g.Samples) > 0 {
+		st.StartsOnSync = g.Samples[0].IsKeyframe
+	}
+	return st
 }
 
 // Segmenter splits a list of samples into GOPs
 type Segmenter struct {
-	samples []Sample
-	current int
+	samples   []Sample
+	current   int
+	nextID    int
+	codecTag  string
+	trackType TrackType
 }
 
 func NewSegmenter(samples []Sample) *Segmenter {
 	return &Segmenter{samples: samples}
 }
 
+// NewTrackSegmenter segments a track's samples, tagging each GOP with the
+// track's codec and type so transcoders can reject unsupported input.
+func NewTrackSegmenter(t Track) *Segmenter {
+	return &Segmenter{samples: t.Samples, codecTag: t.CodecTag, trackType: t.Type}
+}
+
 // NextGOP returns the next GOP or nil if done
 func (s *Segmenter) NextGOP() *GOP {
 	if s.current >= len(s.samples) {
@@ -38,13 +87,63 @@ func (s *Segmenter) NextGOP() *GOP {
 	}
 
 	gop := &GOP{
-		ID:      start, // Use start index as ID for now (or sequential 0, 1, 2...)
-		Samples: s.samples[start:end],
+		ID:          s.nextID,
+		StartSample: start,
+		Samples:     s.samples[start:end],
+		CodecTag:    s.codecTag,
+		TrackType:   s.trackType,
+		EndOfStream: end == len(s.samples),
 	}
 	s.current = end
+	s.nextID++
 	return gop
 }
 
+// GOPIssue describes a run of video samples that does not form a decodable
+// GOP, as found by ValidateGOPs
+type GOPIssue struct {
+	StartSample int // 0-based index into Track.Samples
+	Samples     int // Length of the run
+	Message     string
+}
+
+func (i GOPIssue) String() string {
+	return fmt.Sprintf("samples %d-%d: %s", i.StartSample, i.StartSample+i.Samples-1, i.Message)
+}
+
+// ValidateGOPs checks that every GOP of a video track begins with a sync
+// sample. A run of non-sync samples at the start of the track usually means
+// stss is missing the first keyframe (a known muxer bug): a cut starting
+// there would begin on a non-IDR frame. Non-video tracks have no GOPs.
+func (t Track) ValidateGOPs() []GOPIssue {
+	if t.Type != TrackTypeVideo || len(t.Samples) == 0 {
+		return nil
+	}
+
+	first := -1
+	for i, s := range t.Samples {
+		if s.IsKeyframe {
+			first = i
+			break
+		}
+	}
+	switch {
+	case first < 0:
+		return []GOPIssue{{
+			StartSample: 0,
+			Samples:     len(t.Samples),
+			Message:     "no sync samples: the track has no valid cut or seek point",
+		}}
+	case first > 0:
+		return []GOPIssue{{
+			StartSample: 0,
+			Samples:     first,
+			Message:     fmt.Sprintf("orphan non-sync run before the first sync sample (%d); stss may be missing the first keyframe", first),
+		}}
+	}
+	return nil
+}
+
 // Result holds the processed data for a GOP
 type Result struct {
 	GOPID int
@@ -68,19 +167,30 @@ func NewWorkerPool(workers int) *WorkerPool {
 	}
 }
 
-// Start launches the workers
-func (wp *WorkerPool) Start(processor func(*GOP) ([]byte, error)) {
+// Start launches the workers. They stop when Jobs is closed or ctx is
+// cancelled; a worker never blocks on Results past cancellation.
+func (wp *WorkerPool) Start(ctx context.Context, processor func(*GOP) ([]byte, error)) {
 	for i := 0; i < wp.Workers; i++ {
 		wp.wg.Add(1)
 		go func(workerID int) {
 			defer wp.wg.Done()
-			for gop := range wp.Jobs {
-				// Simulate processing
+			for {
+				var gop *GOP
+				select {
+				case <-ctx.Done():
+					return
+				case g, ok := <-wp.Jobs:
+					if !ok {
+						return
+					}
+					gop = g
+				}
+
 				data, err := processor(gop)
-				wp.Results <- Result{
-					GOPID: gop.ID,
-					Data:  data,
-					Err:   err,
+				select {
+				case wp.Results <- Result{GOPID: gop.ID, Data: data, Err: err}:
+				case <-ctx.Done():
+					return
 				}
 			}
 		}(i)
@@ -94,44 +204,139 @@ func (wp *WorkerPool) Wait() {
 	close(wp.Results)
 }
 
-// RunPipelined executes the pipeline: Segmenter -> Workers -> Ordered Consumer
-func RunPipelined(samples []Sample, workers int, processor func(*GOP) ([]byte, error)) error {
+// GOPs in flight (dispatched but not yet written) per worker in RunPipelined.
+// Bounds the results held back while waiting for a slow GOP.
+const maxInFlightPerWorker = 4
+
+// RunPipelined executes the pipeline: Segmenter -> Workers -> Ordered Consumer.
+// Processed GOP bytes are written to out in GOP order; a nil out discards them.
+// At most workers*maxInFlightPerWorker GOPs are in flight, so a slow GOP
+// stalls the producer instead of piling up finished results behind it.
+// Cancelling ctx stops the producer and the workers and returns ctx.Err();
+// every goroutine started here has exited by the time RunPipelined returns.
+func RunPipelined(ctx context.Context, samples []Sample, workers int, out io.Writer, processor func(*GOP) ([]byte, error)) error {
+	if workers < 1 {
+		return fmt.Errorf("pipeline needs at least one worker, got %d", workers)
+	}
+	if out == nil {
+		out = io.Discard
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	segmenter := NewSegmenter(samples)
 	pool := NewWorkerPool(workers)
 
 	// 1. Start Workers
-	pool.Start(processor)
+	pool.Start(ctx, processor)
 
-	// 2. Producer (Segmenter)
+	// 2. Producer (Segmenter). A slot is taken per GOP and released once the
+	// consumer has written it.
+	slots := make(chan struct{}, workers*maxInFlightPerWorker)
+	producerDone := make(chan struct{})
 	go func() {
+		defer close(producerDone)
+		defer close(pool.Jobs)
 		for {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
 			gop := segmenter.NextGOP()
 			if gop == nil {
-				close(pool.Jobs)
-				break
+				return
+			}
+			select {
+			case pool.Jobs <- gop:
+			case <-ctx.Done():
+				return
 			}
-			pool.Jobs <- gop
 		}
 	}()
 
 	// 3. Close Results when Workers finish
 	go pool.Wait()
 
-	// 4. Consumer (Ordered)
-	// We need to re-order results because workers finish out of order.
-	// Since we don't have a sophisticated re-ordering buffer yet,
-	// for this MVP, we just collect results and print/verify.
-	// Real implementation needs a PriorityQueue or Buffer to write sequentially.
+	// stop cancels the pipeline and waits for every goroutine to exit
+	stop := func() {
+		cancel()
+		for range pool.Results {
+		}
+		<-producerDone
+	}
 
-	// For now, let's just count and verify
-	count := 0
+	// 4. Consumer (Ordered)
+	// Workers finish out of order: GOP IDs are sequential, so hold early
+	// results until every GOP before them has been written.
+	pending := make(map[int][]byte)
+	next := 0
 	for res := range pool.Results {
 		if res.Err != nil {
+			stop()
 			return res.Err
 		}
-		// fmt.Printf("Processed GOP %d (Size: %d bytes)\n", res.GOPID, len(res.Data))
-		count++
+		pending[res.GOPID] = res.Data
+		for {
+			data, ok := pending[next]
+			if !ok {
+				break
+			}
+			if _, err := out.Write(data); err != nil {
+				stop()
+				return fmt.Errorf("write GOP %d: %w", next, err)
+			}
+			delete(pending, next)
+			next++
+			<-slots
+		}
 	}
-	fmt.Printf("Pipeline finished. Processed %d GOPs.\n", count)
+	<-producerDone
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("pipeline finished with %d GOPs still waiting for GOP %d", len(pending), next)
+	}
+	fmt.Printf("Pipeline finished. Processed %d GOPs.\n", next)
 	return nil
 }
+
+// TimeWindows splits the track's samples into consecutive windows of roughly
+// windowSec seconds of decode time, for feeding a worker pool by time rather
+// than by GOP. Each window is a half-open sample index range {start, end}.
+// Video windows only break on keyframes, so a window is extended up to the
+// next keyframe (and may be longer than windowSec if GOPs are long).
+// A non-positive windowSec yields a single window.
+func (t Track) TimeWindows(windowSec float64) [][]int {
+	if len(t.Samples) == 0 {
+		return nil
+	}
+	if windowSec <= 0 {
+		return [][]int{{0, len(t.Samples)}}
+	}
+
+	timescale := float64(t.Timescale)
+	if timescale == 0 {
+		timescale = 1000
+	}
+	windowUnits := int64(windowSec * timescale)
+	if windowUnits < 1 {
+		windowUnits = 1
+	}
+
+	var windows [][]int
+	start := 0
+	for i := 1; i < len(t.Samples); i++ {
+		s := t.Samples[i]
+		if s.Time-t.Samples[start].Time < windowUnits {
+			continue
+		}
+		if t.Type == TrackTypeVideo && !s.IsKeyframe {
+			continue
+		}
+		windows = append(windows, []int{start, i})
+		start = i
+	}
+	return append(windows, []int{start, len(t.Samples)})
+}
@@ -0,0 +1,235 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTrackTimeWindows(t *testing.T) {
+	// 30 fps video, keyframe every 5 samples (~167ms GOPs)
+	video := syntheticTrack(TrackTypeVideo, 30000, 60, 1001, 100)
+	windows := video.TimeWindows(0.5)
+
+	next := 0
+	for _, w := range windows {
+		if w[0] != next || w[1] <= w[0] {
+			t.Fatalf("Windows must be contiguous and non-empty, got %v", windows)
+		}
+		if !video.Samples[w[0]].IsKeyframe {
+			t.Errorf("Video window %v does not start on a keyframe", w)
+		}
+		next = w[1]
+	}
+	if next != len(video.Samples) {
+		t.Errorf("Windows cover %d of %d samples", next, len(video.Samples))
+	}
+	// 0.5s = 15 frames, which is GOP aligned: 4 windows of 15 samples
+	if len(windows) != 4 || windows[0][1] != 15 {
+		t.Errorf("Expected 4 windows of 15 samples, got %v", windows)
+	}
+
+	// Audio is split on time alone: 0.1s at 48 kHz = 4.7 frames of 1024
+	audio := syntheticTrack(TrackTypeAudio, 48000, 20, 1024, 10)
+	if w := audio.TimeWindows(0.1); len(w) != 4 || w[0][1] != 5 {
+		t.Errorf("Expected 4 audio windows of 5 samples, got %v", w)
+	}
+
+	if w := audio.TimeWindows(0); len(w) != 1 || w[0][1] != 20 {
+		t.Errorf("Expected a single window for windowSec <= 0, got %v", w)
+	}
+}
+
+func TestValidateGOPs(t *testing.T) {
+	video := syntheticTrack(TrackTypeVideo, 30000, 12, 1001, 100)
+	if issues := video.ValidateGOPs(); len(issues) != 0 {
+		t.Errorf("Expected no issues for a track starting on a keyframe, got %v", issues)
+	}
+
+	// stss missing the first keyframe: samples 0-4 are an orphan run
+	video.Samples[0].IsKeyframe = false
+	issues := video.ValidateGOPs()
+	if len(issues) != 1 || issues[0].StartSample != 0 || issues[0].Samples != 5 {
+		t.Errorf("Expected one orphan run of 5 samples, got %v", issues)
+	}
+
+	for i := range video.Samples {
+		video.Samples[i].IsKeyframe = false
+	}
+	if issues := video.ValidateGOPs(); len(issues) != 1 || issues[0].Samples != 12 {
+		t.Errorf("Expected the whole track reported without sync samples, got %v", issues)
+	}
+
+	audio := syntheticTrack(TrackTypeAudio, 48000, 12, 1024, 10)
+	audio.Samples[0].IsKeyframe = false
+	if issues := audio.ValidateGOPs(); issues != nil {
+		t.Errorf("Expected no GOP issues for audio, got %v", issues)
+	}
+}
+
+func TestRunPipelinedWritesInOrder(t *testing.T) {
+	// 40 GOPs of 5 samples
+	samples := syntheticTrack(TrackTypeVideo, 30000, 200, 1001, 100).Samples
+
+	var want bytes.Buffer
+	for id := 0; id < 40; id++ {
+		fmt.Fprintf(&want, "gop%02d:%d;", id, (id*5)+1)
+	}
+
+	// Early GOPs take longest, so results arrive roughly in reverse
+	processor := func(gop *GOP) ([]byte, error) {
+		time.Sleep(time.Duration((40-gop.ID)%7) * time.Millisecond)
+		return []byte(fmt.Sprintf("gop%02d:%d;", gop.ID, gop.Samples[0].ID)), nil
+	}
+
+	var out bytes.Buffer
+	if err := RunPipelined(context.Background(), samples, 8, &out, processor); err != nil {
+		t.Fatalf("RunPipelined failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), want.Bytes()) {
+		t.Errorf("Output out of order:\n got %s\nwant %s", out.String(), want.String())
+	}
+}
+
+func TestRunPipelinedCancelDoesNotLeak(t *testing.T) {
+	// Long stream: far more GOPs than the job/result buffers hold
+	samples := syntheticTrack(TrackTypeVideo, 30000, 5000, 1001, 100).Samples
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	processed := 0
+	var mu sync.Mutex
+	processor := func(gop *GOP) ([]byte, error) {
+		mu.Lock()
+		processed++
+		if processed == 20 {
+			cancel()
+		}
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		return []byte{byte(gop.ID)}, nil
+	}
+
+	err := RunPipelined(ctx, samples, 4, nil, processor)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	// Goroutines have exited by the time RunPipelined returns; allow the
+	// runtime a moment to reap them
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("Goroutine leak: %d before, %d after cancellation", before, after)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if processed >= 1000 {
+		t.Errorf("Cancellation did not stop the pipeline (%d GOPs processed)", processed)
+	}
+}
+
+func TestRunPipelinedRejectsNoWorkers(t *testing.T) {
+	samples := syntheticTrack(TrackTypeVideo, 30000, 20, 1001, 100).Samples
+	done := make(chan error, 1)
+	go func() {
+		done <- RunPipelined(context.Background(), samples, 0, nil, func(gop *GOP) ([]byte, error) { return nil, nil })
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Expected an error for a pipeline without workers")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("RunPipelined with 0 workers did not return")
+	}
+}
+
+func TestRunPipelinedBoundsInFlightGOPs(t *testing.T) {
+	// GOP 0 stalls: the others may finish, but only up to the in-flight limit
+	samples := syntheticTrack(TrackTypeVideo, 30000, 1000, 1001, 100).Samples
+	const workers = 2
+	release := make(chan struct{})
+	var mu sync.Mutex
+	finished := 0
+	processor := func(gop *GOP) ([]byte, error) {
+		if gop.ID == 0 {
+			<-release
+			return nil, nil
+		}
+		mu.Lock()
+		finished++
+		mu.Unlock()
+		return []byte{byte(gop.ID)}, nil
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- RunPipelined(context.Background(), samples, workers, nil, processor) }()
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	held := finished
+	mu.Unlock()
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("RunPipelined failed: %v", err)
+	}
+	if limit := workers*maxInFlightPerWorker - 1; held > limit {
+		t.Errorf("Expected at most %d GOPs finished behind the stalled one, got %d", limit, held)
+	}
+	if finished != 199 {
+		t.Errorf("Expected all 199 remaining GOPs processed after the stall, got %d", finished)
+	}
+}
+
+func TestSegmenterSequentialIDs(t *testing.T) {
+	// Keyframes every 5 samples
+	samples := syntheticTrack(TrackTypeVideo, 30000, 12, 1001, 100).Samples
+	seg := NewSegmenter(samples)
+
+	wantStarts := []int{0, 5, 10}
+	for id, start := range wantStarts {
+		gop := seg.NextGOP()
+		if gop == nil {
+			t.Fatalf("Expected GOP %d, got nil", id)
+		}
+		if gop.ID != id || gop.StartSample != start || gop.Samples[0].ID != start+1 {
+			t.Errorf("GOP %d: got ID %d, StartSample %d", id, gop.ID, gop.StartSample)
+		}
+	}
+	if gop := seg.NextGOP(); gop != nil {
+		t.Errorf("Expected no more GOPs, got %+v", gop)
+	}
+}
+
+func TestGOPStats(t *testing.T) {
+	// Keyframes every 5 samples, sizes 100/101/102 repeating
+	track := syntheticTrack(TrackTypeVideo, 30000, 12, 1001, 100)
+	seg := NewTrackSegmenter(track)
+
+	var stats []GOPStats
+	for gop := seg.NextGOP(); gop != nil; gop = seg.NextGOP() {
+		stats = append(stats, gop.Stats())
+	}
+	if len(stats) != 3 {
+		t.Fatalf("Expected 3 GOPs, got %d", len(stats))
+	}
+
+	first := stats[0]
+	if first.Samples != 5 || first.Bytes != 100+101+102+100+101 || first.Duration != 5*1001 {
+		t.Errorf("Unexpected first GOP stats: %+v", first)
+	}
+	if !first.StartsOnSync || !first.EndsAtKeyframe {
+		t.Errorf("First GOP should start on sync and end at a keyframe: %+v", first)
+	}
+	last := stats[2]
+	if last.Samples != 2 || last.Duration != 2*1001 || last.EndsAtKeyframe {
+		t.Errorf("Last GOP should be a 2-sample end-of-stream GOP: %+v", last)
+	}
+}
@@ -0,0 +1,258 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SampleTranscoder is implemented by transcoders that return each re-encoded
+// frame separately, so SmartCut can rebuild the sample table from what the
+// encoder produced. Plain Transcoders must return bytes laid out like the
+// output samples (same count and sizes), as DummyTranscoder does.
+type SampleTranscoder interface {
+	TranscodeSamples(gop *GOP) (*EncodedGOP, error)
+}
+
+// EncodedGOP is the output of a SampleTranscoder for one GOP: a frame for
+// every input sample after the first gop.Skip, in decode order
+type EncodedGOP struct {
+	Samples [][]byte
+
+	// Composition offsets of the frames in track timescale units, relative
+	// to the decode times of the samples they replace (nil = PTS == DTS)
+	CTSOffsets []int32
+
+	// Sample entry box (e.g. a complete 'avc1' box with the encoder's avcC)
+	// describing the frames. Nil when they decode with the source entry.
+	SampleEntry []byte
+}
+
+// SmartCut cuts tracks to [start, end] and writes the result to output. Unlike
+// a plain cut, the video is not snapped back to the previous keyframe: the
+// partial GOP from the requested start up to the next keyframe is re-encoded
+// with tc and spliced in front of the stream-copied tail. Audio and other
+// tracks are cut at the requested times as usual.
+//
+// The transcoder gets the whole boundary GOP, from its keyframe on, with
+// GOP.Skip set to the frames before the requested start so they can be decoded
+// as references and then dropped. The re-encoded samples keep the decode times
+// of the samples they replace; their sizes, CTS offsets and sample entry come
+// from the encoder, and the first one is marked as a sync sample.
+//
+// cut and opts are the options of the plain cut and of the remux writing the
+// output (ftyp, movie header, ...); cut.Logger also receives the remuxer's
+// messages. Presentation-time cuts are not supported.
+func SmartCut(input *os.File, tracks []Track, start, end time.Duration, tc Transcoder, output string, cut CutOptions, opts RemuxOptions) ([]CutReport, error) {
+	if tc == nil {
+		return nil, fmt.Errorf("smart cut requires a transcoder")
+	}
+	if cut.ByPresentationTime {
+		return nil, fmt.Errorf("smart cut does not support presentation-time cuts")
+	}
+
+	log := loggerOr(cut.Logger)
+	cutter := NewMultiTrackCutter(tracks)
+	cutter.Source = input
+	cutter.Options = cut
+	cutTracks, reports, err := cutter.CutWithReport(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	// Re-encoded samples go to a scratch file next to the output; the remuxer
+	// reads them as a second source
+	scratch, err := os.CreateTemp(filepath.Dir(output), ".smartcut-*")
+	if err != nil {
+		return nil, fmt.Errorf("create scratch file: %w", err)
+	}
+	defer os.Remove(scratch.Name())
+	defer scratch.Close()
+
+	for ti := range cutTracks {
+		if cutTracks[ti].Type != TrackTypeVideo {
+			continue
+		}
+		spliced, first, err := spliceBoundaryGOP(cutTracks[ti], start, tc, scratch)
+		if err != nil {
+			return nil, fmt.Errorf("track %d: %w", cutTracks[ti].ID, err)
+		}
+		if first < 0 {
+			continue // Start already on a keyframe
+		}
+		cutTracks[ti] = spliced
+
+		timescale := float64(spliced.Timescale)
+		if timescale == 0 {
+			timescale = 1000
+		}
+		r := &reports[ti]
+		r.ActualStart = float64(spliced.Samples[0].Time) / timescale
+		r.DeltaStartMs = (r.ActualStart - r.RequestedStart) * 1000.0
+		r.SamplesIncluded = len(spliced.Samples)
+		r.NetDuration = spliced.PresentationDuration()
+		r.EditOffset = spliced.MediaTimeOffset
+		log.Printf("[SmartCut] Track %s: re-encoded %d leading samples from %.3fs\n", spliced.Type, first, r.ActualStart)
+	}
+
+	remuxer := &Remuxer{InputFile: input, Sources: []io.ReadSeeker{input, scratch}, Options: opts, Logger: cut.Logger}
+	if err := remuxer.WriteMultiTrackFile(output, cutTracks); err != nil {
+		return nil, err
+	}
+	if err := remuxer.Verify(output); err != nil {
+		return nil, fmt.Errorf("output failed verification: %w", err)
+	}
+	return reports, nil
+}
+
+// spliceBoundaryGOP drops the samples before the requested start from a cut
+// video track (which begins on the keyframe before it) and replaces the rest of
+// that GOP with its re-encoded version, appended to scratch. Returns the number
+// of re-encoded samples, or -1 when the track already starts at the requested
+// time and nothing needs re-encoding.
+func spliceBoundaryGOP(track Track, start time.Duration, tc Transcoder, scratch *os.File) (Track, int, error) {
+	timescale := int64(track.Timescale)
+	if timescale == 0 {
+		timescale = 1000
+	}
+	startUnits := int64(start.Seconds() * float64(timescale))
+
+	from := 0
+	for from < len(track.Samples) && track.Samples[from].Time < startUnits {
+		from++
+	}
+	if from == 0 || from == len(track.Samples) || track.Samples[from].IsKeyframe {
+		return track, -1, nil
+	}
+
+	// The GOP from the keyframe before the start: the encoder needs it to
+	// decode the frames it keeps
+	key := from
+	for key > 0 && !track.Samples[key].IsKeyframe {
+		key--
+	}
+	gop := NewTrackSegmenter(sliceTrack(track, key, len(track.Samples)-1, 0)).NextGOP()
+	gop.Skip = from - key
+	kept := len(gop.Samples) - gop.Skip
+
+	encoded, err := transcodeSamples(tc, gop)
+	if err != nil {
+		return track, 0, err
+	}
+
+	description := 0
+	if encoded.SampleEntry != nil {
+		stsd, index, err := appendSampleEntry(track.Stsd, encoded.SampleEntry)
+		if err != nil {
+			return track, 0, err
+		}
+		track.Stsd, description = stsd, index
+	}
+
+	info, err := scratch.Stat()
+	if err != nil {
+		return track, 0, err
+	}
+	offset := info.Size()
+
+	// The cut track's presentation begins at its first sample
+	skipped := unitsToDuration(track.Samples[from].Time-track.Samples[0].Time, timescale)
+	tail := sliceTrack(track, from, len(track.Samples)-1, skipped)
+	samples := make([]Sample, 0, len(tail.Samples))
+	for i, data := range encoded.Samples {
+		if _, err := scratch.WriteAt(data, offset); err != nil {
+			return track, 0, fmt.Errorf("write re-encoded sample: %w", err)
+		}
+		s := tail.Samples[i]
+		s.Offset = offset
+		s.Size = int64(len(data))
+		s.Source = 1
+		s.Chunk = 0
+		s.Description = description
+		s.IsKeyframe = i == 0
+		samples = append(samples, s)
+		offset += s.Size
+	}
+	samples = append(samples, tail.Samples[kept:]...)
+
+	if len(encoded.CTSOffsets) > 0 || len(tail.CTSOffsets) > 0 {
+		cts := make([]int32, 0, len(samples))
+		cts = append(cts, encoded.CTSOffsets...)
+		cts = append(cts, make([]int32, kept-len(encoded.CTSOffsets))...)
+		rest := sliceCTSOffsets(tail.CTSOffsets, kept, len(samples))
+		if rest == nil {
+			rest = make([]int32, len(samples)-kept)
+		}
+		tail.CTSOffsets = append(cts, rest...)
+	}
+	if description > 0 {
+		// The copied tail keeps the source entry explicitly
+		for i := kept; i < len(samples); i++ {
+			if samples[i].Description == 0 {
+				samples[i].Description = 1
+			}
+		}
+	}
+	tail.Samples = samples
+	tail.SourceTables = nil
+	if len(track.EditList) > 0 {
+		tail.EditList, tail.MediaTimeOffset = rebaseEditList(track, tail, skipped, 0)
+	}
+	return tail, kept, nil
+}
+
+// appendSampleEntry adds a sample entry box to an stsd payload and returns
+// the new payload with the entry's 1-based index
+func appendSampleEntry(stsd, entry []byte) ([]byte, int, error) {
+	if len(stsd) < 8 {
+		return nil, 0, fmt.Errorf("%w: stsd payload too short (%d bytes)", ErrMalformedAtom, len(stsd))
+	}
+	if len(entry) < 8 || int(binary.BigEndian.Uint32(entry[0:4])) != len(entry) {
+		return nil, 0, fmt.Errorf("encoder sample entry is not a single box (%d bytes)", len(entry))
+	}
+	count := binary.BigEndian.Uint32(stsd[4:8]) + 1
+	out := make([]byte, 0, len(stsd)+len(entry))
+	out = append(out, stsd...)
+	binary.BigEndian.PutUint32(out[4:8], count)
+	return append(out, entry...), int(count), nil
+}
+
+// transcodeSamples runs tc over gop and returns a frame for every sample after
+// gop.Skip
+func transcodeSamples(tc Transcoder, gop *GOP) (*EncodedGOP, error) {
+	want := gop.Samples[gop.Skip:]
+	if st, ok := tc.(SampleTranscoder); ok {
+		out, err := st.TranscodeSamples(gop)
+		if err != nil {
+			return nil, err
+		}
+		if len(out.Samples) != len(want) {
+			return nil, fmt.Errorf("transcoder returned %d frames for %d samples", len(out.Samples), len(want))
+		}
+		if len(out.CTSOffsets) > len(out.Samples) {
+			return nil, fmt.Errorf("transcoder returned %d CTS offsets for %d frames", len(out.CTSOffsets), len(out.Samples))
+		}
+		return out, nil
+	}
+
+	data, err := tc.Transcode(gop)
+	if err != nil {
+		return nil, err
+	}
+	out := &EncodedGOP{Samples: make([][]byte, 0, len(want))}
+	pos := int64(0)
+	for _, s := range want {
+		if pos+s.Size > int64(len(data)) {
+			return nil, fmt.Errorf("transcoder output (%d bytes) does not match the GOP's sample layout; implement SampleTranscoder", len(data))
+		}
+		out.Samples = append(out.Samples, data[pos:pos+s.Size])
+		pos += s.Size
+	}
+	if pos != int64(len(data)) {
+		return nil, fmt.Errorf("transcoder output (%d bytes) does not match the GOP's sample layout; implement SampleTranscoder", len(data))
+	}
+	return out, nil
+}
@@ -0,0 +1,122 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// shrinkingTranscoder re-encodes every kept sample to a fixed 3-byte payload
+// with its own sample entry and CTS offsets, and records the GOP it was given
+type shrinkingTranscoder struct {
+	gop *GOP
+}
+
+func (st *shrinkingTranscoder) Transcode(gop *GOP) ([]byte, error) {
+	return nil, nil // Unused: TranscodeSamples takes precedence
+}
+
+func (st *shrinkingTranscoder) TranscodeSamples(gop *GOP) (*EncodedGOP, error) {
+	st.gop = gop
+	out := &EncodedGOP{SampleEntry: makeBox("avc1", make([]byte, visualSampleEntrySize-8))}
+	for i := gop.Skip; i < len(gop.Samples); i++ {
+		out.Samples = append(out.Samples, []byte{0xE0, byte(i), 0xE1})
+		out.CTSOffsets = append(out.CTSOffsets, 1001)
+	}
+	return out, nil
+}
+
+func TestSmartCut(t *testing.T) {
+	// Keyframes at samples 0, 5, 10, ...; cutting at sample 7 re-encodes 7-9
+	video := syntheticTrack(TrackTypeVideo, 30000, 30, 1001, 100)
+	video.Stsd = makeAvc1Stsd(nil)
+	audio := syntheticTrack(TrackTypeAudio, 48000, 45, 1024, 20)
+	tracks := []Track{video, audio}
+	src := writeSyntheticSource(t, tracks)
+	start := time.Duration(7*1001) * time.Second / 30000
+	dir := t.TempDir()
+
+	shrinking := &shrinkingTranscoder{}
+	for _, tc := range []struct {
+		name       string
+		transcoder Transcoder
+		firstSize  int64
+	}{
+		{"dummy", &DummyTranscoder{}, 101},
+		{"per-sample", shrinking, 3},
+	} {
+		outPath := filepath.Join(dir, tc.name+".mp4")
+		opts := RemuxOptions{Ftyp: &FtypInfo{MajorBrand: "qt  ", CompatibleBrands: []string{"qt  "}}}
+		reports, err := SmartCut(src, tracks, start, 900*time.Millisecond, tc.transcoder, outPath, CutOptions{Logger: DiscardLogger}, opts)
+		if err != nil {
+			t.Fatalf("%s: SmartCut failed: %v", tc.name, err)
+		}
+		if reports[0].DeltaStartMs < -1 || reports[0].DeltaStartMs > 1 {
+			t.Errorf("%s: expected the video start at the requested time, got Δ %.1fms", tc.name, reports[0].DeltaStartMs)
+		}
+
+		out, err := os.Open(outPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer out.Close()
+		atoms, err := FastProbe(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := NewDemuxer(out).ExtractTracks(*FindAtom(atoms, "moov"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ftyp, err := NewDemuxer(out).ParseFtyp(*FindAtom(atoms, "ftyp")); err != nil || !ftyp.IsQuickTime() {
+			t.Errorf("%s: expected the remux options' ftyp on the output, got %+v (%v)", tc.name, ftyp, err)
+		}
+		v := got[0]
+		if len(v.Samples) != reports[0].SamplesIncluded || !v.Samples[0].IsKeyframe {
+			t.Fatalf("%s: expected %d samples starting on a sync sample, got %d", tc.name, reports[0].SamplesIncluded, len(v.Samples))
+		}
+		if v.Samples[0].Size != tc.firstSize {
+			t.Errorf("%s: expected a re-encoded first sample of %d bytes, got %d", tc.name, tc.firstSize, v.Samples[0].Size)
+		}
+		if v.Samples[1].IsKeyframe || v.Samples[2].IsKeyframe || !v.Samples[3].IsKeyframe {
+			t.Errorf("%s: expected sync samples only at the splice and the copied keyframe", tc.name)
+		}
+
+		// The copied tail is byte-identical to the source keyframe onwards
+		buf := make([]byte, v.Samples[3].Size)
+		out.ReadAt(buf, v.Samples[3].Offset)
+		if !bytes.Equal(buf, samplePattern(0, 10, video.Samples[10].Size)) {
+			t.Errorf("%s: copied keyframe bytes differ from the source", tc.name)
+		}
+
+		if tc.transcoder == shrinking {
+			if v.CTSOffsets[0] != 1001 || v.CTSOffsets[3] != 0 {
+				t.Errorf("Expected the encoder's CTS offsets on the re-encoded frames only, got %v", v.CTSOffsets[:4])
+			}
+			if got := binary.BigEndian.Uint32(v.Stsd[4:8]); got != 2 {
+				t.Errorf("Expected the encoder's sample entry appended to stsd, got %d entries", got)
+			}
+			var descs []int
+			for _, s := range v.Samples[:4] {
+				descs = append(descs, s.Description)
+			}
+			if fmt.Sprint(descs) != "[2 2 2 1]" {
+				t.Errorf("Expected the re-encoded frames on sample entry 2, got %v", descs)
+			}
+		}
+	}
+
+	// The encoder sees the whole GOP from its keyframe, skipping the frames
+	// before the start
+	if g := shrinking.gop; g == nil || !g.Samples[0].IsKeyframe || g.Samples[0].ID != 6 || g.Skip != 2 || len(g.Samples) != 5 {
+		t.Errorf("Expected GOP 5-9 with 2 skipped references, got %+v", g)
+	}
+
+	if entries, _ := filepath.Glob(filepath.Join(dir, ".smartcut-*")); len(entries) != 0 {
+		t.Errorf("Expected scratch files to be removed, found %v", entries)
+	}
+}
@@ -0,0 +1,63 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// The parsers only need to seek and read, so they take an io.ReadSeeker:
+// *os.File, bytes.Reader (in-memory files, tests) and seekable network
+// streams all work.
+
+// streamSize returns the total size of rs. Files are stat'ed; any other
+// seeker is measured by seeking to the end, then back to where it was.
+func streamSize(rs io.ReadSeeker) (int64, error) {
+	if st, ok := rs.(interface{ Stat() (os.FileInfo, error) }); ok {
+		info, err := st.Stat()
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+	pos, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := rs.Seek(pos, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// seekReaderAt implements io.ReaderAt over a seeker that lacks it. Reads
+// move the seeker's position, so it must not be shared across goroutines.
+type seekReaderAt struct {
+	rs io.ReadSeeker
+}
+
+func (s seekReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	if _, err := s.rs.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(s.rs, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// asReaderAt returns rs itself when it supports ReadAt, else a seeking adapter
+func asReaderAt(rs io.ReadSeeker) io.ReaderAt {
+	if ra, ok := rs.(io.ReaderAt); ok {
+		return ra
+	}
+	return seekReaderAt{rs: rs}
+}
@@ -0,0 +1,172 @@
+package core
+
+import "encoding/binary"
+
+// Size of the fixed fields that precede child boxes in a sample entry,
+// counted from the start of the entry (including its 8-byte header).
+const (
+	sampleEntryHeaderSize  = 8 + 8   // size/type + reserved(6) + data_reference_index(2)
+	visualSampleEntrySize  = 16 + 70 // VisualSampleEntry fields
+	audioSampleEntrySizeV0 = 16 + 20 // AudioSampleEntry fields (version 0)
+	audioSampleEntrySizeV1 = 36 + 16 // QuickTime v1: + samples/bytes per packet/frame/sample
+	audioSampleEntrySizeV2 = 36 + 36 // QuickTime v2: + structured LPCM layout
+	stsdEntriesOffset      = 8       // Ver/Flags(4) + EntryCount(4)
+)
+
+// firstSampleEntry returns the first sample entry (header included) of an stsd payload
+func firstSampleEntry(stsd []byte) []byte {
+	if len(stsd) < stsdEntriesOffset+8 {
+		return nil
+	}
+	size := int(binary.BigEndian.Uint32(stsd[stsdEntriesOffset : stsdEntriesOffset+4]))
+	if size < 8 || stsdEntriesOffset+size > len(stsd) {
+		return nil
+	}
+	return stsd[stsdEntriesOffset : stsdEntriesOffset+size]
+}
+
+// sampleEntryDataRefIndex returns the data_reference_index of the first sample entry
+func sampleEntryDataRefIndex(stsd []byte) uint16 {
+	entry := firstSampleEntry(stsd)
+	if len(entry) < sampleEntryHeaderSize {
+		return 0
+	}
+	return binary.BigEndian.Uint16(entry[14:16])
+}
+
+// drefEntry is one entry ('url '/'urn ') of a dref box
+type drefEntry struct {
+	Type          string
+	SelfContained bool // Flag 0x000001: media data is in this file
+}
+
+// parseDrefEntries lists the entries of a dref payload
+func parseDrefEntries(dref []byte) []drefEntry {
+	if len(dref) < 8 {
+		return nil
+	}
+	count := int(binary.BigEndian.Uint32(dref[4:8]))
+	var entries []drefEntry
+	pos := 8
+	for i := 0; i < count && pos+12 <= len(dref); i++ {
+		size := int(binary.BigEndian.Uint32(dref[pos : pos+4]))
+		if size < 12 || pos+size > len(dref) {
+			break
+		}
+		flags := binary.BigEndian.Uint32(dref[pos+8:pos+12]) & 0x00FFFFFF
+		entries = append(entries, drefEntry{
+			Type:          string(dref[pos+4 : pos+8]),
+			SelfContained: flags&1 != 0,
+		})
+		pos += size
+	}
+	return entries
+}
+
+// audioSampleEntryVersion returns the sound description version of an audio
+// sample entry. ISO files always write 0 there (reserved); QuickTime writes
+// 1 or 2 when extra fields follow the v0 layout.
+func audioSampleEntryVersion(entry []byte) uint16 {
+	if len(entry) < sampleEntryHeaderSize+2 {
+		return 0
+	}
+	return binary.BigEndian.Uint16(entry[sampleEntryHeaderSize : sampleEntryHeaderSize+2])
+}
+
+// audioSampleEntryChildrenOffset returns where child boxes (esds, ...) begin
+// inside an audio sample entry, according to its version
+func audioSampleEntryChildrenOffset(entry []byte) int {
+	switch audioSampleEntryVersion(entry) {
+	case 1:
+		return audioSampleEntrySizeV1
+	case 2:
+		return audioSampleEntrySizeV2
+	default:
+		return audioSampleEntrySizeV0
+	}
+}
+
+// sampleEntryChildrenOffset returns where child boxes begin inside a sample
+// entry. For audio this is the v0 size; use audioSampleEntryChildrenOffset
+// when the entry itself is at hand.
+func sampleEntryChildrenOffset(trackType TrackType) int {
+	switch trackType {
+	case TrackTypeVideo:
+		return visualSampleEntrySize
+	case TrackTypeAudio:
+		return audioSampleEntrySizeV0
+	case TrackTypeHint:
+		return hintSampleEntrySize
+	default:
+		return sampleEntryHeaderSize
+	}
+}
+
+// findBox scans a run of sibling boxes and returns the payload (header excluded)
+// of the first box with the given type, or nil.
+func findBox(data []byte, typ string) []byte {
+	pos := 0
+	for pos+8 <= len(data) {
+		size := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		if size < 8 || pos+size > len(data) {
+			return nil
+		}
+		if string(data[pos+4:pos+8]) == typ {
+			return data[pos+8 : pos+size]
+		}
+		pos += size
+	}
+	return nil
+}
+
+// findSampleEntryBox returns the payload of a child box of the first sample
+// entry in an stsd payload (e.g. "avcC", "esds", "sinf").
+func findSampleEntryBox(stsd []byte, trackType TrackType, typ string) []byte {
+	entry := firstSampleEntry(stsd)
+	start := sampleEntryChildrenOffset(trackType)
+	if trackType == TrackTypeAudio {
+		start = audioSampleEntryChildrenOffset(entry)
+	}
+	if entry == nil || len(entry) < start {
+		return nil
+	}
+	return findBox(entry[start:], typ)
+}
+
+// originalFormat resolves the codec behind an encrypted sample entry
+// ('encv'/'enca') from its sinf/frma box. ok is false when the entry is
+// not encrypted or no frma box is present.
+func originalFormat(stsd []byte, trackType TrackType) (format string, ok bool) {
+	sinf := findSampleEntryBox(stsd, trackType, "sinf")
+	if sinf == nil {
+		return "", false
+	}
+	frma := findBox(sinf, "frma")
+	if len(frma) < 4 {
+		return "", false
+	}
+	return string(frma[0:4]), true
+}
+
+// isProtectedTag reports whether a codec tag denotes a protected sample entry
+func isProtectedTag(tag string) bool {
+	return tag == "encv" || tag == "enca"
+}
+
+// codecLabel renders a codec tag for display, marking encrypted tracks
+func codecLabel(tag string, encrypted bool) string {
+	if encrypted {
+		return tag + " (encrypted)"
+	}
+	return tag
+}
+
+// CodecLabel returns the codec tag for display, e.g. "avc1 (encrypted)"
+func (t Track) CodecLabel() string {
+	return codecLabel(t.CodecTag, t.Encrypted)
+}
+
+// CodecLabel returns the codec tag for display, e.g. "avc1 (encrypted)"
+func (i TrackInfo) CodecLabel() string {
+	return codecLabel(i.CodecTag, i.Encrypted)
+}
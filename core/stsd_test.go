@@ -0,0 +1,96 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// makeBox serializes a box with the given type and payload
+func makeBox(typ string, payload []byte) []byte {
+	b := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(b[0:4], uint32(8+len(payload)))
+	copy(b[4:8], typ)
+	return append(b, payload...)
+}
+
+func TestOriginalFormatFromSinf(t *testing.T) {
+	sinf := makeBox("sinf", append(makeBox("frma", []byte("avc1")), makeBox("schm", make([]byte, 12))...))
+	fields := make([]byte, visualSampleEntrySize-8)
+	entry := makeBox("encv", append(fields, sinf...))
+	stsd := append([]byte{0, 0, 0, 0, 0, 0, 0, 1}, entry...)
+
+	format, ok := originalFormat(stsd, TrackTypeVideo)
+	if !ok || format != "avc1" {
+		t.Fatalf("Expected original format avc1, got %q (ok=%v)", format, ok)
+	}
+
+	tr := Track{CodecTag: format, Encrypted: true}
+	if got := tr.CodecLabel(); got != "avc1 (encrypted)" {
+		t.Errorf("Unexpected codec label %q", got)
+	}
+}
+
+// makeAvc1Stsd builds a video stsd payload with one avc1 entry carrying avcC
+func makeAvc1Stsd(avcC []byte) []byte {
+	fields := make([]byte, visualSampleEntrySize-8)
+	if avcC != nil {
+		fields = append(fields, makeBox("avcC", avcC)...)
+	}
+	return append([]byte{0, 0, 0, 0, 0, 0, 0, 1}, makeBox("avc1", fields)...)
+}
+
+func TestParseAvcC(t *testing.T) {
+	sps := []byte{0x67, 0x64, 0x00, 0x1F, 0xAC}
+	pps1 := []byte{0x68, 0xEB, 0xE3}
+	pps2 := []byte{0x68, 0xCE}
+	avcC := []byte{1, 0x64, 0x00, 0x1F, 0xFF, 0xE1, 0, byte(len(sps))}
+	avcC = append(avcC, sps...)
+	avcC = append(avcC, 2, 0, byte(len(pps1)))
+	avcC = append(avcC, pps1...)
+	avcC = append(avcC, 0, byte(len(pps2)))
+	avcC = append(avcC, pps2...)
+
+	d := &Demuxer{}
+	gotSPS, gotPPS, lengthSize, err := d.ParseAvcC(makeAvc1Stsd(avcC))
+	if err != nil {
+		t.Fatalf("ParseAvcC failed: %v", err)
+	}
+	if lengthSize != 4 {
+		t.Errorf("Expected NAL length size 4, got %d", lengthSize)
+	}
+	if len(gotSPS) != 1 || !bytes.Equal(gotSPS[0], sps) {
+		t.Errorf("Unexpected SPS %x", gotSPS)
+	}
+	if len(gotPPS) != 2 || !bytes.Equal(gotPPS[0], pps1) || !bytes.Equal(gotPPS[1], pps2) {
+		t.Errorf("Unexpected PPS %x", gotPPS)
+	}
+
+	if _, _, _, err := d.ParseAvcC(makeAvc1Stsd(nil)); !errors.Is(err, ErrNoAvcC) {
+		t.Errorf("Expected ErrNoAvcC without an avcC box, got %v", err)
+	}
+	if _, _, _, err := d.ParseAvcC(makeAvc1Stsd(avcC[:len(avcC)-1])); err == nil || errors.Is(err, ErrNoAvcC) {
+		t.Errorf("Expected a truncation error, got %v", err)
+	}
+}
+
+func TestParseHvcCArrays(t *testing.T) {
+	// VPS array with one NAL, SPS+PPS array with two
+	hvcC := make([]byte, 22, 64)
+	hvcC[0] = 1
+	hvcC = append(hvcC, 2)
+	hvcC = append(hvcC, 0x20, 0, 1, 0, 2, 0x40, 0x01)
+	hvcC = append(hvcC, 0x21, 0, 2, 0, 1, 0x42, 0, 3, 0x44, 0x01, 0xC0)
+
+	nals, err := parseHvcCArrays(hvcC)
+	if err != nil {
+		t.Fatalf("parseHvcCArrays failed: %v", err)
+	}
+	if len(nals) != 3 || !bytes.Equal(nals[0], []byte{0x40, 0x01}) || !bytes.Equal(nals[2], []byte{0x44, 0x01, 0xC0}) {
+		t.Errorf("Unexpected parameter sets %x", nals)
+	}
+	if _, err := parseHvcCArrays(hvcC[:len(hvcC)-1]); err == nil {
+		t.Error("Expected an error for a truncated array")
+	}
+}
@@ -0,0 +1,143 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// TimelineIssue describes an impossible presentation time found by ValidateTimeline
+type TimelineIssue struct {
+	SampleIndex int   // 0-based index into Track.Samples
+	PTS         int64 // Presentation time in media timescale, after the edit list
+	Message     string
+}
+
+func (i TimelineIssue) String() string {
+	return fmt.Sprintf("sample %d (pts=%d): %s", i.SampleIndex, i.PTS, i.Message)
+}
+
+// PresentationTime returns the presentation time of sample i in media
+// timescale units: decode time plus its CTS offset, shifted by the edit list.
+func (t Track) PresentationTime(i int) int64 {
+	pts := t.Samples[i].Time
+	if i < len(t.CTSOffsets) {
+		pts += int64(t.CTSOffsets[i])
+	}
+	return pts - t.MediaTimeOffset
+}
+
+// ValidateTimeline applies the CTS offsets and then the edit list mapping to
+// every sample and checks that the resulting timeline is possible: composition
+// times are non-negative, edit media times are valid, and no two samples share
+// a presentation time. Samples hidden by the edit list (pre-roll, encoder
+// priming) are legitimate and not reported.
+func (t Track) ValidateTimeline() []TimelineIssue {
+	var issues []TimelineIssue
+
+	for _, e := range t.EditList {
+		if e.MediaTime < -1 {
+			issues = append(issues, TimelineIssue{
+				SampleIndex: -1,
+				PTS:         e.MediaTime,
+				Message:     "edit list media_time below -1 (only -1 may mark an empty edit)",
+			})
+		}
+	}
+
+	order := make([]int, len(t.Samples))
+	for i := range order {
+		order[i] = i
+		if cts := t.PresentationTime(i) + t.MediaTimeOffset; cts < 0 {
+			issues = append(issues, TimelineIssue{
+				SampleIndex: i,
+				PTS:         t.PresentationTime(i),
+				Message:     fmt.Sprintf("negative composition time %d (decode time plus CTS offset)", cts),
+			})
+		}
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		return t.PresentationTime(order[a]) < t.PresentationTime(order[b])
+	})
+	for k := 1; k < len(order); k++ {
+		prev, cur := t.PresentationTime(order[k-1]), t.PresentationTime(order[k])
+		if cur == prev {
+			issues = append(issues, TimelineIssue{
+				SampleIndex: order[k],
+				PTS:         cur,
+				Message:     fmt.Sprintf("same presentation time as sample %d", order[k-1]),
+			})
+		}
+	}
+
+	return issues
+}
+
+// Skew between audio and video start above which lip-sync errors become
+// noticeable (ITU-R BT.1359 puts detectability at roughly +45ms/-125ms).
+const avSyncWarnThreshold = 45 * time.Millisecond
+
+// presentationStart returns the earliest presentation time of the track in
+// seconds (CTS and edit list applied), or false for an empty track.
+func (t Track) presentationStart() (float64, bool) {
+	if len(t.Samples) == 0 {
+		return 0, false
+	}
+	timescale := float64(t.Timescale)
+	if timescale == 0 {
+		timescale = 1000
+	}
+	first := t.PresentationTime(0)
+	for i := 1; i < len(t.Samples); i++ {
+		if pts := t.PresentationTime(i); pts < first {
+			first = pts
+		}
+	}
+	return float64(first) / timescale, true
+}
+
+// AVSyncOffset returns how much later the first presented video sample starts
+// than the first presented audio sample, in the source timeline. After a cut
+// both tracks begin together in the output, so this is the A/V skew the output
+// will have. Negative means audio starts later. ok is false unless tracks
+// contain both a non-empty video and audio track (the first of each is used).
+func AVSyncOffset(tracks []Track) (offset time.Duration, ok bool) {
+	var video, audio *Track
+	for i := range tracks {
+		switch {
+		case tracks[i].Type == TrackTypeVideo && video == nil && len(tracks[i].Samples) > 0:
+			video = &tracks[i]
+		case tracks[i].Type == TrackTypeAudio && audio == nil && len(tracks[i].Samples) > 0:
+			audio = &tracks[i]
+		}
+	}
+	if video == nil || audio == nil {
+		return 0, false
+	}
+	v, _ := video.presentationStart()
+	a, _ := audio.presentationStart()
+	return time.Duration((v - a) * float64(time.Second)), true
+}
+
+// CheckAVSync reports the A/V start offset of cut tracks and warns when it
+// exceeds the lip-sync threshold.
+func CheckAVSync(tracks []Track) (offset time.Duration, ok bool) {
+	offset, ok = AVSyncOffset(tracks)
+	if !ok {
+		return 0, false
+	}
+	if offset > avSyncWarnThreshold || offset < -avSyncWarnThreshold {
+		fmt.Printf("[Sync] ⚠️  %s; output may have lip-sync issues\n", describeAVOffset(offset))
+	}
+	return offset, true
+}
+
+// describeAVOffset words an AVSyncOffset by which track starts first.
+func describeAVOffset(offset time.Duration) string {
+	order := "after"
+	if offset < 0 {
+		order, offset = "before", -offset
+	}
+	return fmt.Sprintf("Video starts %.1fms %s audio", float64(offset)/float64(time.Millisecond), order)
+}
@@ -0,0 +1,178 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestValidateTimeline(t *testing.T) {
+	track := syntheticTrack(TrackTypeVideo, 1000, 4, 100, 10)
+	// I P B B with a 100-unit edit: presented as 0, 300, 100, 200
+	track.CTSOffsets = []int32{100, 300, 0, 0}
+	track.MediaTimeOffset = 100
+	if issues := track.ValidateTimeline(); len(issues) != 0 {
+		t.Errorf("Expected valid timeline, got %v", issues)
+	}
+
+	// Sample 2 collides with sample 1 and sample 3 goes negative (ctts v1)
+	track.CTSOffsets = []int32{0, 100, 0, -400}
+	issues := track.ValidateTimeline()
+	if len(issues) != 2 {
+		t.Fatalf("Expected 2 issues, got %v", issues)
+	}
+}
+
+func TestAVSyncOffset(t *testing.T) {
+	video := syntheticTrack(TrackTypeVideo, 30000, 30, 1001, 100)
+	audio := syntheticTrack(TrackTypeAudio, 48000, 50, 1024, 10)
+
+	// B-frames: first decoded frame is presented 2 frames late, and the edit
+	// list skips that delay again, so video starts at 0
+	video.CTSOffsets = make([]int32, len(video.Samples))
+	for i := range video.CTSOffsets {
+		video.CTSOffsets[i] = 2002
+	}
+	video.MediaTimeOffset = 2002
+
+	// Audio cut starting 100ms later than video
+	audio.Samples = audio.Samples[5:] // 5*1024/48000 = 106.67ms
+
+	offset, ok := AVSyncOffset([]Track{video, audio})
+	if !ok {
+		t.Fatal("Expected an offset for a video+audio pair")
+	}
+	want := -time.Duration(5 * 1024 * int64(time.Second) / 48000)
+	if d := offset - want; d > time.Microsecond || d < -time.Microsecond {
+		t.Errorf("Expected offset %s, got %s", want, offset)
+	}
+
+	if _, ok := AVSyncOffset([]Track{video}); ok {
+		t.Error("Expected ok=false without an audio track")
+	}
+}
+
+func TestDescribeAVOffset(t *testing.T) {
+	if got := describeAVOffset(120 * time.Millisecond); got != "Video starts 120.0ms after audio" {
+		t.Errorf("Positive offset: got %q", got)
+	}
+	if got := describeAVOffset(-106670 * time.Microsecond); got != "Video starts 106.7ms before audio" {
+		t.Errorf("Negative offset: got %q", got)
+	}
+}
+
+func TestPresentationDurationHighTimescale(t *testing.T) {
+	// 20 minutes of 10 MHz media: 1.2e10 units overflow units*1e9 in int64
+	track := Track{Timescale: 10000000}
+	for i := 0; i < 600; i++ {
+		track.Samples = append(track.Samples, Sample{Duration: 20000000})
+	}
+	track.MediaTimeOffset = 5000000
+	if got, want := track.PresentationDuration(), 20*time.Minute-500*time.Millisecond; got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestSeekIndex(t *testing.T) {
+	track := syntheticTrack(TrackTypeVideo, 1000, 20, 100, 10)
+	for i := range track.Samples {
+		track.Samples[i].Offset = 1000 + int64(i)*10
+	}
+	track.CTSOffsets = make([]int32, 20)
+	for i := range track.CTSOffsets {
+		track.CTSOffsets[i] = 200
+	}
+	track.MediaTimeOffset = 200
+
+	index := track.SeekIndex()
+	if len(index) != 4 {
+		t.Fatalf("Expected 4 seek points (one per keyframe), got %d", len(index))
+	}
+	for k, p := range index {
+		wantTime := time.Duration(k*500) * time.Millisecond
+		if p.Time != wantTime || p.Offset != 1000+int64(k*5)*10 {
+			t.Errorf("seek point %d: got %+v, want time %s offset %d", k, p, wantTime, 1000+k*50)
+		}
+	}
+
+	// 10 MHz timescale: a keyframe an hour in must not wrap around
+	long := Track{Timescale: 10000000, Samples: []Sample{{IsKeyframe: true, Time: 36000000000}}}
+	if got := long.SeekIndex(); got[0].Time != time.Hour {
+		t.Errorf("Expected a seek point at 1h, got %s", got[0].Time)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	// Sizes cycle 10, 11, 12; keyframes every 5 samples
+	track := syntheticTrack(TrackTypeVideo, 1000, 12, 250, 10)
+	for i := range track.Samples {
+		track.Samples[i].Offset = 500 + int64(i)*20
+	}
+
+	sum := track.Summarize(3)
+	if sum.Count != 12 || sum.Keyframes != 3 {
+		t.Errorf("Expected 12 samples / 3 keyframes, got %d / %d", sum.Count, sum.Keyframes)
+	}
+	if sum.TotalBytes != 132 || sum.MinSize != 10 || sum.AvgSize != 11 || sum.MaxSize != 12 {
+		t.Errorf("Unexpected sizes: %+v", sum)
+	}
+	if sum.Duration != 3*time.Second {
+		t.Errorf("Expected 3s duration, got %s", sum.Duration)
+	}
+	if len(sum.FirstOffsets) != 3 || sum.FirstOffsets[2] != 540 {
+		t.Errorf("Expected first offsets [500 520 540], got %v", sum.FirstOffsets)
+	}
+
+	if empty := (Track{}).Summarize(3); empty.Count != 0 || empty.MinSize != 0 || empty.FirstOffsets != nil {
+		t.Errorf("Expected a zero summary for an empty track, got %+v", empty)
+	}
+
+	// An hour at 10 MHz must not wrap around
+	long := Track{Timescale: 10000000, Samples: []Sample{{Duration: 36000000000}}}
+	if got := long.Summarize(0).Duration; got != time.Hour {
+		t.Errorf("Expected a 1h duration, got %s", got)
+	}
+}
+
+func TestDurationAndBitrate(t *testing.T) {
+	// 100 samples of 1250 bytes, 40ms each: 4s at 250 kbit/s
+	track := syntheticTrack(TrackTypeVideo, 25000, 100, 1000, 1250)
+	for i := range track.Samples {
+		track.Samples[i].Size = 1250
+	}
+	if got := track.DurationSeconds(); got != 4 {
+		t.Errorf("Expected 4s, got %v", got)
+	}
+	if got := track.AverageBitrate(); got != 250000 {
+		t.Errorf("Expected 250000 bit/s, got %v", got)
+	}
+
+	// Zero timescale falls back to milliseconds
+	track.Timescale = 0
+	if got := track.DurationSeconds(); got != 100 {
+		t.Errorf("Expected 100s with the 1000 fallback, got %v", got)
+	}
+	if got := (Track{}).AverageBitrate(); got != 0 {
+		t.Errorf("Expected 0 for an empty track, got %v", got)
+	}
+}
+
+func TestWriteSampleCSV(t *testing.T) {
+	track := syntheticTrack(TrackTypeVideo, 1000, 3, 40, 10)
+	for i := range track.Samples {
+		track.Samples[i].Offset = 100 + int64(i)*20
+	}
+	track.CTSOffsets = []int32{40, 0} // Shorter than the samples: rest is 0
+
+	var buf bytes.Buffer
+	if err := track.WriteSampleCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "index,offset,size,dts,duration,cts_offset,keyframe\n" +
+		"1,100,10,0,40,40,true\n" +
+		"2,120,11,40,40,0,false\n" +
+		"3,140,12,80,40,0,false\n"
+	if buf.String() != want {
+		t.Errorf("Unexpected CSV:\n%s", buf.String())
+	}
+}
@@ -1,5 +1,14 @@
 package core
 
+import (
+	"encoding/csv"
+	"io"
+	"math/big"
+	"math/bits"
+	"strconv"
+	"time"
+)
+
 // TrackType enum
 type TrackType string
 
@@ -24,13 +33,25 @@ type Track struct {
 	Type      TrackType
 	Timescale uint32
 	Duration  uint64
-	Samples   []Sample
+	Language  string // ISO-639-2/T from mdhd, e.g. "eng" ("" = unknown, written as "und")
+
+	// tkhd creation/modification times (zero when unset in the file)
+	CreationTime     time.Time
+	ModificationTime time.Time
+
+	Samples []Sample
+
+	// AllKeyframes is set when the source trak had no stss: every sample is a
+	// sync sample (intra-only video such as MJPEG/ProRes, or most audio)
+	AllKeyframes bool
 
 	// Metadata Payloads (Raw Bytes excluding header)
-	Stsd        []byte // Sample Description (Codec Config)
-	Hdlr        []byte // Handler Reference
-	MediaHeader []byte // vmhd (Video) or smhd (Audio)
-	Tkhd        []byte // Track Header
+	Stsd            []byte // Sample Description (Codec Config)
+	Hdlr            []byte // Handler Reference
+	MediaHeader     []byte // vmhd (Video), smhd (Audio), nmhd/sthd (Meta) or hmhd (Hint)
+	MediaHeaderType string
+	Tkhd            []byte // Track Header
+	Dref            []byte // Data Reference (dinf/dref), nil = default self-contained
 
 	// Video Specific
 	Width  uint32
@@ -38,20 +59,119 @@ type Track struct {
 	Matrix []byte // 36-byte rotation/transformation matrix from tkhd
 
 	// Audio Specific
-	Volume uint16
+	Volume uint16    // 8.8 fixed point, from tkhd
+	Audio  AudioInfo // From the audio sample entry (zero for other tracks)
+
+	// Decoder configuration: the esds DecoderSpecificInfo of mp4a entries
+	// (AAC AudioSpecificConfig) or the dOps payload of Opus entries
+	AudioConfig []byte
 
 	// B-Frame Support: Composition Time Offsets (ctts)
 	// Per-sample CTS offsets. If empty, PTS == DTS (no B-Frames).
 	CTSOffsets []int32
 
 	// Codec Detection
-	CodecTag string // "avc1", "hev1", "mp4a", etc.
+	CodecTag  string // "avc1", "hev1", "mp4a", etc.
+	Encrypted bool   // Sample entry was 'encv'/'enca'; CodecTag holds the original format
+
+	// Track references from tref, keyed by reference type ('chap', 'hint',
+	// 'sync', ...). Holds source track IDs; the remuxer remaps them.
+	References map[string][]uint32
+
+	// Hint tracks only: RTP hint description
+	Hint *HintInfo
+
+	// data_reference_index of the sample entry (1-based index into Dref)
+	DataReferenceIndex uint16
 
 	// Edit List (edts/elst) — Sync correction
 	// MediaTimeOffset is the initial delay in media timescale units.
 	// Positive = skip N units at start of media. Used for A/V sync.
 	EditList        []EditListEntry
-	MediaTimeOffset int64 // Computed from first edit: the initial presentation offset
+	MediaTimeOffset int64  // Computed from first edit: the initial presentation offset
+	MovieTimescale  uint32 // Timescale of EditList segment durations (source mvhd), 0 = unknown
+
+	// Original sample tables as read from the source (nil for built tracks)
+	SourceTables *SampleTables
+
+	// Paths of the boxes under trak in the source, e.g. "mdia/minf/stbl/sgpd"
+	// (nil for built tracks). Used by strict remuxing to report dropped boxes.
+	SourceBoxes []string
+}
+
+// SampleTables keeps the raw, chunk-independent stbl payloads of a source track
+// so an unchanged sample set can be written back without re-expanding them.
+type SampleTables struct {
+	SampleCount int
+	Stts        []byte
+	Stsz        []byte
+	Stss        []byte // nil when the source had no stss (all keyframes)
+	Ctts        []byte // nil when the source had no ctts
+	Stsc        []byte // Only valid together with the per-sample Sample.Chunk indices
+}
+
+// unchangedTables returns the source tables when the track still holds exactly
+// the samples it was demuxed with, or nil when they must be rebuilt.
+func (t Track) unchangedTables() *SampleTables {
+	st := t.SourceTables
+	n := len(t.Samples)
+	if st == nil || st.Stts == nil || st.Stsz == nil || n == 0 || n != st.SampleCount {
+		return nil
+	}
+	if t.Samples[0].ID != 1 || t.Samples[n-1].ID != n {
+		return nil
+	}
+	return st
+}
+
+// allKeyframes reports whether every sample is a sync sample, in which case
+// no stss is needed to describe them
+func allKeyframes(samples []Sample) bool {
+	for _, s := range samples {
+		if !s.IsKeyframe {
+			return false
+		}
+	}
+	return true
+}
+
+// preservedChunks reports how many source chunks the track can be written
+// with when honoring the original stsc, or 0 if it must use 1:1 chunking.
+func (t Track) preservedChunks() int {
+	st := t.unchangedTables()
+	if st == nil || st.Stsc == nil {
+		return 0
+	}
+	last := 0
+	for _, s := range t.Samples {
+		if s.Chunk < last || s.Chunk > last+1 || s.Chunk == 0 {
+			return 0 // Chunk info missing, out of order or with gaps
+		}
+		last = s.Chunk
+	}
+	return last
+}
+
+// TrackInfo is the lightweight description of a track returned by ListTracks.
+// It is built from the track headers only; no sample tables are mapped.
+type TrackInfo struct {
+	ID        int
+	Type      TrackType
+	CodecTag  string
+	Encrypted bool
+	Timescale uint32
+	Duration  uint64 // In media timescale units
+	Language  string // From mdhd, "" when unknown
+	Width     uint32 // 16.16 fixed point (from tkhd)
+	Height    uint32 // 16.16 fixed point (from tkhd)
+	Matrix    []byte
+
+	// Audio only (from the sample entry)
+	SampleRate uint32
+	Channels   uint16
+
+	// Hint tracks only
+	Hint *HintInfo
 }
 
 // InterleavedSample is used for interleaved mdat writing
@@ -66,10 +186,268 @@ type InterleavedSample struct {
 type CutReport struct {
 	TrackType       TrackType
 	RequestedStart  float64 // Seconds
-	ActualStart     float64 // Seconds (snapped to keyframe)
+	ActualStart     float64 // Presentation seconds (snapped to keyframe)
 	RequestedEnd    float64 // Seconds
-	ActualEnd       float64 // Seconds
+	ActualEnd       float64 // Presentation seconds
 	DeltaStartMs    float64 // Difference in milliseconds
 	DeltaEndMs      float64 // Difference in milliseconds
 	SamplesIncluded int
+
+	KeyframeCorrected bool // Start moved back because the stss keyframe was not IDR/IRAP
+	EndClamped        bool // Requested end was past the media; cut runs to the last sample
+
+	NetDuration time.Duration // Presentation length of the retained samples after edit list offset
+	EditOffset  int64         // MediaTime of the rewritten edit list, in media timescale units (0 = none)
+}
+
+// MediaDuration returns the summed sample durations in media timescale units,
+// i.e. the mdhd duration before any edits are applied.
+func (t Track) MediaDuration() int64 {
+	total := int64(0)
+	for _, s := range t.Samples {
+		total += s.Duration
+	}
+	return total
+}
+
+// DurationSeconds returns the summed sample durations in seconds (no edit
+// list applied)
+func (t Track) DurationSeconds() float64 {
+	timescale := float64(t.Timescale)
+	if timescale == 0 {
+		timescale = 1000
+	}
+	return float64(t.MediaDuration()) / timescale
+}
+
+// AverageBitrate returns the mean bitrate of the track's samples in bits per
+// second, or 0 for a track without duration
+func (t Track) AverageBitrate() float64 {
+	seconds := t.DurationSeconds()
+	if seconds <= 0 {
+		return 0
+	}
+	total := int64(0)
+	for _, s := range t.Samples {
+		total += s.Size
+	}
+	return float64(total) * 8 / seconds
+}
+
+// EditedDuration returns the track's presented duration in movieScale units as
+// described by its edit list (the tkhd duration). Each edit contributes its
+// segment duration, clamped to the media actually available from its
+// MediaTime; empty edits count in full. ok is false without an edit list.
+func (t Track) EditedDuration(movieScale uint32) (dur int64, ok bool) {
+	if len(t.EditList) == 0 {
+		return 0, false
+	}
+	for _, seg := range t.editSegments(movieScale) {
+		dur += seg
+	}
+	return dur, true
+}
+
+// editSegments returns the duration of every edit in movieScale units,
+// clamped to the media available from its MediaTime (0 when none is left);
+// empty edits count in full.
+func (t Track) editSegments(movieScale uint32) []int64 {
+	srcScale := t.MovieTimescale
+	if srcScale == 0 {
+		srcScale = movieScale
+	}
+
+	media := t.MediaDuration()
+	segs := make([]int64, len(t.EditList))
+	for i, e := range t.EditList {
+		seg := convertTime(e.SegmentDuration, srcScale, movieScale)
+		if e.MediaTime != -1 {
+			avail := media - e.MediaTime
+			if avail <= 0 {
+				seg = 0
+			} else if availMovie := convertTime(uint64(avail), t.Timescale, movieScale); availMovie < seg {
+				seg = availMovie
+			}
+		}
+		segs[i] = seg
+	}
+	return segs
+}
+
+// emptyEditDuration sums the leading empty edits of an edit list, in the
+// movie timescale
+func emptyEditDuration(edits []EditListEntry) uint64 {
+	total := uint64(0)
+	for _, e := range edits {
+		if e.MediaTime != -1 {
+			break
+		}
+		total += e.SegmentDuration
+	}
+	return total
+}
+
+// emptyEditDelay returns how long the leading empty edits hold back the
+// track's first presented sample, in its media timescale
+func (t Track) emptyEditDelay() int64 {
+	movieScale := t.MovieTimescale
+	if movieScale == 0 {
+		movieScale = movieTimescale
+	}
+	return convertTime(emptyEditDuration(t.EditList), movieScale, t.Timescale)
+}
+
+// PresentationDuration returns the playable length of the track: the summed
+// sample durations minus the media time skipped by the edit list.
+func (t Track) PresentationDuration() time.Duration {
+	timescale := int64(t.Timescale)
+	if timescale == 0 {
+		timescale = 1000
+	}
+
+	total := int64(0)
+	for _, s := range t.Samples {
+		total += s.Duration
+	}
+	total -= t.MediaTimeOffset
+	if total < 0 {
+		total = 0
+	}
+
+	return unitsToDuration(total, timescale)
+}
+
+// unitsToDuration converts a time in timescale units to a Duration. Whole
+// seconds and the remainder are scaled separately, so high timescales (10 MHz
+// for Smooth Streaming/PIFF) do not overflow int64 nanoseconds.
+func unitsToDuration(units, timescale int64) time.Duration {
+	secs, rem := units/timescale, units%timescale
+	return time.Duration(secs)*time.Second + time.Duration(rem*int64(time.Second)/timescale)
+}
+
+// compareTimes compares a/aScale with b/bScale (scales > 0) by cross
+// multiplying in 128 bits, so times in different high timescales compare
+// exactly without overflowing int64. Returns -1, 0 or +1.
+func compareTimes(a, aScale, b, bScale int64) int {
+	if a < 0 || b < 0 {
+		x := new(big.Int).Mul(big.NewInt(a), big.NewInt(bScale))
+		return x.Cmp(new(big.Int).Mul(big.NewInt(b), big.NewInt(aScale)))
+	}
+	hi1, lo1 := bits.Mul64(uint64(a), uint64(bScale))
+	hi2, lo2 := bits.Mul64(uint64(b), uint64(aScale))
+	switch {
+	case hi1 != hi2:
+		if hi1 < hi2 {
+			return -1
+		}
+		return 1
+	case lo1 != lo2:
+		if lo1 < lo2 {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+// SeekPoint maps a keyframe's presentation time to its byte offset in the file
+type SeekPoint struct {
+	Time   time.Duration
+	Offset int64
+}
+
+// SeekIndex lists the time/offset of every keyframe, in decode order: a seek
+// map (the sidx equivalent) for serving progressive files over HTTP byte
+// ranges. Times include the CTS offset and edit list shift.
+func (t Track) SeekIndex() []SeekPoint {
+	timescale := int64(t.Timescale)
+	if timescale == 0 {
+		timescale = 1000
+	}
+
+	var index []SeekPoint
+	for i, s := range t.Samples {
+		if !s.IsKeyframe {
+			continue
+		}
+		pts := t.PresentationTime(i)
+		index = append(index, SeekPoint{
+			Time:   unitsToDuration(pts, timescale),
+			Offset: s.Offset,
+		})
+	}
+	return index
+}
+
+// SampleSummary is a compact view of a track's mapped sample table
+type SampleSummary struct {
+	Count        int
+	Keyframes    int
+	TotalBytes   int64
+	Duration     time.Duration // Summed sample durations (no edit list applied)
+	MinSize      int64
+	AvgSize      int64
+	MaxSize      int64
+	FirstOffsets []int64 // File offsets of the first few samples
+}
+
+// Summarize computes the SampleSummary of t, listing the offsets of at most
+// firstN samples
+func (t Track) Summarize(firstN int) SampleSummary {
+	sum := SampleSummary{Count: len(t.Samples)}
+	timescale := int64(t.Timescale)
+	if timescale == 0 {
+		timescale = 1000
+	}
+
+	for i, s := range t.Samples {
+		if s.IsKeyframe {
+			sum.Keyframes++
+		}
+		sum.TotalBytes += s.Size
+		if i == 0 || s.Size < sum.MinSize {
+			sum.MinSize = s.Size
+		}
+		if s.Size > sum.MaxSize {
+			sum.MaxSize = s.Size
+		}
+		if i < firstN {
+			sum.FirstOffsets = append(sum.FirstOffsets, s.Offset)
+		}
+	}
+	if sum.Count > 0 {
+		sum.AvgSize = sum.TotalBytes / int64(sum.Count)
+	}
+	sum.Duration = unitsToDuration(t.MediaDuration(), timescale)
+	return sum
+}
+
+// WriteSampleCSV writes one CSV row per sample (index, file offset, size,
+// decode time, duration, CTS offset, keyframe), preceded by a header row.
+// Times are in the track's media timescale.
+func (t Track) WriteSampleCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"index", "offset", "size", "dts", "duration", "cts_offset", "keyframe"}); err != nil {
+		return err
+	}
+	for i, s := range t.Samples {
+		var cts int32
+		if i < len(t.CTSOffsets) {
+			cts = t.CTSOffsets[i]
+		}
+		row := []string{
+			strconv.Itoa(i + 1),
+			strconv.FormatInt(s.Offset, 10),
+			strconv.FormatInt(s.Size, 10),
+			strconv.FormatInt(s.Time, 10),
+			strconv.FormatInt(s.Duration, 10),
+			strconv.FormatInt(int64(cts), 10),
+			strconv.FormatBool(s.IsKeyframe),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
 }
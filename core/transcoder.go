@@ -1,5 +1,26 @@
 package core
 
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// UnsupportedCodecError is returned by a Transcoder that cannot process the
+// codec of a GOP. Callers can detect it with errors.As and fall back to
+// stream-copy for that track.
+type UnsupportedCodecError struct {
+	CodecTag  string
+	TrackType TrackType
+}
+
+func (e *UnsupportedCodecError) Error() string {
+	return fmt.Sprintf("unsupported codec '%s' for %s track", e.CodecTag, e.TrackType)
+}
+
 // Transcoder defines the interface for converting or processing GOPs
 type Transcoder interface {
 	Transcode(gop *GOP) ([]byte, error)
@@ -13,12 +34,105 @@ func (dt *DummyTranscoder) Transcode(gop *GOP) ([]byte, error) {
 	// For "Smart Cut", this might just return the raw bytes if no re-encoding needed.
 	// But usually, Transcoder implies re-encoding.
 
-	// Simulation:
+	// Simulation: one output frame per sample after the skipped references
 	totalSize := 0
-	for _, s := range gop.Samples {
+	for _, s := range gop.Samples[gop.Skip:] {
 		totalSize += int(s.Size)
 	}
 
 	// Just allocate buffer to simulate output
 	return make([]byte, totalSize), nil
 }
+
+// ExecTranscoder pipes each GOP through an external encoder binary: the
+// sample bytes, in decode order, go to its stdin and whatever it writes to
+// stdout is the result. Args may use the placeholders {codec} and {type},
+// replaced with the GOP's codec tag and track type, and {skip}, the number of
+// leading frames (GOP.Skip) the encoder must decode but drop.
+//
+// MP4 samples hold length-prefixed NAL units and no parameter sets. With Stsd
+// set, H.264/HEVC GOPs are sent as an Annex-B stream instead, starting with the
+// avcC/hvcC parameter sets, which raw stream demuxers expect:
+//
+//	ffmpeg -f h264 -i pipe:0 -c:v libx264 -f h264 pipe:1
+type ExecTranscoder struct {
+	Path   string      // Resolved encoder binary
+	Args   []string    // Argument template
+	Source io.ReaderAt // Input holding the GOP samples at Sample.Offset
+	Stsd   []byte      // Sample description of the track, for Annex-B input (nil = raw samples)
+}
+
+// NewExecTranscoder resolves the encoder binary (a name is looked up in PATH)
+// and fails when it is not available
+func NewExecTranscoder(path string, args []string, source io.ReaderAt) (*ExecTranscoder, error) {
+	resolved, err := exec.LookPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("encoder %q not available: %w", path, err)
+	}
+	if source == nil {
+		return nil, fmt.Errorf("exec transcoder needs a source to read samples from")
+	}
+	return &ExecTranscoder{Path: resolved, Args: args, Source: source}, nil
+}
+
+func (et *ExecTranscoder) Transcode(gop *GOP) ([]byte, error) {
+	input, err := et.encoderInput(gop)
+	if err != nil {
+		return nil, err
+	}
+
+	replacer := strings.NewReplacer("{codec}", gop.CodecTag, "{type}", string(gop.TrackType), "{skip}", strconv.Itoa(gop.Skip))
+	args := make([]string, len(et.Args))
+	for i, a := range et.Args {
+		args[i] = replacer.Replace(a)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(et.Path, args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > 200 {
+			msg = "..." + msg[len(msg)-200:]
+		}
+		return nil, fmt.Errorf("encoder failed on GOP %d: %v: %s", gop.ID, err, msg)
+	}
+	return stdout.Bytes(), nil
+}
+
+// encoderInput reads the GOP's samples, converted to Annex-B with the
+// parameter sets in front when Stsd is set and the codec is H.264/HEVC
+func (et *ExecTranscoder) encoderInput(gop *GOP) ([]byte, error) {
+	annexB := et.Stsd != nil && (isAVC(gop.CodecTag) || isHEVCTag(gop.CodecTag))
+	var input []byte
+	lengthSize := 0
+	if annexB {
+		sets, err := parameterSets(et.Stsd, gop.CodecTag)
+		if err != nil {
+			return nil, fmt.Errorf("GOP %d: %w", gop.ID, err)
+		}
+		for _, nal := range sets {
+			input = append(input, annexBStartCode...)
+			input = append(input, nal...)
+		}
+		lengthSize = nalLengthPrefixSize(et.Stsd, gop.CodecTag)
+	}
+
+	for _, s := range gop.Samples {
+		buf := make([]byte, s.Size)
+		if _, err := et.Source.ReadAt(buf, s.Offset); err != nil {
+			return nil, fmt.Errorf("reading sample %d: %w", s.ID, err)
+		}
+		if !annexB {
+			input = append(input, buf...)
+			continue
+		}
+		var err error
+		if input, err = appendAnnexB(input, buf, lengthSize); err != nil {
+			return nil, fmt.Errorf("sample %d: %w", s.ID, err)
+		}
+	}
+	return input, nil
+}
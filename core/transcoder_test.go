@@ -0,0 +1,81 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestExecTranscoder(t *testing.T) {
+	if _, err := NewExecTranscoder("cromedia-no-such-encoder", nil, bytes.NewReader(nil)); err == nil || !strings.Contains(err.Error(), "not available") {
+		t.Errorf("Expected a not-available error, got %v", err)
+	}
+
+	data := []byte("0123456789abcdef")
+	gop := &GOP{
+		Samples:  []Sample{{ID: 1, Offset: 2, Size: 4}, {ID: 2, Offset: 10, Size: 3}},
+		CodecTag: "avc1",
+	}
+
+	// cat echoes stdin: the output is the concatenated GOP samples
+	cat, err := NewExecTranscoder("cat", nil, bytes.NewReader(data))
+	if err != nil {
+		t.Skipf("cat not available: %v", err)
+	}
+	out, err := cat.Transcode(gop)
+	if err != nil {
+		t.Fatalf("Transcode failed: %v", err)
+	}
+	if string(out) != "2345abc" {
+		t.Errorf("Expected the GOP's sample bytes, got %q", out)
+	}
+
+	// Placeholders are substituted; failures carry the encoder's stderr
+	sh, err := NewExecTranscoder("sh", []string{"-c", "echo bad codec {codec} >&2; exit 3"}, bytes.NewReader(data))
+	if err != nil {
+		t.Skipf("sh not available: %v", err)
+	}
+	if _, err := sh.Transcode(gop); err == nil || !strings.Contains(err.Error(), "bad codec avc1") {
+		t.Errorf("Expected the encoder's stderr in the error, got %v", err)
+	}
+}
+
+func TestExecTranscoderAnnexB(t *testing.T) {
+	if _, err := NewExecTranscoder("cromedia-no-such-encoder", nil, bytes.NewReader(nil)); !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("Expected the LookPath error to be wrapped, got %v", err)
+	}
+
+	sps, pps := []byte{0x67, 0x42}, []byte{0x68, 0xCE}
+	avcC := []byte{1, 0x42, 0x00, 0x1E, 0xFF, 0xE1, 0, 2}
+	avcC = append(avcC, sps...)
+	avcC = append(avcC, 1, 0, 2)
+	avcC = append(avcC, pps...)
+
+	// Two 4-byte length-prefixed samples: one NAL, then two
+	data := []byte{0, 0, 0, 2, 0x65, 0xAA, 0, 0, 0, 1, 0x41, 0, 0, 0, 1, 0x06}
+	gop := &GOP{
+		Samples:  []Sample{{ID: 1, Offset: 0, Size: 6}, {ID: 2, Offset: 6, Size: 10}},
+		CodecTag: "avc1",
+	}
+	cat, err := NewExecTranscoder("cat", nil, bytes.NewReader(data))
+	if err != nil {
+		t.Skipf("cat not available: %v", err)
+	}
+	cat.Stsd = makeAvc1Stsd(avcC)
+	out, err := cat.Transcode(gop)
+	if err != nil {
+		t.Fatalf("Transcode failed: %v", err)
+	}
+	want := []byte{0, 0, 0, 1, 0x67, 0x42, 0, 0, 0, 1, 0x68, 0xCE, 0, 0, 0, 1, 0x65, 0xAA, 0, 0, 0, 1, 0x41, 0, 0, 0, 1, 0x06}
+	if !bytes.Equal(out, want) {
+		t.Errorf("Expected an Annex-B stream with parameter sets first\n got % x\nwant % x", out, want)
+	}
+
+	// A length prefix running past the sample is rejected
+	gop.Samples[1].Size = 8
+	if _, err := cat.Transcode(gop); err == nil {
+		t.Error("Expected an error for a truncated NAL unit")
+	}
+}
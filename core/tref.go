@@ -0,0 +1,96 @@
+package core
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+// parseTrackReferences reads every reference type box of a tref payload
+// ('chap', 'hint', 'sync', ...) into a map of referenced track IDs. Nil when
+// the payload holds no complete box.
+func parseTrackReferences(tref []byte) map[string][]uint32 {
+	var refs map[string][]uint32
+	pos := 0
+	for pos+8 <= len(tref) {
+		size := int(binary.BigEndian.Uint32(tref[pos : pos+4]))
+		if size < 8 || pos+size > len(tref) {
+			break
+		}
+		typ := string(tref[pos+4 : pos+8])
+		for p := pos + 8; p+4 <= pos+size; p += 4 {
+			if refs == nil {
+				refs = make(map[string][]uint32)
+			}
+			refs[typ] = append(refs[typ], binary.BigEndian.Uint32(tref[p:p+4]))
+		}
+		pos += size
+	}
+	return refs
+}
+
+// remapTrackReferences returns tracks with their References rewritten to the
+// track IDs the remuxer assigns (position + 1). References to tracks that are
+// not part of the output are dropped, and so are reference types left empty.
+// The input tracks are not modified.
+func remapTrackReferences(tracks []Track) []Track {
+	hasRefs := false
+	outputID := make(map[uint32]uint32, len(tracks))
+	for i, t := range tracks {
+		if _, dup := outputID[uint32(t.ID)]; !dup {
+			outputID[uint32(t.ID)] = uint32(i + 1)
+		}
+		hasRefs = hasRefs || len(t.References) > 0
+	}
+	if !hasRefs {
+		return tracks
+	}
+
+	out := make([]Track, len(tracks))
+	copy(out, tracks)
+	for i := range out {
+		if len(out[i].References) == 0 {
+			continue
+		}
+		var refs map[string][]uint32
+		for typ, ids := range out[i].References {
+			for _, id := range ids {
+				newID, ok := outputID[id]
+				if !ok {
+					continue
+				}
+				if refs == nil {
+					refs = make(map[string][]uint32)
+				}
+				refs[typ] = append(refs[typ], newID)
+			}
+		}
+		out[i].References = refs
+	}
+	return out
+}
+
+// makeTrefAtom builds the tref box for a track's references, with the
+// reference types in sorted order so the output is deterministic. Nil when
+// there are no references.
+func makeTrefAtom(refs map[string][]uint32) *SimpleAtom {
+	types := make([]string, 0, len(refs))
+	for typ, ids := range refs {
+		if len(ids) > 0 {
+			types = append(types, typ)
+		}
+	}
+	if len(types) == 0 {
+		return nil
+	}
+	sort.Strings(types)
+
+	tref := &SimpleAtom{Type: "tref"}
+	for _, typ := range types {
+		data := new(ExcludeBuffer)
+		for _, id := range refs[typ] {
+			data.WriteUint32(id)
+		}
+		tref.Children = append(tref.Children, &SimpleAtom{Type: typ, Data: data.Bytes()})
+	}
+	return tref
+}
@@ -0,0 +1,54 @@
+package core
+
+import (
+	"fmt"
+	"os"
+)
+
+// Verify re-opens a file written by WriteMultiTrackFile and checks that it
+// parses back: a moov is found, the tracks can be extracted, every track has
+// as many samples as was written, and every sample (hence every chunk
+// offset) lies inside an mdat. Without a previous WriteMultiTrackFile on r,
+// only the structural checks run.
+func (r *Remuxer) Verify(outputFile string) error {
+	f, err := os.Open(outputFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	atoms, err := FastProbe(f)
+	if err != nil {
+		return fmt.Errorf("verify: probe failed: %w", err)
+	}
+	var moov *Atom
+	for i := range atoms {
+		if atoms[i].Type == "moov" {
+			moov = &atoms[i]
+			break
+		}
+	}
+	if moov == nil {
+		return fmt.Errorf("verify: %w", ErrNoMoov)
+	}
+	tracks, err := NewDemuxer(f).ExtractTracks(*moov)
+	if err != nil {
+		return fmt.Errorf("verify: failed to extract tracks: %w", err)
+	}
+
+	if r.written != nil && len(tracks) != len(r.written) {
+		return fmt.Errorf("verify: expected %d tracks, found %d", len(r.written), len(tracks))
+	}
+	mdats := MdatRanges(atoms)
+	for i, t := range tracks {
+		if r.written != nil && len(t.Samples) != r.written[i] {
+			return fmt.Errorf("verify: track %d: expected %d samples, found %d", t.ID, r.written[i], len(t.Samples))
+		}
+		for _, s := range t.Samples {
+			if !InMdat(mdats, s) {
+				return fmt.Errorf("verify: track %d: sample %d (%d bytes @ %d) is outside mdat", t.ID, s.ID, s.Size, s.Offset)
+			}
+		}
+	}
+	return nil
+}
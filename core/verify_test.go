@@ -0,0 +1,43 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRemuxerVerify(t *testing.T) {
+	tracks := []Track{
+		syntheticTrack(TrackTypeVideo, 30000, 20, 1001, 100),
+		syntheticTrack(TrackTypeAudio, 48000, 30, 1024, 20),
+	}
+	src := writeSyntheticSource(t, tracks)
+
+	outPath := filepath.Join(t.TempDir(), "verified.mp4")
+	remuxer := &Remuxer{InputFile: src}
+	if err := remuxer.WriteMultiTrackFile(outPath, tracks); err != nil {
+		t.Fatalf("WriteMultiTrackFile failed: %v", err)
+	}
+	if err := remuxer.Verify(outPath); err != nil {
+		t.Fatalf("Verify rejected a valid output: %v", err)
+	}
+
+	remuxer.written[1]++
+	if err := remuxer.Verify(outPath); err == nil || !strings.Contains(err.Error(), "expected 31 samples") {
+		t.Errorf("Expected a sample count mismatch, got %v", err)
+	}
+	remuxer.written[1]--
+
+	// Cut the mdat short: the last samples now point past its end
+	info, err := os.Stat(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(outPath, info.Size()-50); err != nil {
+		t.Fatal(err)
+	}
+	if err := remuxer.Verify(outPath); err == nil || !strings.Contains(err.Error(), "outside mdat") {
+		t.Errorf("Expected a sample outside mdat, got %v", err)
+	}
+}
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"log"
 	"os"
+	"runtime"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"cromedia/core"
@@ -28,13 +33,69 @@ func getAllAtomTypes(atoms []core.Atom) []string {
 	return types
 }
 
+// probeForTracks probes up to the moov, and the whole file when the movie is
+// fragmented (samples then live in moof boxes after the moov)
+func probeForTracks(file *os.File) ([]core.Atom, error) {
+	atoms, err := core.FastProbeMoov(file)
+	if err != nil {
+		return nil, err
+	}
+	if moov := core.FindAtom(atoms, "moov"); moov != nil {
+		for _, c := range moov.Children {
+			if c.Type == "mvex" {
+				return core.FastProbe(file)
+			}
+		}
+	}
+	return atoms, nil
+}
+
+// parseThreads reads the value of a --threads flag
+func parseThreads(v string) (int, error) {
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("--threads needs a positive number, got %q", v)
+	}
+	return n, nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
 func main() {
 	if len(os.Args) < 2 {
 		fmt.Println("CroMedia v0.8 — High-Performance MP4 Smart Cutter")
 		fmt.Println("Usage: cromedia <command> [args]")
 		fmt.Println("Commands:")
-		fmt.Println("  probe  <file.mp4>                              Inspect atom tree")
+		fmt.Println("  probe  <file.mp4> [--json]                     Inspect atom tree")
+		fmt.Println("         [--deep]                                Also map every sample: interleave/layout/GOP checks")
 		fmt.Println("  cut    <input> <start> <end> <output> [--smart] Cut video (keyframe-accurate)")
+		fmt.Println("         [--exec <encoder> [args...]]            Encoder for --smart (must be the last flag)")
+		fmt.Println("         [--normalize-rotation]                  Bake rotation into tkhd dimensions")
+		fmt.Println("         [--safe]                                Verify keyframes are IDR/IRAP")
+		fmt.Println("         [--pts]                                 Frame-accurate cut by presentation time")
+		fmt.Println("         [--tool-tag]                            Tag output with a udta ©too item")
+		fmt.Println("         [--keep-hints]                          Keep RTP hint tracks (invalid after the cut)")
+		fmt.Println("         [--strict]                              Fail instead of dropping unknown boxes")
+		fmt.Println("         [--audio-only | --video-only]           Keep only audio or video tracks")
+		fmt.Println("         [--sorted-reads]                        Read the input sequentially (slow disks)")
+		fmt.Println("         [--group-chunks]                        Write ~512KB chunks instead of one per sample")
+		fmt.Println("  frames <input> <start> <end> <outdir>           Extract raw video frames in range")
+		fmt.Println("  samples <file.mp4> <trackID>                    Summarize a track's sample table")
+		fmt.Println("  dumptrack <file.mp4> <trackID>                  Print a track's sample table as CSV")
+		fmt.Println("  faststart <input> <output>                      Move moov before mdat for streaming")
+		fmt.Println("  strip <input> <output>                          Remove free/skip padding boxes")
+		fmt.Println("  transcode <input> <output> [--threads N]        Process video GOPs in parallel (cut stays serial)")
+		fmt.Println("         [--exec <encoder> [args...]]            Pipe each GOP (Annex-B for H.264/HEVC) through an encoder")
 		fmt.Println("  version                                         Show version")
 		os.Exit(1)
 	}
@@ -44,10 +105,20 @@ func main() {
 	switch command {
 	case "probe":
 		if len(os.Args) < 3 {
-			fmt.Println("Usage: cromedia probe <file.mp4>")
+			fmt.Println("Usage: cromedia probe <file.mp4> [--json] [--deep]")
 			os.Exit(1)
 		}
 		filePath := os.Args[2]
+		jsonOutput := false
+		deep := false
+		for _, arg := range os.Args[3:] {
+			switch arg {
+			case "--json":
+				jsonOutput = true
+			case "--deep":
+				deep = true
+			}
+		}
 		file, err := os.Open(filePath)
 		if err != nil {
 			fmt.Printf("Error opening file: %v\n", err)
@@ -55,11 +126,28 @@ func main() {
 		}
 		defer file.Close()
 
-		atoms, err := core.FastProbe(file)
+		info, err := file.Stat()
+		if err != nil {
+			fmt.Printf("Error reading file size: %v\n", err)
+			os.Exit(1)
+		}
+		atoms, warnings, err := core.ProbeWithWarnings(file, info.Size())
 		if err != nil {
 			fmt.Printf("Error probing file: %v\n", err)
 			os.Exit(1)
 		}
+		if jsonOutput {
+			out, err := core.MarshalProbeJSON(atoms, warnings)
+			if err != nil {
+				fmt.Printf("Error encoding JSON: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println(string(out))
+			return
+		}
+		for _, w := range warnings {
+			fmt.Fprintf(os.Stderr, "[Probe] Warning: %s\n", w)
+		}
 		printTree(atoms, "")
 
 		allTypes := getAllAtomTypes(atoms)
@@ -76,6 +164,119 @@ func main() {
 			}
 		}
 		fmt.Printf("Critical Check: ctts=%v, edts=%v\n", hasCtts, hasEdts)
+		fmt.Printf("Fast Start: %v\n", core.IsFastStart(atoms))
+
+		demuxer := core.NewDemuxer(file)
+		if movie, err := demuxer.ParseMovie(atoms); err == nil {
+			if movie.MajorBrand != "" {
+				fmt.Printf("Brands: major '%s' (minor %d), compatible %q\n", movie.MajorBrand, movie.MinorVersion, movie.CompatibleBrands)
+			}
+			fmt.Printf("Duration: %.3fs", movie.DurationSeconds())
+			if movie.FragmentDuration > 0 {
+				fmt.Print(" (fragmented, from mehd)")
+			} else if movie.IsFragmented() {
+				fmt.Print(" (fragmented)")
+			}
+			fmt.Println()
+			if len(movie.ProducerTimes) > 0 {
+				fmt.Println("\nProducer Reference Times:")
+				for _, p := range movie.ProducerTimes {
+					fmt.Printf("  - @ %d: track %d media time %d captured at %s\n",
+						p.Offset, p.ReferenceTrack, p.MediaTime, p.WallClock().Format(time.RFC3339Nano))
+				}
+			}
+			if len(movie.ProtectionSystems) > 0 {
+				fmt.Println("\nDRM Systems:")
+				for _, ps := range movie.ProtectionSystems {
+					fmt.Printf("  - %s (%s)\n", ps.Name, ps.SystemIDString())
+				}
+			}
+		}
+
+		if moov := core.FindAtom(atoms, "moov"); moov != nil {
+			infos, err := demuxer.ListTracks(*moov)
+			if err == nil {
+				fmt.Println("\nTracks:")
+				for _, info := range infos {
+					fmt.Printf("  - Track %d (%s): Codec '%s', TimeScale %d, Duration %d",
+						info.ID, info.Type, info.CodecLabel(), info.Timescale, info.Duration)
+					if info.Type == core.TrackTypeVideo {
+						fmt.Printf(", %dx%d", info.Width>>16, info.Height>>16)
+					}
+					if info.Type == core.TrackTypeAudio {
+						fmt.Printf(", %d Hz, %d ch", info.SampleRate, info.Channels)
+					}
+					if info.Language != "" && info.Language != "und" {
+						fmt.Printf(", lang %s", info.Language)
+					}
+					if info.Hint != nil {
+						fmt.Printf(", hints track(s) %v", info.Hint.HintedTrackIDs)
+						if info.Hint.Payload != "" {
+							fmt.Printf(" as %s", info.Hint.Payload)
+						}
+					}
+					fmt.Println()
+				}
+			}
+		}
+
+		// Mapping every sample table is slow on huge files: only on request
+		if !deep {
+			fmt.Println("\nRun with --deep for the interleave, layout, GOP and timeline checks.")
+			return
+		}
+		tracks, _ := demuxer.ExtractAllTracks(atoms)
+
+		if len(tracks) > 0 {
+			report := core.AnalyzeInterleave(tracks)
+			fmt.Printf("\nInterleave: %s\n", report)
+			if report.NeedsRemux() {
+				fmt.Println("  Poorly interleaved: players may stutter on seek. Remux to fix the layout.")
+			}
+		}
+
+		for _, t := range tracks {
+			issues := t.ValidateSampleLayout()
+			if len(issues) == 0 {
+				continue
+			}
+			fmt.Printf("\nLayout Check: Track %d (%s): %d overlapping/misplaced sample(s)\n", t.ID, t.Type, len(issues))
+			for k, issue := range issues {
+				if k == 5 {
+					fmt.Printf("      ... and %d more\n", len(issues)-k)
+					break
+				}
+				fmt.Printf("      %s\n", issue)
+			}
+		}
+
+		for _, t := range tracks {
+			for _, issue := range t.ValidateGOPs() {
+				fmt.Printf("\nGOP Check: Track %d (%s): %s\n", t.ID, t.Type, issue)
+			}
+		}
+
+		// B-frames plus edit lists: make sure the presented timeline is sane
+		if hasCtts && hasEdts {
+			if len(tracks) > 0 {
+				fmt.Println("\nTimeline Check:")
+				for _, t := range tracks {
+					issues := t.ValidateTimeline()
+					if len(issues) == 0 {
+						fmt.Printf("  - Track %d (%s): OK\n", t.ID, t.Type)
+						continue
+					}
+					fmt.Printf("  - Track %d (%s): %d problem(s)\n", t.ID, t.Type, len(issues))
+					for k, issue := range issues {
+						if k == 5 {
+							fmt.Printf("      ... and %d more\n", len(issues)-k)
+							break
+						}
+						fmt.Printf("      %s\n", issue)
+					}
+				}
+			}
+		}
 
 	case "cut":
 		if len(os.Args) < 5 {
@@ -88,15 +289,58 @@ func main() {
 		endSec, _ := strconv.ParseFloat(os.Args[4], 64)
 		outputFile := os.Args[5]
 
-		// Check for --smart flag
+		// Check for optional flags
 		smartMode := false
-		for _, arg := range os.Args[6:] {
-			if arg == "--smart" {
+		normalizeRotation := false
+		safeMode := false
+		byPTS := false
+		toolTag := false
+		keepHints := false
+		strict := false
+		sortedReads := false
+		chunkTarget := int64(0)
+		var filter *core.TrackFilter
+		var encoder string
+		var encoderArgs []string
+		flags := os.Args[6:]
+		for i := 0; i < len(flags); i++ {
+			switch flags[i] {
+			case "--smart":
 				smartMode = true
+			case "--normalize-rotation":
+				normalizeRotation = true
+			case "--safe":
+				safeMode = true
+			case "--pts":
+				byPTS = true
+			case "--tool-tag":
+				toolTag = true
+			case "--keep-hints":
+				keepHints = true
+			case "--strict":
+				strict = true
+			case "--sorted-reads":
+				sortedReads = true
+			case "--group-chunks":
+				chunkTarget = core.DefaultChunkTarget
+			case "--audio-only":
+				filter = &core.TrackFilter{IncludeAudio: true}
+			case "--video-only":
+				filter = &core.TrackFilter{IncludeVideo: true}
+			case "--exec":
+				// Everything after the encoder name is passed to it
+				if i+1 >= len(flags) {
+					fmt.Println("Error: --exec needs an encoder")
+					os.Exit(1)
+				}
+				encoder = flags[i+1]
+				encoderArgs = flags[i+2:]
+				i = len(flags)
 			}
 		}
-		if smartMode {
-			fmt.Println("[Main] 🧠 Smart Rendering mode enabled (future: re-encode GOP boundaries)")
+		if smartMode && byPTS {
+			fmt.Println("Error: --smart and --pts cannot be combined")
+			os.Exit(1)
 		}
 
 		file, err := os.Open(inputFile)
@@ -107,23 +351,12 @@ func main() {
 		defer file.Close()
 
 		fmt.Println("[Main] Probing file...")
-		atoms, err := core.FastProbe(file)
+		atoms, err := probeForTracks(file)
 		if err != nil {
 			panic(err)
 		}
 
-		// Helper to find atom
-		var findAtom func(atoms []core.Atom, typ string) *core.Atom
-		findAtom = func(atoms []core.Atom, typ string) *core.Atom {
-			for i := range atoms {
-				if atoms[i].Type == typ {
-					return &atoms[i]
-				}
-			}
-			return nil
-		}
-
-		moov := findAtom(atoms, "moov")
+		moov := core.FindAtom(atoms, "moov")
 		if moov == nil {
 			fmt.Println("Error: 'moov' atom not found")
 			os.Exit(1)
@@ -133,7 +366,7 @@ func main() {
 
 		// 1. Extract All Tracks
 		fmt.Println("[Main] Extracting Tracks...")
-		tracks, err := demuxer.ExtractTracks(*moov)
+		tracks, err := demuxer.ExtractAllTracks(atoms)
 		if err != nil {
 			fmt.Printf("Error extracting tracks: %v\n", err)
 			os.Exit(1)
@@ -143,10 +376,67 @@ func main() {
 			fmt.Printf("  - Track %d (%s): TimeScale %d, Samples %d\n", t.ID, t.Type, t.Timescale, len(t.Samples))
 		}
 
+		// Hint samples address media samples by number and no longer match
+		// them once cut
+		if !keepHints {
+			tracks = core.DropHintTracks(tracks)
+		}
+
+		remuxOpts := core.RemuxOptions{NormalizeRotation: normalizeRotation, WriteToolTag: toolTag, Strict: strict, SortedReads: sortedReads, ChunkTarget: chunkTarget}
+		if ftypAtom := core.FindAtom(atoms, "ftyp"); ftypAtom != nil {
+			// Keep the source brands (e.g. QuickTime 'qt  ') on the output,
+			// minus the fragmented ones: the output is a progressive file
+			if ftyp, err := demuxer.ParseFtyp(*ftypAtom); err == nil {
+				ftyp = ftyp.WithoutFragmentBrands()
+				remuxOpts.Ftyp = &ftyp
+			}
+		}
+		if movie, err := demuxer.ParseMovie(atoms); err == nil {
+			// Keep the source movie timescale and display matrix
+			remuxOpts.Movie = movie
+		}
+
 		// 2. Cut Multi-Track
 		fmt.Printf("[Main] Calculating cut points (%.2f to %.2f sec)...\n", startSec, endSec)
+		start, end := time.Duration(startSec*float64(time.Second)), time.Duration(endSec*float64(time.Second))
+		cutOpts := core.CutOptions{VerifyKeyframes: safeMode, ByPresentationTime: byPTS, Tracks: filter}
+		if smartMode {
+			fmt.Println("[Main] 🧠 Smart Rendering: re-encoding the partial GOP at the start...")
+			var video *core.Track
+			for i := range tracks {
+				if tracks[i].Type == core.TrackTypeVideo {
+					video = &tracks[i]
+					break
+				}
+			}
+			if video == nil {
+				fmt.Println("Error: --smart needs a video track")
+				os.Exit(1)
+			}
+			var tc core.Transcoder = &core.DummyTranscoder{}
+			if encoder != "" {
+				et, err := core.NewExecTranscoder(encoder, encoderArgs, file)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				et.Stsd = video.Stsd
+				tc = et
+			} else {
+				fmt.Println("[Main] ⚠️  No --exec encoder: the boundary frames are copied unchanged (DummyTranscoder)")
+			}
+			if _, err := core.SmartCut(file, tracks, start, end, tc, outputFile, cutOpts, remuxOpts); err != nil {
+				fmt.Printf("Error in smart cut: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Surgery Complete. Created valid Multi-Track MP4: %s\n", outputFile)
+			return
+		}
+
 		cutter := core.NewMultiTrackCutter(tracks)
-		cutTracks, err := cutter.Cut(time.Duration(startSec*float64(time.Second)), time.Duration(endSec*float64(time.Second)))
+		cutter.Source = file
+		cutter.Options = cutOpts
+		cutTracks, err := cutter.Cut(start, end)
 		if err != nil {
 			fmt.Printf("Error cutting: %v\n", err)
 			os.Exit(1)
@@ -155,19 +445,337 @@ func main() {
 		for _, t := range cutTracks {
 			fmt.Printf("  -> Track %s will have %d samples\n", t.Type, len(t.Samples))
 		}
+		if offset, ok := core.CheckAVSync(cutTracks); ok {
+			fmt.Printf("[Main] A/V start offset: %.1fms\n", float64(offset)/float64(time.Millisecond))
+		}
+
+		fmt.Printf("[Main] Container overhead: %s\n", core.EstimateOverhead(cutTracks, remuxOpts))
 
 		// 3. Perform the Surgery (Remux)
 		fmt.Println("[Main] Initializing Multi-Track Remuxer...")
-		remuxer := &core.Remuxer{InputFile: file}
-
+		remuxer := &core.Remuxer{InputFile: file, Options: remuxOpts}
 		err = remuxer.WriteMultiTrackFile(outputFile, cutTracks)
 		if err != nil {
 			fmt.Printf("Error remuxing: %v\n", err)
 			os.Exit(1)
 		}
+		if err := remuxer.Verify(outputFile); err != nil {
+			fmt.Printf("Error: output failed verification: %v\n", err)
+			os.Exit(1)
+		}
 
 		fmt.Printf("Surgery Complete. Created valid Multi-Track MP4: %s\n", outputFile)
 
+	case "frames":
+		if len(os.Args) < 6 {
+			fmt.Println("Usage: cromedia frames <input.mp4> <start_sec> <end_sec> <outdir>")
+			os.Exit(1)
+		}
+
+		inputFile := os.Args[2]
+		startSec, _ := strconv.ParseFloat(os.Args[3], 64)
+		endSec, _ := strconv.ParseFloat(os.Args[4], 64)
+		outDir := os.Args[5]
+
+		file, err := os.Open(inputFile)
+		if err != nil {
+			fmt.Printf("Error opening file: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+
+		atoms, err := probeForTracks(file)
+		if err != nil {
+			fmt.Printf("Error probing file: %v\n", err)
+			os.Exit(1)
+		}
+		moov := core.FindAtom(atoms, "moov")
+		if moov == nil {
+			fmt.Println("Error: 'moov' atom not found")
+			os.Exit(1)
+		}
+		tracks, err := core.NewDemuxer(file).ExtractAllTracks(atoms)
+		if err != nil {
+			fmt.Printf("Error extracting tracks: %v\n", err)
+			os.Exit(1)
+		}
+
+		var video *core.Track
+		for i := range tracks {
+			if tracks[i].Type == core.TrackTypeVideo {
+				video = &tracks[i]
+				break
+			}
+		}
+		if video == nil {
+			fmt.Println("Error: no video track found")
+			os.Exit(1)
+		}
+
+		n, err := core.ExtractFrameRange(file, *video,
+			time.Duration(startSec*float64(time.Second)), time.Duration(endSec*float64(time.Second)), outDir)
+		if err != nil {
+			fmt.Printf("Error extracting frames: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Extracted %d frames to %s\n", n, outDir)
+
+	case "samples":
+		if len(os.Args) < 4 {
+			fmt.Println("Usage: cromedia samples <file.mp4> <trackID>")
+			os.Exit(1)
+		}
+
+		trackID, err := strconv.Atoi(os.Args[3])
+		if err != nil {
+			fmt.Printf("Invalid track ID %q\n", os.Args[3])
+			os.Exit(1)
+		}
+
+		file, err := os.Open(os.Args[2])
+		if err != nil {
+			fmt.Printf("Error opening file: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+
+		atoms, err := probeForTracks(file)
+		if err != nil {
+			fmt.Printf("Error probing file: %v\n", err)
+			os.Exit(1)
+		}
+		tracks, err := core.NewDemuxer(file).ExtractAllTracks(atoms)
+		if err != nil {
+			fmt.Printf("Error extracting tracks: %v\n", err)
+			os.Exit(1)
+		}
+
+		var track *core.Track
+		for i := range tracks {
+			if tracks[i].ID == trackID {
+				track = &tracks[i]
+				break
+			}
+		}
+		if track == nil {
+			fmt.Printf("Error: track %d not found\n", trackID)
+			os.Exit(1)
+		}
+
+		sum := track.Summarize(5)
+		fmt.Printf("Track %d (%s, timescale %d)\n", track.ID, track.Type, track.Timescale)
+		fmt.Printf("  Samples:     %d (%d keyframes)\n", sum.Count, sum.Keyframes)
+		fmt.Printf("  Total bytes: %d\n", sum.TotalBytes)
+		fmt.Printf("  Duration:    %s\n", sum.Duration)
+		fmt.Printf("  Size:        min %d / avg %d / max %d\n", sum.MinSize, sum.AvgSize, sum.MaxSize)
+		fmt.Printf("  First offsets:")
+		for _, off := range sum.FirstOffsets {
+			fmt.Printf(" %d", off)
+		}
+		fmt.Println()
+
+	case "dumptrack":
+		if len(os.Args) < 4 {
+			fmt.Println("Usage: cromedia dumptrack <file.mp4> <trackID>")
+			os.Exit(1)
+		}
+
+		trackID, err := strconv.Atoi(os.Args[3])
+		if err != nil {
+			fmt.Printf("Invalid track ID %q\n", os.Args[3])
+			os.Exit(1)
+		}
+
+		file, err := os.Open(os.Args[2])
+		if err != nil {
+			fmt.Printf("Error opening file: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+
+		// Keep stdout pure CSV: demuxer messages go to stderr
+		atoms, err := probeForTracks(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error probing file: %v\n", err)
+			os.Exit(1)
+		}
+		demuxer := core.NewDemuxer(file)
+		demuxer.Logger = log.New(os.Stderr, "", 0)
+		tracks, err := demuxer.ExtractAllTracks(atoms)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error extracting tracks: %v\n", err)
+			os.Exit(1)
+		}
+
+		var track *core.Track
+		for i := range tracks {
+			if tracks[i].ID == trackID {
+				track = &tracks[i]
+				break
+			}
+		}
+		if track == nil {
+			fmt.Fprintf(os.Stderr, "Error: track %d not found\n", trackID)
+			os.Exit(1)
+		}
+		if err := track.WriteSampleCSV(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing CSV: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "faststart":
+		if len(os.Args) < 4 {
+			fmt.Println("Usage: cromedia faststart <input.mp4> <output.mp4>")
+			os.Exit(1)
+		}
+
+		file, err := os.Open(os.Args[2])
+		if err != nil {
+			fmt.Printf("Error opening file: %v\n", err)
+			os.Exit(1)
+		}
+		fast, err := core.IsFastStartFile(file)
+		file.Close()
+		if err != nil {
+			fmt.Printf("Error probing file: %v\n", err)
+			os.Exit(1)
+		}
+		if fast {
+			fmt.Println("Input is already faststart, copying as-is")
+		}
+
+		if err := core.MoveMoovToFront(os.Args[2], os.Args[3]); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Wrote %s\n", os.Args[3])
+
+	case "strip":
+		if len(os.Args) < 4 {
+			fmt.Println("Usage: cromedia strip <input.mp4> <output.mp4>")
+			os.Exit(1)
+		}
+
+		removed, err := core.StripPadding(os.Args[2], os.Args[3])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Wrote %s (%d bytes of padding removed)\n", os.Args[3], removed)
+
+	case "transcode":
+		if len(os.Args) < 4 {
+			fmt.Println("Usage: cromedia transcode <input.mp4> <output> [--threads N] [--exec <encoder> [args...]]")
+			os.Exit(1)
+		}
+
+		inputFile := os.Args[2]
+		outputFile := os.Args[3]
+		threads := runtime.NumCPU()
+		var encoder string
+		var encoderArgs []string
+		flags := os.Args[4:]
+		for i := 0; i < len(flags); i++ {
+			switch flags[i] {
+			case "--threads":
+				if i+1 >= len(flags) {
+					fmt.Println("Error: --threads needs a value")
+					os.Exit(1)
+				}
+				i++
+				n, err := parseThreads(flags[i])
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				threads = n
+			case "--exec":
+				// Everything after the encoder name is passed to it
+				if i+1 >= len(flags) {
+					fmt.Println("Error: --exec needs an encoder")
+					os.Exit(1)
+				}
+				encoder = flags[i+1]
+				encoderArgs = flags[i+2:]
+				i = len(flags)
+			default:
+				fmt.Printf("Error: unknown flag %q\n", flags[i])
+				os.Exit(1)
+			}
+		}
+
+		file, err := os.Open(inputFile)
+		if err != nil {
+			fmt.Printf("Error opening file: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+
+		atoms, err := probeForTracks(file)
+		if err != nil {
+			fmt.Printf("Error probing file: %v\n", err)
+			os.Exit(1)
+		}
+		tracks, err := core.NewDemuxer(file).ExtractAllTracks(atoms)
+		if err != nil {
+			fmt.Printf("Error extracting tracks: %v\n", err)
+			os.Exit(1)
+		}
+		var video *core.Track
+		for i := range tracks {
+			if tracks[i].Type == core.TrackTypeVideo {
+				video = &tracks[i]
+				break
+			}
+		}
+		if video == nil {
+			fmt.Println("Error: no video track found")
+			os.Exit(1)
+		}
+
+		var tc core.Transcoder = &core.DummyTranscoder{}
+		if encoder != "" {
+			et, err := core.NewExecTranscoder(encoder, encoderArgs, file)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			// Feed H.264/HEVC as Annex-B with the parameter sets in front
+			et.Stsd = video.Stsd
+			tc = et
+		}
+
+		out, err := os.Create(outputFile)
+		if err != nil {
+			fmt.Printf("Error creating output: %v\n", err)
+			os.Exit(1)
+		}
+		defer out.Close()
+
+		fmt.Printf("[Main] Transcoding track %d (%s, %d samples) on %d workers...\n", video.ID, video.CodecTag, len(video.Samples), threads)
+		var inBytes atomic.Int64
+		written := &countingWriter{w: out}
+		begin := time.Now()
+		err = core.RunPipelined(context.Background(), video.Samples, threads, written, func(gop *core.GOP) ([]byte, error) {
+			// RunPipelined segments bare samples: tag the GOP with its source track
+			gop.CodecTag, gop.TrackType = video.CodecTag, video.Type
+			inBytes.Add(gop.Stats().Bytes)
+			return tc.Transcode(gop)
+		})
+		elapsed := time.Since(begin)
+		if err != nil {
+			fmt.Printf("Error transcoding: %v\n", err)
+			os.Exit(1)
+		}
+
+		secs := elapsed.Seconds()
+		if secs <= 0 {
+			secs = 1e-9
+		}
+		fmt.Printf("[Main] %d bytes in, %d bytes out in %s\n", inBytes.Load(), written.n, elapsed.Round(time.Millisecond))
+		fmt.Printf("[Main] Throughput: %.1f MB/s, %.1fx realtime\n", float64(inBytes.Load())/secs/(1<<20), video.DurationSeconds()/secs)
+		fmt.Printf("Wrote %s\n", outputFile)
+
 	case "version":
 		fmt.Println("CroMedia v0.8")
 		fmt.Println("Features: Multi-Track, Interleaving, B-Frame (ctts), Edit Lists (edts), Matrix Rotation, co64")